@@ -10,23 +10,40 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
-	lhclientset "github.com/longhorn/longhorn-manager/k8s/pkg/client/clientset/versioned"
+	"github.com/rancher/lasso/pkg/cache"
+	lassoclient "github.com/rancher/lasso/pkg/client"
+	adminregv1 "github.com/rancher/wrangler/v3/pkg/generated/controllers/admissionregistration.k8s.io"
+	apiextv1 "github.com/rancher/wrangler/v3/pkg/generated/controllers/apiextensions.k8s.io"
 	corev1 "github.com/rancher/wrangler/v3/pkg/generated/controllers/core"
+	networkingv1 "github.com/rancher/wrangler/v3/pkg/generated/controllers/networking.k8s.io"
+	storagev1 "github.com/rancher/wrangler/v3/pkg/generated/controllers/storage"
 	"github.com/rancher/wrangler/v3/pkg/kubeconfig"
 	"github.com/rancher/wrangler/v3/pkg/leader"
+	"github.com/rancher/wrangler/v3/pkg/schemes"
 	"github.com/rancher/wrangler/v3/pkg/signals"
 	"github.com/rancher/wrangler/v3/pkg/start"
+	wranglerwebhook "github.com/rancher/wrangler/v3/pkg/webhook"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 
-	"github.com/harvester/networkfs-manager/pkg/controller/endpoint"
+	"github.com/harvester/networkfs-manager/pkg/activity"
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/controller/discovery"
 	"github.com/harvester/networkfs-manager/pkg/controller/networkfilesystem"
-	"github.com/harvester/networkfs-manager/pkg/controller/sharemanager"
+	"github.com/harvester/networkfs-manager/pkg/controller/vmmount"
 	ntefsv1 "github.com/harvester/networkfs-manager/pkg/generated/controllers/harvesterhci.io"
 	ctrllonghorn "github.com/harvester/networkfs-manager/pkg/generated/controllers/longhorn.io"
+	"github.com/harvester/networkfs-manager/pkg/health"
+	"github.com/harvester/networkfs-manager/pkg/metrics"
+	"github.com/harvester/networkfs-manager/pkg/nameserver"
 	utils "github.com/harvester/networkfs-manager/pkg/utils"
+	"github.com/harvester/networkfs-manager/pkg/webhook"
+	nfswebhook "github.com/harvester/networkfs-manager/pkg/webhook/networkfilesystem"
 )
 
 func main() {
@@ -61,6 +78,130 @@ func main() {
 			EnvVars:     []string{"HARVESTER_NAMESPACE"},
 			Destination: &opt.Namespace,
 		},
+		&cli.StringFlag{
+			Name:        "node-name",
+			EnvVars:     []string{"NODE_NAME"},
+			Usage:       "name of the node the manager runs on",
+			Destination: &opt.NodeName,
+		},
+		&cli.IntFlag{
+			Name:        "webhook-port",
+			Value:       8443,
+			DefaultText: "8443",
+			EnvVars:     []string{"WEBHOOK_PORT"},
+			Usage:       "port of the validating webhook server, 0 to disable it",
+			Destination: &opt.WebhookPort,
+		},
+		&cli.StringFlag{
+			Name:        "webhook-service-name",
+			Value:       "harvester-network-fs-manager-webhook",
+			DefaultText: "harvester-network-fs-manager-webhook",
+			EnvVars:     []string{"WEBHOOK_SERVICE_NAME"},
+			Usage:       "name of the service in front of the validating webhook server",
+			Destination: &opt.WebhookServiceName,
+		},
+		&cli.BoolFlag{
+			Name:        "auto-discovery",
+			EnvVars:     []string{"AUTO_DISCOVERY"},
+			Usage:       "create the network filesystem for every Longhorn RWX volume unless the PVC or StorageClass opts out",
+			Destination: &opt.AutoDiscovery,
+		},
+		&cli.BoolFlag{
+			Name:        "gc-orphaned",
+			EnvVars:     []string{"GC_ORPHANED"},
+			Usage:       "delete the discovered network filesystem once its Longhorn volume or PV is gone",
+			Destination: &opt.GCOrphaned,
+		},
+		&cli.DurationFlag{
+			Name:        "transition-timeout",
+			Value:       10 * time.Minute,
+			DefaultText: "10m",
+			EnvVars:     []string{"TRANSITION_TIMEOUT"},
+			Usage:       "default deadline of the enable/disable transition before the network filesystem is marked as Failed, 0 to wait forever",
+			Destination: &opt.TransitionTimeout,
+		},
+		&cli.DurationFlag{
+			Name:        "consumer-grace-period",
+			Value:       5 * time.Minute,
+			DefaultText: "5m",
+			EnvVars:     []string{"CONSUMER_GRACE_PERIOD"},
+			Usage:       "default period the network filesystem enabled for its consumers is kept enabled after the last consumer is unregistered",
+			Destination: &opt.ConsumerGracePeriod,
+		},
+		&cli.DurationFlag{
+			Name:        "failback-delay",
+			Value:       5 * time.Minute,
+			DefaultText: "5m",
+			EnvVars:     []string{"FAILBACK_DELAY"},
+			Usage:       "period a more preferred node must stay available before the enabled network filesystem moves back to it",
+			Destination: &opt.FailbackDelay,
+		},
+		&cli.DurationFlag{
+			Name:        "probe-interval",
+			Value:       30 * time.Second,
+			DefaultText: "30s",
+			EnvVars:     []string{"PROBE_INTERVAL"},
+			Usage:       "interval of the NFS data path probe of the enabled exports, 0 to disable it",
+			Destination: &opt.ProbeInterval,
+		},
+		&cli.DurationFlag{
+			Name:        "probe-timeout",
+			Value:       5 * time.Second,
+			DefaultText: "5s",
+			EnvVars:     []string{"PROBE_TIMEOUT"},
+			Usage:       "timeout of a single NFS data path probe",
+			Destination: &opt.ProbeTimeout,
+		},
+		&cli.IntFlag{
+			Name:        "metrics-port",
+			Value:       9550,
+			DefaultText: "9550",
+			EnvVars:     []string{"METRICS_PORT"},
+			Usage:       "port of the Prometheus metrics server, 0 to disable it",
+			Destination: &opt.MetricsPort,
+		},
+		&cli.IntFlag{
+			Name:        "health-port",
+			Value:       9551,
+			DefaultText: "9551",
+			EnvVars:     []string{"HEALTH_PORT"},
+			Usage:       "port of the /healthz and /readyz probes, 0 to disable them",
+			Destination: &opt.HealthPort,
+		},
+		&cli.IntFlag{
+			Name:        "pprof-port",
+			EnvVars:     []string{"PPROF_PORT"},
+			Usage:       "port of the pprof server on the loopback address, 0 (default) to disable it",
+			Destination: &opt.PprofPort,
+		},
+		&cli.IntFlag{
+			Name:        "dns-port",
+			EnvVars:     []string{"DNS_PORT"},
+			Usage:       "port of the authoritative DNS server of the network filesystem zone, 0 (default) to disable it",
+			Destination: &opt.DNSPort,
+		},
+		&cli.StringFlag{
+			Name:        "dns-zone",
+			Value:       nameserver.DefaultZone,
+			EnvVars:     []string{"DNS_ZONE"},
+			Usage:       "zone of the DNS server, the network filesystem is named <name>.<namespace>.<zone>",
+			Destination: &opt.DNSZone,
+		},
+		&cli.DurationFlag{
+			Name:        "dns-ttl",
+			Value:       nameserver.DefaultTTL,
+			EnvVars:     []string{"DNS_TTL"},
+			Usage:       "TTL of the DNS records, keep it short so the clients follow the endpoint changes",
+			Destination: &opt.DNSTTL,
+		},
+		&cli.DurationFlag{
+			Name:        "activity-interval",
+			Value:       time.Minute,
+			DefaultText: "1m",
+			EnvVars:     []string{"ACTIVITY_INTERVAL"},
+			Usage:       "interval of the client activity check of the exports served on the node, 0 to disable the idle timeout",
+			Destination: &opt.ActivityInterval,
+		},
 	}
 
 	app.Action = func(_ *cli.Context) error {
@@ -86,6 +227,9 @@ func run(opt *utils.Option) error {
 		return errors.New("namespace cannot be empty")
 	}
 
+	// the workqueue metrics provider must be set before any controller is created
+	metrics.RegisterWorkqueueProvider()
+
 	ctx := signals.SetupSignalContext()
 	config, err := kubeconfig.GetNonInteractiveClientConfig(opt.KubeConfig).ClientConfig()
 	if err != nil {
@@ -107,9 +251,20 @@ func run(opt *utils.Option) error {
 		return fmt.Errorf("failed to create endpoints controller: %v", err)
 	}
 
-	lhClient, err := lhclientset.NewForConfig(config)
+	// the binding Secrets and ConfigMaps are cached apart, only the ones labeled with their network filesystem
+	bindingSharedClient, err := lassoclient.NewSharedClientFactory(config, &lassoclient.SharedClientFactoryOptions{Scheme: schemes.All})
+	if err != nil {
+		return fmt.Errorf("failed to create binding client: %v", err)
+	}
+	clientBinding, err := corev1.NewFactoryFromConfigWithOptions(config, &corev1.FactoryOptions{
+		SharedCacheFactory: cache.NewSharedCachedFactory(bindingSharedClient, &cache.SharedCacheFactoryOptions{
+			DefaultTweakList: func(opts *metav1.ListOptions) {
+				opts.LabelSelector = networkfsv2.LabelNetworkFS
+			},
+		}),
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create longhorn client: %v", err)
+		return fmt.Errorf("failed to create binding controller: %v", err)
 	}
 
 	lhCtrlClient, err := ctrllonghorn.NewFactoryFromConfig(config)
@@ -117,25 +272,143 @@ func run(opt *utils.Option) error {
 		return fmt.Errorf("failed to create longhorn controller: %v", err)
 	}
 
-	endpoints := clientv1.Core().V1().Endpoints()
-	networkFilsystems := clientNetfs.Harvesterhci().V1beta1().NetworkFilesystem()
-	sharemanagers := lhCtrlClient.Longhorn().V1beta2().ShareManager()
+	clientNetworking, err := networkingv1.NewFactoryFromConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create networkpolicy controller: %v", err)
+	}
+
+	clientStorage, err := storagev1.NewFactoryFromConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create storageclass controller: %v", err)
+	}
+
+	clientAPIExt, err := apiextv1.NewFactoryFromConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create customresourcedefinition controller: %v", err)
+	}
+	crds := clientAPIExt.Apiextensions().V1().CustomResourceDefinition()
+
+	networkFilsystems := clientNetfs.Harvesterhci().V1beta2().NetworkFilesystem()
+
+	recorder, err := utils.NewEventRecorder(client)
+	if err != nil {
+		return fmt.Errorf("failed to create event recorder: %v", err)
+	}
+
+	checker := health.NewChecker()
+	if opt.HealthPort > 0 {
+		go func() {
+			if err := checker.Run(ctx, opt.HealthPort); err != nil {
+				logrus.Fatalf("failed to run health server: %v", err)
+			}
+		}()
+	}
+
+	if opt.PprofPort > 0 {
+		go func() {
+			if err := health.RunPprof(ctx, opt.PprofPort); err != nil {
+				logrus.Errorf("failed to run pprof server: %v", err)
+			}
+		}()
+	}
+
+	if opt.MetricsPort > 0 {
+		go func() {
+			if err := metrics.Run(ctx, opt.MetricsPort); err != nil {
+				logrus.Fatalf("failed to run metrics server: %v", err)
+			}
+		}()
+	}
+
+	// the DNS server is served by every replica on its node, from a cache of its own since the controllers only run on the leader
+	if opt.DNSPort > 0 {
+		dnsNetfs, err := ntefsv1.NewFactoryFromConfig(config)
+		if err != nil {
+			return fmt.Errorf("failed to create networkFS cache of the DNS server: %v", err)
+		}
+		server := nameserver.NewServer(opt.DNSZone, opt.DNSTTL, dnsNetfs.Harvesterhci().V1beta2().NetworkFilesystem().Cache())
+		go func() {
+			if err := dnsNetfs.Start(ctx, 1); err != nil {
+				logrus.Fatalf("failed to start networkFS cache of the DNS server: %v", err)
+			}
+			if err := server.Run(ctx, opt.DNSPort); err != nil {
+				logrus.Fatalf("failed to run DNS server: %v", err)
+			}
+		}()
+	}
+
+	// the client activity is checked by every replica on its node, the share-manager pods are spread over the nodes
+	if opt.ActivityInterval > 0 && opt.NodeName != "" {
+		activityNetfs, err := ntefsv1.NewFactoryFromConfig(config)
+		if err != nil {
+			return fmt.Errorf("failed to create networkFS cache of the activity monitor: %v", err)
+		}
+		activityCore, err := corev1.NewFactoryFromConfigWithOptions(config, &corev1.FactoryOptions{Namespace: utils.LHNameSpace})
+		if err != nil {
+			return fmt.Errorf("failed to create endpoints cache of the activity monitor: %v", err)
+		}
+		monitor := activity.NewMonitor(opt, activityNetfs.Harvesterhci().V1beta2().NetworkFilesystem(), activityCore.Core().V1().Endpoints().Cache())
+		go func() {
+			if err := start.All(ctx, 1, activityNetfs, activityCore); err != nil {
+				logrus.Fatalf("failed to start caches of the activity monitor: %v", err)
+			}
+			monitor.Run(ctx)
+		}()
+	}
+
+	// the webhook is served by every replica, not only the leader
+	if opt.WebhookPort > 0 {
+		adminReg, err := adminregv1.NewFactoryFromConfig(config)
+		if err != nil {
+			return fmt.Errorf("failed to create admissionregistration controller: %v", err)
+		}
+
+		router := wranglerwebhook.NewRouter()
+		nfswebhook.Register(router, nfswebhook.NewValidator(clientv1.Core().V1().PersistentVolumeClaim(), clientv1.Core().V1().PersistentVolume(), lhCtrlClient.Longhorn().V1beta2().Volume(), lhCtrlClient.Longhorn().V1beta2().Node()))
+		server := webhook.NewServer(router, nfswebhook.NewConverter(), clientv1.Core().V1().Secret(), adminReg.Admissionregistration().V1().ValidatingWebhookConfiguration(), crds, opt)
+		go func() {
+			if err := server.Run(ctx); err != nil {
+				logrus.Fatalf("failed to run webhook server: %v", err)
+			}
+		}()
+	}
 
 	cb := func(ctx context.Context) {
-		if err := endpoint.Register(ctx, endpoints, networkFilsystems, opt); err != nil {
-			logrus.Errorf("failed to register endpoint controller: %v", err)
+		checker.SetLeader()
+
+		if err := networkfilesystem.MigrateStorageVersion(ctx, crds, networkFilsystems); err != nil {
+			logrus.Errorf("failed to migrate the networkfilesystem storage version: %v", err)
+		}
+
+		if err := networkfilesystem.MigrateConditions(networkFilsystems); err != nil {
+			logrus.Errorf("failed to migrate the networkfilesystem conditions: %v", err)
 		}
 
-		if err := networkfilesystem.Register(ctx, clientv1.Core().V1(), lhClient, endpoints, networkFilsystems, opt); err != nil {
+		if err := networkfilesystem.Register(ctx, clientv1.Core().V1(), clientBinding.Core().V1(), lhCtrlClient.Longhorn().V1beta2(), clientNetworking.Networking().V1(), networkFilsystems, recorder, opt); err != nil {
 			logrus.Errorf("failed to register networkfilesystem controller: %v", err)
 		}
 
-		if err := sharemanager.Register(ctx, sharemanagers, networkFilsystems, opt); err != nil {
-			logrus.Errorf("failed to register sharemanager controller: %v", err)
+		if err := metrics.RegisterNetworkFSCollector(networkFilsystems.Cache()); err != nil {
+			logrus.Errorf("failed to register networkfilesystem metrics: %v", err)
+		}
+
+		if err := discovery.Register(ctx, clientv1.Core().V1(), clientStorage.Storage().V1(), networkFilsystems, recorder, opt); err != nil {
+			logrus.Errorf("failed to register discovery controller: %v", err)
+		}
+
+		// the VM mounts are only rendered on the cluster running KubeVirt, e.g. Harvester
+		if _, err := crds.Get(vmmount.VirtualMachineCRDName, metav1.GetOptions{}); err == nil {
+			if err := vmmount.Register(ctx, clientv1.ControllerFactory(), clientv1.Core().V1(), networkFilsystems, recorder); err != nil {
+				logrus.Errorf("failed to register vm mount controller: %v", err)
+			}
+		} else if !apierrors.IsNotFound(err) {
+			logrus.Errorf("failed to get the crd %s: %v", vmmount.VirtualMachineCRDName, err)
 		}
 
-		if err := start.All(ctx, opt.Threadiness, clientNetfs, clientv1, lhCtrlClient); err != nil {
+		if err := start.All(ctx, opt.Threadiness, clientNetfs, clientv1, clientBinding, clientNetworking, clientStorage, lhCtrlClient); err != nil {
 			logrus.Errorf("failed to start controller: %v", err)
+		} else {
+			checker.SetSynced()
 		}
 
 		<-ctx.Done()
@@ -0,0 +1,152 @@
+package activity
+
+import (
+	"context"
+	"time"
+
+	ctlv1 "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/retry"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	ctlntefsv2 "github.com/harvester/networkfs-manager/pkg/generated/controllers/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+const (
+	// hostProcPath is the procfs of the host mounted in the manager pod
+	hostProcPath = "/host/proc"
+	// refreshPeriod bounds the updates of the last activity, it is only rewritten once it is older than the period
+	refreshPeriod = 5 * time.Minute
+	// MinIdleTimeout is the shortest idle timeout, so the throttled last activity does not disable the used export
+	MinIdleTimeout = 2 * refreshPeriod
+)
+
+// LastActivity returns the last time a client was seen connected to the network filesystem
+func LastActivity(networkFS *networkfsv2.NetworkFilesystem) (time.Time, bool) {
+	value, ok := networkFS.Annotations[networkfsv2.AnnotationLastActivity]
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// Monitor records the client activity of the exports served on its node. The clients are the established connections
+// to the NFS port of the share-manager pods, the short-lived connections such as the data path probe are rarely seen.
+type Monitor struct {
+	nodeName       string
+	interval       time.Duration
+	networkFSs     ctlntefsv2.NetworkFilesystemClient
+	networkFSCache ctlntefsv2.NetworkFilesystemCache
+	endpointCache  ctlv1.EndpointsCache
+}
+
+// NewMonitor returns the monitor of the exports served on the node, the endpoints cache holds the Longhorn namespace
+func NewMonitor(opt *utils.Option, networkFSs ctlntefsv2.NetworkFilesystemController, endpointCache ctlv1.EndpointsCache) *Monitor {
+	return &Monitor{
+		nodeName:       opt.NodeName,
+		interval:       opt.ActivityInterval,
+		networkFSs:     networkFSs,
+		networkFSCache: networkFSs.Cache(),
+		endpointCache:  endpointCache,
+	}
+}
+
+// Run checks the client activity on every interval until the context is done
+func (m *Monitor) Run(ctx context.Context) {
+	logrus.Infof("Monitoring the client activity of the exports on node %s", m.nodeName)
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.checkAll()
+		}
+	}
+}
+
+func (m *Monitor) checkAll() {
+	networkFSs, err := m.networkFSCache.List("", labels.Everything())
+	if err != nil {
+		logrus.Errorf("Failed to list network filesystems to monitor: %v", err)
+		return
+	}
+
+	// the addresses of the share-manager pods on the node, the pod IP is the local address of the NFS connections
+	monitored := map[string]*networkfsv2.NetworkFilesystem{}
+	for _, networkFS := range networkFSs {
+		if networkFS.Spec.IdleTimeout == nil || networkFS.Status.State != networkfsv2.NetworkFSStateEnabled || networkFS.Status.Volume == "" {
+			continue
+		}
+		endpoint, err := m.endpointCache.Get(utils.LHNameSpace, networkFS.Status.Volume)
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				logrus.Errorf("Failed to get endpoint of network filesystem %s/%s: %v", networkFS.Namespace, networkFS.Name, err)
+			}
+			continue
+		}
+		for _, subset := range endpoint.Subsets {
+			for _, addr := range subset.Addresses {
+				if addr.NodeName != nil && *addr.NodeName == m.nodeName {
+					monitored[addr.IP] = networkFS
+				}
+			}
+		}
+	}
+	if len(monitored) == 0 {
+		return
+	}
+
+	local := map[string]bool{}
+	for ip := range monitored {
+		local[ip] = true
+	}
+	clients, err := establishedClients(hostProcPath, utils.NFSPort, local)
+	if err != nil {
+		logrus.Errorf("Failed to read the NFS connections of node %s: %v", m.nodeName, err)
+		return
+	}
+
+	now := time.Now()
+	for ip, networkFS := range monitored {
+		if len(clients[ip]) == 0 {
+			continue
+		}
+		logrus.Debugf("Network filesystem %s/%s has %d clients", networkFS.Namespace, networkFS.Name, len(clients[ip]))
+		if err := m.recordActivity(networkFS, now); err != nil {
+			logrus.Errorf("Failed to record the activity of network filesystem %s/%s: %v", networkFS.Namespace, networkFS.Name, err)
+		}
+	}
+}
+
+// recordActivity updates the last activity of the network filesystem, unless it was recorded within the refresh period
+func (m *Monitor) recordActivity(networkFS *networkfsv2.NetworkFilesystem, now time.Time) error {
+	if last, ok := LastActivity(networkFS); ok && now.Sub(last) < refreshPeriod {
+		return nil
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest, err := m.networkFSs.Get(networkFS.Namespace, networkFS.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if last, ok := LastActivity(latest); ok && now.Sub(last) < refreshPeriod {
+			return nil
+		}
+		latestCpy := latest.DeepCopy()
+		if latestCpy.Annotations == nil {
+			latestCpy.Annotations = map[string]string{}
+		}
+		latestCpy.Annotations[networkfsv2.AnnotationLastActivity] = now.UTC().Format(time.RFC3339)
+		_, err = m.networkFSs.Update(latestCpy)
+		return err
+	})
+}
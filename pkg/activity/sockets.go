@@ -0,0 +1,101 @@
+package activity
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tcpEstablished is the state of the established connection in /proc/net/tcp, see include/net/tcp_states.h
+const tcpEstablished = "01"
+
+// establishedClients returns the remote addresses of the established TCP connections to the port of the local
+// addresses, by local address. The sockets of every network namespace of the host are read through the procfs of the
+// host, the share-manager pods do not share the host network.
+func establishedClients(procPath string, port uint16, local map[string]bool) (map[string]map[string]bool, error) {
+	entries, err := os.ReadDir(procPath)
+	if err != nil {
+		return nil, err
+	}
+
+	clients := map[string]map[string]bool{}
+	namespaces := map[string]bool{}
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		// the processes sharing the network namespace share the sockets too, read them once
+		namespace, err := os.Readlink(filepath.Join(procPath, entry.Name(), "ns", "net"))
+		if err != nil || namespaces[namespace] {
+			// the process is gone
+			continue
+		}
+		namespaces[namespace] = true
+
+		for _, file := range []string{"tcp", "tcp6"} {
+			if err := readSockets(filepath.Join(procPath, entry.Name(), "net", file), port, local, clients); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+	}
+	return clients, nil
+}
+
+// readSockets adds the established connections of the sockets file, e.g. /proc/<pid>/net/tcp, to the clients
+func readSockets(path string, port uint16, local map[string]bool, clients map[string]map[string]bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	// the header line
+	scanner.Scan()
+	for scanner.Scan() {
+		// sl local_address rem_address st ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[3] != tcpEstablished {
+			continue
+		}
+		localIP, localPort, err := parseSocketAddress(fields[1])
+		if err != nil || localPort != port || !local[localIP.String()] {
+			continue
+		}
+		remoteIP, _, err := parseSocketAddress(fields[2])
+		if err != nil {
+			continue
+		}
+		if clients[localIP.String()] == nil {
+			clients[localIP.String()] = map[string]bool{}
+		}
+		clients[localIP.String()][remoteIP.String()] = true
+	}
+	return scanner.Err()
+}
+
+// parseSocketAddress parses the address of /proc/net/tcp, the hex of the IP in the host byte order of its 32-bit words
+// followed by the hex of the port, e.g. 0100007F:0801 for 127.0.0.1:2049
+func parseSocketAddress(address string) (net.IP, uint16, error) {
+	host, port, found := strings.Cut(address, ":")
+	if !found {
+		return nil, 0, fmt.Errorf("invalid socket address %q", address)
+	}
+	ip, err := hex.DecodeString(host)
+	if err != nil || (len(ip) != net.IPv4len && len(ip) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("invalid socket address %q", address)
+	}
+	for i := 0; i < len(ip); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = ip[i+3], ip[i+2], ip[i+1], ip[i]
+	}
+	portNumber, err := strconv.ParseUint(port, 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid socket address %q", address)
+	}
+	return net.IP(ip), uint16(portNumber), nil
+}
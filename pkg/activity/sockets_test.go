@@ -0,0 +1,150 @@
+package activity
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const socketsHeader = "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+
+// socket returns the line of /proc/net/tcp of the connection in the state
+func socket(local, remote, state string) string {
+	return "   0: " + local + " " + remote + " " + state + " 00000000:00000000 00:00000000 00000000     0        0 12345 1 0000000000000000 20 4 30 10 -1\n"
+}
+
+// writeProcess writes the network namespace link and the sockets files of the process to the procfs fixture
+func writeProcess(t *testing.T, procPath, pid, namespace string, files map[string]string) {
+	t.Helper()
+	dir := filepath.Join(procPath, pid)
+	for _, sub := range []string{"ns", "net"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if namespace != "" {
+		if err := os.Symlink(namespace, filepath.Join(dir, "ns", "net")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, "net", name), []byte(socketsHeader+content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParseSocketAddress(t *testing.T) {
+	tests := []struct {
+		address  string
+		wantIP   string
+		wantPort uint16
+		wantErr  bool
+	}{
+		{address: "0100007F:0801", wantIP: "127.0.0.1", wantPort: 2049},
+		{address: "0A00340A:03FF", wantIP: "10.52.0.10", wantPort: 1023},
+		{address: "00000000000000000000000001000000:0801", wantIP: "::1", wantPort: 2049},
+		{address: "000000FD000000000000000011000000:0801", wantIP: "fd00::11", wantPort: 2049},
+		// the words are in the host byte order, the words themselves in the network order
+		{address: "B80D0120000000000000000001000000:0801", wantIP: "2001:db8::1", wantPort: 2049},
+		// the IPv4 client of the dual-stack socket
+		{address: "0000000000000000FFFF00000B00340A:0801", wantIP: "10.52.0.11", wantPort: 2049},
+		{address: "0100007F", wantErr: true},
+		{address: "0100007G:0801", wantErr: true},
+		{address: "01000000007F:0801", wantErr: true},
+		{address: "0100007F:10000", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			ip, port, err := parseSocketAddress(tt.address)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parsed %s:%d, want an error", ip, port)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ip.String() != tt.wantIP || port != tt.wantPort {
+				t.Errorf("address = %s:%d, want %s:%d", ip, port, tt.wantIP, tt.wantPort)
+			}
+		})
+	}
+}
+
+func TestEstablishedClients(t *testing.T) {
+	const (
+		established = "01"
+		timeWait    = "06"
+		listen      = "0A"
+
+		// share-manager pod 10.52.0.10 and 10.52.0.11, on the NFS port
+		export1 = "0A00340A:0801"
+		export2 = "0B00340A:0801"
+		// the dual-stack socket of share-manager pod 10.52.0.11, and fd00::11
+		export2Mapped = "0000000000000000FFFF00000B00340A:0801"
+		export3       = "000000FD000000000000000011000000:0801"
+	)
+	procPath := t.TempDir()
+
+	// the network namespace of the share-manager pod 10.52.0.10
+	writeProcess(t, procPath, "1", "net:[4026531840]", map[string]string{
+		"tcp": socket(export1, "0100340A:03FF", established) +
+			// another connection of the same client
+			socket(export1, "0100340A:0400", established) +
+			socket(export1, "0200340A:0401", timeWait) +
+			socket("00000000:0801", "00000000:0000", listen) +
+			// another port of the pod
+			socket("0A00340A:006F", "0300340A:0402", established),
+	})
+	// another process of the same network namespace is not read again
+	writeProcess(t, procPath, "2", "net:[4026531840]", map[string]string{
+		"tcp": socket(export1, "0900340A:0403", established),
+	})
+	// the share-manager pod 10.52.0.11, listening on a dual-stack socket
+	writeProcess(t, procPath, "3", "net:[4026532100]", map[string]string{
+		"tcp": socket(export2, "0B00A8C0:0404", established),
+		"tcp6": socket(export2Mapped, "0000000000000000FFFF00000C00A8C0:0405", established) +
+			socket(export3, "000000FD000000000000000021000000:0406", established),
+	})
+	// the pod of another export on the node, which is not monitored
+	writeProcess(t, procPath, "4", "net:[4026532200]", map[string]string{
+		"tcp": socket("0C00340A:0801", "0400340A:0407", established),
+	})
+	// the process is gone
+	writeProcess(t, procPath, "5", "", nil)
+	// the other entries of the procfs
+	if err := os.MkdirAll(filepath.Join(procPath, "sys", "net"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	local := map[string]bool{"10.52.0.10": true, "10.52.0.11": true, "fd00::11": true}
+	clients, err := establishedClients(procPath, 2049, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]bool{
+		"10.52.0.10": {"10.52.0.1": true},
+		"10.52.0.11": {"192.168.0.11": true, "192.168.0.12": true},
+		"fd00::11":   {"fd00::21": true},
+	}
+	if !reflect.DeepEqual(clients, want) {
+		t.Errorf("clients = %v, want %v", clients, want)
+	}
+
+	// no client is connected to the idle export
+	clients, err = establishedClients(procPath, 2049, map[string]bool{"10.52.0.13": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clients) != 0 {
+		t.Errorf("clients = %v, want none", clients)
+	}
+
+	if _, err := establishedClients(filepath.Join(procPath, "missing"), 2049, local); err == nil {
+		t.Errorf("reading the missing procfs succeeded")
+	}
+}
@@ -20,6 +20,8 @@ const (
 	NetworkFSStateDisabled NetworkFSState = "Disabled"
 	// NetworkFSStateUnknown indicates the networkFS endpoint state is unknown (initial state)
 	NetworkFSStateUnknown NetworkFSState = "Unknown"
+	// NetworkFSStateFailed indicates the networkFS endpoint did not reach the desired state before the deadline
+	NetworkFSStateFailed NetworkFSState = "Failed"
 
 	// EndpointStatusReady indicates the endpoint is ready
 	EndpointStatusReady EndpointStatus = "Ready"
@@ -30,22 +32,55 @@ const (
 	// EndpointStatusUnknown indicates the endpoint status is unknown
 	EndpointStatusUnknown EndpointStatus = "Unknown"
 
-	// ConditionTypeReady indicates the networkFS is ready
+	// ConditionTypeReady indicates the networkFS endpoint is exported and ready to be mounted
 	ConditionTypeReady ConditionType = "Ready"
-	// ConditionTypeNotReady indicates the networkFS is not ready
+	// ConditionTypeProgressing indicates the networkFS is on its way to the desired state
+	ConditionTypeProgressing ConditionType = "Progressing"
+	// ConditionTypeDegraded indicates the networkFS did not reach the desired state before the deadline
+	ConditionTypeDegraded ConditionType = "Degraded"
+	// ConditionTypeReachable indicates the NFS data path of the enabled networkFS endpoint answers the probe
+	ConditionTypeReachable ConditionType = "Reachable"
+	// ConditionTypeEndpointChanged indicates the networkFS endpoint changed recently, it turns false after a while
+	ConditionTypeEndpointChanged ConditionType = "EndpointChanged"
+	// ConditionTypeBlocked indicates the disable request waits for the consumers of the volume to go away
+	ConditionTypeBlocked ConditionType = "Blocked"
+	// ConditionTypeOrphaned indicates the Longhorn volume of the networkFS is gone
+	ConditionTypeOrphaned ConditionType = "Orphaned"
+
+	// ConditionTypeNotReady is replaced by Ready=False, it is removed from the existing objects on startup
 	ConditionTypeNotReady ConditionType = "NotReady"
-	// ConditionTypeReconciling indicates the networkFS is reconciling (maybe wait for the backend NFS service)
+	// ConditionTypeReconciling is replaced by Progressing, it is removed from the existing objects on startup
 	ConditionTypeReconciling ConditionType = "Reconciling"
-	// ConditionTypeEndpointChanged indicates the networkFS endpoint is changed
-	ConditionTypeEndpointChanged ConditionType = "EndpointChanged"
+	// ConditionTypeFailed is replaced by Degraded, it is renamed on the existing objects on startup
+	ConditionTypeFailed ConditionType = "Failed"
+
+	// ConsumerKindPod indicates the consumer is a pod mounting the volume claim
+	ConsumerKindPod = "Pod"
+	// ConsumerKindAttachmentTicket indicates the consumer is a CSI attachment ticket written by another attacher
+	ConsumerKindAttachmentTicket = "AttachmentTicket"
 
 	// NetworkFSTypeNFS indicates the networkFS endpoint is NFS
 	NetworkFSTypeNFS string = "NFS"
+
+	// AnnotationForceDelete releases the deleting networkFS without waiting for the ShareManager to stop
+	AnnotationForceDelete = "networkfs.harvesterhci.io/force-delete"
+	// AnnotationDiscovery opts the PVC (or the PVCs of the StorageClass) in ("true") or out ("false") of the networkFS discovery
+	AnnotationDiscovery = "networkfs.harvesterhci.io/discovery"
+	// AnnotationDiscoveredFrom is the back reference from the discovered networkFS to the PVC, in the namespace/name format
+	AnnotationDiscoveredFrom = "networkfs.harvesterhci.io/discovered-from"
+	// LabelDiscovered marks the networkFS created by the discovery
+	LabelDiscovered = "networkfs.harvesterhci.io/discovered"
+)
+
+var (
+	// DefaultNFSVersions are the NFS versions served by the Longhorn share-manager
+	DefaultNFSVersions = []string{"4.1", "4.2"}
 )
 
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 // +kubebuilder:resource:shortName=netfilesystem;netfilesystems,scope=Namespaced
+// +kubebuilder:printcolumn:name="Volume",type="string",JSONPath=`.status.volume`
 // +kubebuilder:printcolumn:name="DesiredState",type="string",JSONPath=`.spec.desiredState`
 // +kubebuilder:printcolumn:name="Endpoint",type="string",JSONPath=`.status.endpoint`
 // +kubebuilder:printcolumn:name="EndpointStatus",type="string",JSONPath=`.status.status`
@@ -61,21 +96,39 @@ type NetworkFilesystem struct {
 }
 
 type NetworkFSSpec struct {
-	// name of the networkFS to which the endpoint is exported
-	// +kubebuilder:validation:Required
-	NetworkFSName string `json:"networkFSName"`
+	// name of the Longhorn volume to which the endpoint is exported, deprecated in favor of volumeRef
+	// +kubebuilder:validation:Optional
+	NetworkFSName string `json:"networkFSName,omitempty"`
+
+	// the volume to which the endpoint is exported, either a PVC or a Longhorn volume
+	// +kubebuilder:validation:Optional
+	VolumeRef *NetworkFSVolumeRef `json:"volumeRef,omitempty"`
 
-	// desired state of the networkFS endpoint, options are "Disabled", "Enabling", "Enabled", "Disabling", or "Unknown"
-	// +kubebuilder:validation:Required:Enum:=Disabled;Enabling;Enabled;Disabling;Unknown
+	// desired state of the networkFS endpoint, options are "Disabled" or "Enabled"
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum:=Disabled;Enabled
 	DesiredState NetworkFSState `json:"desiredState"`
 
 	// perferred nodes to which the networkFS endpoint is exported
 	// +kubebuilder:validation:Optional
 	PreferredNode string `json:"perferredNodes,omitempty"`
+
+	// disable the networkFS endpoint even if the volume is still used in the cluster
+	// +kubebuilder:validation:Optional
+	Force bool `json:"force,omitempty"`
+
+	// deadline of the enable/disable transition before the networkFS is marked as Failed, 0 means no deadline.
+	// The global default of the manager is used if it is not set.
+	// +kubebuilder:validation:Optional
+	TransitionTimeout *metav1.Duration `json:"transitionTimeout,omitempty"`
 }
 
 type NetworkFSStatus struct {
 
+	// the generation of the spec the status was computed from
+	// +kubebuilder:validation:Optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
 	// the conditions of the networkFS
 	// +kubebuilder:validation:Optional
 	// +kubebuilder:default:={}
@@ -86,8 +139,8 @@ type NetworkFSStatus struct {
 	// +kubebuilder:default:=""
 	Endpoint string `json:"endpoint"`
 
-	// the current state of the networkFS endpoint, options are "Enabled", "Enabling", "Disabling", "Disabled", or "Unknown"
-	// +kubebuilder:validation:Enum:=Enabled;Enabling;Disabling;Disabled;Unknown
+	// the current state of the networkFS endpoint, options are "Enabled", "Enabling", "Disabling", "Disabled", "Failed", or "Unknown"
+	// +kubebuilder:validation:Enum:=Enabled;Enabling;Disabling;Disabled;Failed;Unknown
 	// +kubebuilder:default:=Disabled
 	State NetworkFSState `json:"state"`
 
@@ -103,6 +156,88 @@ type NetworkFSStatus struct {
 
 	// the recommend mount options for the networkFS endpoint
 	MountOpts string `json:"mountOpts,omitempty"`
+
+	// the structured export address of the networkFS endpoint
+	// +kubebuilder:validation:Optional
+	Export *NetworkFSExport `json:"export,omitempty"`
+
+	// the ongoing enable/disable transition, it is cleared once the desired state is reached
+	// +kubebuilder:validation:Optional
+	Transition *NetworkFSTransition `json:"transition,omitempty"`
+
+	// the persistent volume resolved from the volume reference
+	// +kubebuilder:validation:Optional
+	PersistentVolume string `json:"persistentVolume,omitempty"`
+
+	// the Longhorn volume resolved from the volume reference
+	// +kubebuilder:validation:Optional
+	Volume string `json:"volume,omitempty"`
+
+	// the in-cluster consumers of the volume, they block the disable request unless it is forced
+	// +kubebuilder:validation:Optional
+	Consumers []NetworkFSConsumer `json:"consumers,omitempty"`
+}
+
+type NetworkFSTransition struct {
+	// the state the transition heads to, options are "Enabled" or "Disabled"
+	DesiredState NetworkFSState `json:"desiredState"`
+
+	// the time the transition started, the deadline counts from it
+	StartTime metav1.Time `json:"startTime"`
+}
+
+type NetworkFSVolumeRef struct {
+	// the PVC bound to the Longhorn RWX volume
+	// +kubebuilder:validation:Optional
+	PersistentVolumeClaim *NetworkFSClaimRef `json:"persistentVolumeClaim,omitempty"`
+
+	// the name of the Longhorn RWX volume, e.g. the volume created from the Longhorn UI
+	// +kubebuilder:validation:Optional
+	VolumeName string `json:"volumeName,omitempty"`
+}
+
+type NetworkFSClaimRef struct {
+	// the namespace of the PVC
+	// +kubebuilder:validation:Required
+	Namespace string `json:"namespace"`
+
+	// the name of the PVC
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+}
+
+type NetworkFSConsumer struct {
+	// the kind of the consumer, options are "Pod" or "AttachmentTicket"
+	Kind string `json:"kind"`
+
+	// the namespace of the consumer, empty for the attachment ticket
+	Namespace string `json:"namespace,omitempty"`
+
+	// the name of the pod or the ID of the attachment ticket
+	Name string `json:"name"`
+
+	// the node the pod runs on or the ticket attaches to
+	NodeName string `json:"nodeName,omitempty"`
+}
+
+type NetworkFSExport struct {
+	// the addresses serving the export
+	Addresses []string `json:"addresses,omitempty"`
+
+	// the port serving the export
+	Port int32 `json:"port,omitempty"`
+
+	// the transport protocol of the export port
+	Protocol corev1.Protocol `json:"protocol,omitempty"`
+
+	// the exported path on the NFS server
+	ExportPath string `json:"exportPath,omitempty"`
+
+	// the supported NFS versions
+	NFSVersions []string `json:"nfsVersions,omitempty"`
+
+	// the ready-to-use mount source, e.g. "10.52.0.10:/pvc-xxx"
+	MountSource string `json:"mountSource,omitempty"`
 }
 
 type NetworkFSCondition struct {
@@ -22,9 +22,26 @@ limitations under the License.
 package v1beta1
 
 import (
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSClaimRef) DeepCopyInto(out *NetworkFSClaimRef) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSClaimRef.
+func (in *NetworkFSClaimRef) DeepCopy() *NetworkFSClaimRef {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSClaimRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NetworkFSCondition) DeepCopyInto(out *NetworkFSCondition) {
 	*out = *in
@@ -42,9 +59,61 @@ func (in *NetworkFSCondition) DeepCopy() *NetworkFSCondition {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSConsumer) DeepCopyInto(out *NetworkFSConsumer) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSConsumer.
+func (in *NetworkFSConsumer) DeepCopy() *NetworkFSConsumer {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSConsumer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSExport) DeepCopyInto(out *NetworkFSExport) {
+	*out = *in
+	if in.Addresses != nil {
+		in, out := &in.Addresses, &out.Addresses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NFSVersions != nil {
+		in, out := &in.NFSVersions, &out.NFSVersions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSExport.
+func (in *NetworkFSExport) DeepCopy() *NetworkFSExport {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSExport)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NetworkFSSpec) DeepCopyInto(out *NetworkFSSpec) {
 	*out = *in
+	if in.VolumeRef != nil {
+		in, out := &in.VolumeRef, &out.VolumeRef
+		*out = new(NetworkFSVolumeRef)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TransitionTimeout != nil {
+		in, out := &in.TransitionTimeout, &out.TransitionTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
 	return
 }
 
@@ -68,6 +137,21 @@ func (in *NetworkFSStatus) DeepCopyInto(out *NetworkFSStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Export != nil {
+		in, out := &in.Export, &out.Export
+		*out = new(NetworkFSExport)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Transition != nil {
+		in, out := &in.Transition, &out.Transition
+		*out = new(NetworkFSTransition)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Consumers != nil {
+		in, out := &in.Consumers, &out.Consumers
+		*out = make([]NetworkFSConsumer, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -81,12 +165,50 @@ func (in *NetworkFSStatus) DeepCopy() *NetworkFSStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSTransition) DeepCopyInto(out *NetworkFSTransition) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSTransition.
+func (in *NetworkFSTransition) DeepCopy() *NetworkFSTransition {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSTransition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSVolumeRef) DeepCopyInto(out *NetworkFSVolumeRef) {
+	*out = *in
+	if in.PersistentVolumeClaim != nil {
+		in, out := &in.PersistentVolumeClaim, &out.PersistentVolumeClaim
+		*out = new(NetworkFSClaimRef)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSVolumeRef.
+func (in *NetworkFSVolumeRef) DeepCopy() *NetworkFSVolumeRef {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSVolumeRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NetworkFilesystem) DeepCopyInto(out *NetworkFilesystem) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 	return
 }
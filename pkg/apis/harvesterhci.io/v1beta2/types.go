@@ -0,0 +1,491 @@
+package v1beta2
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type NetworkFSState string
+type NetworkFSProtocol string
+type ConditionType string
+
+const (
+	// NetworkFSStateEnabled indicates the networkFS endpoint is enabled
+	NetworkFSStateEnabled NetworkFSState = "Enabled"
+	// NetworkFSStateEnabling indicates the networkFS endpoint is enabling
+	NetworkFSStateEnabling NetworkFSState = "Enabling"
+	// NetworkFSStateDisabling indicates the networkFS endpoint is disabling
+	NetworkFSStateDisabling NetworkFSState = "Disabling"
+	// NetworkFSStateDisabled indicates the networkFS endpoint is disabled
+	NetworkFSStateDisabled NetworkFSState = "Disabled"
+	// NetworkFSStateUnknown indicates the networkFS endpoint state is unknown (initial state)
+	NetworkFSStateUnknown NetworkFSState = "Unknown"
+	// NetworkFSStateFailed indicates the networkFS endpoint did not reach the desired state before the deadline
+	NetworkFSStateFailed NetworkFSState = "Failed"
+
+	// NetworkFSProtocolNFS indicates the networkFS endpoint is exported over NFS
+	NetworkFSProtocolNFS NetworkFSProtocol = "NFS"
+
+	// ConditionTypeReady indicates the networkFS endpoint is exported and ready to be mounted
+	ConditionTypeReady ConditionType = "Ready"
+	// ConditionTypeProgressing indicates the networkFS is on its way to the desired state
+	ConditionTypeProgressing ConditionType = "Progressing"
+	// ConditionTypeDegraded indicates the networkFS did not reach the desired state before the deadline
+	ConditionTypeDegraded ConditionType = "Degraded"
+	// ConditionTypeReachable indicates the NFS data path of the enabled networkFS endpoint answers the probe
+	ConditionTypeReachable ConditionType = "Reachable"
+	// ConditionTypeEndpointChanged indicates the networkFS endpoint changed recently, it turns false after a while
+	ConditionTypeEndpointChanged ConditionType = "EndpointChanged"
+	// ConditionTypeBlocked indicates the disable request waits for the consumers of the volume to go away
+	ConditionTypeBlocked ConditionType = "Blocked"
+	// ConditionTypeOrphaned indicates the Longhorn volume of the networkFS is gone
+	ConditionTypeOrphaned ConditionType = "Orphaned"
+
+	// ConsumerKindPod indicates the consumer is a pod mounting the volume claim
+	ConsumerKindPod = "Pod"
+	// ConsumerKindAttachmentTicket indicates the consumer is a CSI attachment ticket written by another attacher
+	ConsumerKindAttachmentTicket = "AttachmentTicket"
+
+	// DesiredStateReasonSpec indicates the effective desired state is spec.desiredState
+	DesiredStateReasonSpec = "Spec"
+	// DesiredStateReasonConsumers indicates the networkFS endpoint is enabled for the registered consumers
+	DesiredStateReasonConsumers = "EnabledForConsumers"
+	// DesiredStateReasonGracePeriod indicates the networkFS endpoint is kept enabled after the last consumer is unregistered
+	DesiredStateReasonGracePeriod = "EnabledForGracePeriod"
+	// DesiredStateReasonScheduleOpen indicates the networkFS endpoint is enabled in a window of the schedule
+	DesiredStateReasonScheduleOpen = "EnabledBySchedule"
+	// DesiredStateReasonScheduleClosed indicates the networkFS endpoint is disabled out of the windows of the schedule
+	DesiredStateReasonScheduleClosed = "DisabledBySchedule"
+	// DesiredStateReasonLeaseExpired indicates the networkFS endpoint is disabled since its lease is not renewed in time
+	DesiredStateReasonLeaseExpired = "DisabledLeaseExpired"
+	// DesiredStateReasonIdle indicates the networkFS endpoint is disabled since no client was connected for the idle timeout
+	DesiredStateReasonIdle = "DisabledIdle"
+
+	// PlacementReasonPreferred indicates the networkFS endpoint is requested on the most preferred eligible node
+	PlacementReasonPreferred = "Preferred"
+	// PlacementReasonFallback indicates the networkFS endpoint is requested on a less preferred node, since the more
+	// preferred ones are not ready or cordoned
+	PlacementReasonFallback = "Fallback"
+	// PlacementReasonWaitingForFailback indicates the networkFS endpoint stays on its current node until the more
+	// preferred node has been available for the failback delay
+	PlacementReasonWaitingForFailback = "WaitingForFailback"
+	// PlacementReasonNoEligibleNode indicates no eligible node is available, Longhorn picks the node of the networkFS endpoint
+	PlacementReasonNoEligibleNode = "NoEligibleNode"
+
+	// AnnotationForceDelete releases the deleting networkFS without waiting for the ShareManager to stop
+	AnnotationForceDelete = "networkfs.harvesterhci.io/force-delete"
+	// AnnotationDiscovery opts the PVC (or the PVCs of the StorageClass) in ("true") or out ("false") of the networkFS discovery
+	AnnotationDiscovery = "networkfs.harvesterhci.io/discovery"
+	// AnnotationDiscoveredFrom is the back reference from the discovered networkFS to the PVC, in the namespace/name format
+	AnnotationDiscoveredFrom = "networkfs.harvesterhci.io/discovered-from"
+	// AnnotationVMMounts on the KubeVirt VirtualMachine lists the networkFS to mount in the VM, in the
+	// [<namespace>/]<name>:<mount point>[,...] format, the networkFS is in the namespace of the VM unless it is set,
+	// e.g. the networkFS discovered in the namespace of the manager
+	AnnotationVMMounts = "networkfs.harvesterhci.io/mounts"
+	// AnnotationVMMountsSecret on the KubeVirt VirtualMachine records the cloud-init Secret the mounts are rendered into
+	AnnotationVMMountsSecret = "networkfs.harvesterhci.io/mounts-secret"
+	// AnnotationConversion keeps the spec fields the other API version cannot represent, so the conversion round-trips
+	AnnotationConversion = "networkfs.harvesterhci.io/conversion"
+	// AnnotationLastActivity records the last time a client was seen connected to the networkFS endpoint, in the
+	// RFC 3339 format. It is written by the manager on the node of the share-manager pod.
+	AnnotationLastActivity = "networkfs.harvesterhci.io/last-activity"
+	// AttachmentParameterNetworkFS marks the Longhorn attachment ticket written by the networkFS with its namespace/name,
+	// the ticket has the CSI attacher type for Longhorn to bring up the share-manager, the parameter tells it apart from
+	// the tickets of the CSI attacher
+	AttachmentParameterNetworkFS = "networkfs.harvesterhci.io/networkfilesystem"
+	// LabelDiscovered marks the networkFS created by the discovery
+	LabelDiscovered = "networkfs.harvesterhci.io/discovered"
+	// LabelNetworkFS marks the objects owned by the networkFS with its name, e.g. the Service exposing the endpoint
+	LabelNetworkFS = "networkfs.harvesterhci.io/networkfilesystem"
+	// LabelNetworkFSNamespace marks the objects owned by the networkFS in the Longhorn namespace with its namespace
+	LabelNetworkFSNamespace = "networkfs.harvesterhci.io/networkfilesystem-namespace"
+)
+
+var (
+	// DefaultNFSVersions are the NFS versions served by the Longhorn share-manager
+	DefaultNFSVersions = []string{"4.1", "4.2"}
+)
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:shortName=netfilesystem;netfilesystems,scope=Namespaced
+// +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Volume",type="string",JSONPath=`.status.volume`
+// +kubebuilder:printcolumn:name="DesiredState",type="string",JSONPath=`.spec.desiredState`
+// +kubebuilder:printcolumn:name="State",type="string",JSONPath=`.status.state`
+// +kubebuilder:printcolumn:name="Protocol",type="string",JSONPath=`.spec.protocol`
+// +kubebuilder:printcolumn:name="MountSource",type="string",JSONPath=`.status.export.mountSource`
+// +kubebuilder:printcolumn:name="LeaseRemaining",type="string",JSONPath=`.status.lease.remaining`,priority=1
+// +kubebuilder:printcolumn:name="Node",type="string",JSONPath=`.status.placement.node`,priority=1
+// +kubebuilder:subresource:status
+
+type NetworkFilesystem struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              NetworkFSSpec   `json:"spec"`
+	Status            NetworkFSStatus `json:"status,omitempty"`
+}
+
+type NetworkFSSpec struct {
+	// the volume to which the endpoint is exported, either a PVC or a Longhorn volume
+	// +kubebuilder:validation:Required
+	VolumeRef NetworkFSVolumeRef `json:"volumeRef"`
+
+	// desired state of the networkFS endpoint, options are "Disabled" or "Enabled"
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum:=Disabled;Enabled
+	DesiredState NetworkFSState `json:"desiredState"`
+
+	// the nodes to which the networkFS endpoint is preferably exported, in the order of preference. The endpoint falls
+	// back to the next eligible node while a node is not ready or cordoned, and moves back once it stays ready and
+	// uncordoned for the failback delay of the manager.
+	// +kubebuilder:validation:Optional
+	PreferredNodes []string `json:"preferredNodes,omitempty"`
+
+	// the nodes eligible for the networkFS endpoint after the preferred nodes, in the order of their names.
+	// Longhorn picks the node if no eligible node is available.
+	// +kubebuilder:validation:Optional
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector,omitempty"`
+
+	// the protocol the networkFS endpoint is exported over
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum:=NFS
+	// +kubebuilder:default:=NFS
+	Protocol NetworkFSProtocol `json:"protocol,omitempty"`
+
+	// expose the networkFS endpoint through a Service, so the address survives the share-manager rescheduling
+	// +kubebuilder:validation:Optional
+	Expose *NetworkFSExpose `json:"expose,omitempty"`
+
+	// the connection info published in the binding Secret of the networkFS, see https://servicebinding.io
+	// +kubebuilder:validation:Optional
+	Binding *NetworkFSBinding `json:"binding,omitempty"`
+
+	// the clients allowed to access the networkFS endpoint, all clients are allowed if it is not set
+	// +kubebuilder:validation:Optional
+	AccessPolicy *NetworkFSAccessPolicy `json:"accessPolicy,omitempty"`
+
+	// the registered consumers of the networkFS endpoint, e.g. the VMs, the guest clusters or the tools mounting it.
+	// The endpoint is enabled while any consumer is registered, even if the desired state is "Disabled", and it is
+	// disabled again once the last consumer has been unregistered for the grace period.
+	// +kubebuilder:validation:Optional
+	Consumers []NetworkFSConsumer `json:"consumers,omitempty"`
+
+	// the period the networkFS endpoint is kept enabled after the last consumer is unregistered.
+	// The global default of the manager is used if it is not set.
+	// +kubebuilder:validation:Optional
+	ConsumerGracePeriod *metav1.Duration `json:"consumerGracePeriod,omitempty"`
+
+	// the lease of the networkFS endpoint, it is disabled once the lease is not renewed in time
+	// +kubebuilder:validation:Optional
+	Lease *NetworkFSLease `json:"lease,omitempty"`
+
+	// the windows the networkFS endpoint is enabled in, it is disabled out of them. The schedule overrides the
+	// desired state while it is set, the consumers and the lease still apply on top of it.
+	// +kubebuilder:validation:Optional
+	Schedule *NetworkFSSchedule `json:"schedule,omitempty"`
+
+	// disable the networkFS endpoint once no client has been connected to it for the period. The clients are the
+	// established NFS connections seen on the node of the share-manager pod, it is not less than 10m.
+	// +kubebuilder:validation:Optional
+	IdleTimeout *metav1.Duration `json:"idleTimeout,omitempty"`
+
+	// disable the networkFS endpoint even if the volume is still used in the cluster
+	// +kubebuilder:validation:Optional
+	Force bool `json:"force,omitempty"`
+
+	// deadline of the enable/disable transition before the networkFS is marked as Failed, 0 means no deadline.
+	// The global default of the manager is used if it is not set.
+	// +kubebuilder:validation:Optional
+	TransitionTimeout *metav1.Duration `json:"transitionTimeout,omitempty"`
+}
+
+type NetworkFSStatus struct {
+	// the generation of the spec the status was computed from
+	// +kubebuilder:validation:Optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// the conditions of the networkFS
+	// +kubebuilder:validation:Optional
+	NetworkFSConds []NetworkFSCondition `json:"conditions,omitempty"`
+
+	// the current state of the networkFS endpoint, options are "Enabled", "Enabling", "Disabling", "Disabled", "Failed", or "Unknown"
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum:=Enabled;Enabling;Disabling;Disabled;Failed;Unknown
+	State NetworkFSState `json:"state,omitempty"`
+
+	// the effective desired state of the networkFS endpoint, spec.desiredState unless the consumers keep it enabled
+	// +kubebuilder:validation:Optional
+	DesiredState NetworkFSState `json:"desiredState,omitempty"`
+
+	// the reason of the effective desired state, options are "Spec", "EnabledForConsumers", "EnabledForGracePeriod",
+	// "EnabledBySchedule", "DisabledBySchedule", "DisabledLeaseExpired" or "DisabledIdle"
+	// +kubebuilder:validation:Optional
+	DesiredStateReason string `json:"desiredStateReason,omitempty"`
+
+	// the time the networkFS endpoint is disabled, set once the last consumer is unregistered
+	// +kubebuilder:validation:Optional
+	AutoDisableTime *metav1.Time `json:"autoDisableTime,omitempty"`
+
+	// the lease of the networkFS endpoint, it is set while the lease is requested
+	// +kubebuilder:validation:Optional
+	Lease *NetworkFSLeaseStatus `json:"lease,omitempty"`
+
+	// the schedule of the networkFS endpoint, it is set while the schedule is requested
+	// +kubebuilder:validation:Optional
+	Schedule *NetworkFSScheduleStatus `json:"schedule,omitempty"`
+
+	// the client activity of the networkFS endpoint, it is set while the idle timeout is requested
+	// +kubebuilder:validation:Optional
+	Idle *NetworkFSIdleStatus `json:"idle,omitempty"`
+
+	// the node the networkFS endpoint is requested on, it is set while the preferred nodes or the node selector are requested
+	// +kubebuilder:validation:Optional
+	Placement *NetworkFSPlacementStatus `json:"placement,omitempty"`
+
+	// the export of the enabled networkFS endpoint
+	// +kubebuilder:validation:Optional
+	Export *NetworkFSExport `json:"export,omitempty"`
+
+	// the ongoing enable/disable transition, it is cleared once the desired state is reached
+	// +kubebuilder:validation:Optional
+	Transition *NetworkFSTransition `json:"transition,omitempty"`
+
+	// the binding Secret holding the connection info of the networkFS endpoint, only the type and the provider are
+	// kept while it is not exported, see https://servicebinding.io
+	// +kubebuilder:validation:Optional
+	Binding *corev1.LocalObjectReference `json:"binding,omitempty"`
+
+	// the access policy enforced on the networkFS endpoint, it is set while the access policy is requested
+	// +kubebuilder:validation:Optional
+	AccessPolicy *NetworkFSAccessPolicyStatus `json:"accessPolicy,omitempty"`
+
+	// the Service exposing the networkFS endpoint, it is set while the expose is requested
+	// +kubebuilder:validation:Optional
+	Expose *NetworkFSExposeStatus `json:"expose,omitempty"`
+
+	// the persistent volume resolved from the volume reference
+	// +kubebuilder:validation:Optional
+	PersistentVolume string `json:"persistentVolume,omitempty"`
+
+	// the Longhorn volume resolved from the volume reference
+	// +kubebuilder:validation:Optional
+	Volume string `json:"volume,omitempty"`
+
+	// the consumers of the volume: the in-cluster ones block the disable request unless it is forced,
+	// the registered ones of spec.consumers keep the networkFS endpoint enabled
+	// +kubebuilder:validation:Optional
+	Consumers []NetworkFSConsumer `json:"consumers,omitempty"`
+}
+
+type NetworkFSTransition struct {
+	// the state the transition heads to, options are "Enabled" or "Disabled"
+	DesiredState NetworkFSState `json:"desiredState"`
+
+	// the time the transition started, the deadline counts from it
+	StartTime metav1.Time `json:"startTime"`
+}
+
+type NetworkFSVolumeRef struct {
+	// the PVC bound to the Longhorn RWX volume
+	// +kubebuilder:validation:Optional
+	PersistentVolumeClaim *NetworkFSClaimRef `json:"persistentVolumeClaim,omitempty"`
+
+	// the name of the Longhorn RWX volume, e.g. the volume created from the Longhorn UI
+	// +kubebuilder:validation:Optional
+	VolumeName string `json:"volumeName,omitempty"`
+}
+
+type NetworkFSClaimRef struct {
+	// the namespace of the PVC
+	// +kubebuilder:validation:Required
+	Namespace string `json:"namespace"`
+
+	// the name of the PVC
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+}
+
+type NetworkFSExpose struct {
+	// the type of the Service, options are "ClusterIP", "NodePort" or "LoadBalancer". The export is served at the
+	// cluster IP, at the node port of the internal addresses of the ready and uncordoned nodes, or at the load
+	// balancer address respectively.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum:=ClusterIP;NodePort;LoadBalancer
+	Type corev1.ServiceType `json:"type"`
+
+	// the fixed IP of the Service, the cluster IP for "ClusterIP" and "NodePort", the load balancer IP for "LoadBalancer".
+	// One is allocated if it is not set.
+	// +kubebuilder:validation:Optional
+	IP string `json:"ip,omitempty"`
+}
+
+type NetworkFSBinding struct {
+	// the mount point of the fstab line and the systemd mount unit, "/mnt/<name>" if it is not set
+	// +kubebuilder:validation:Optional
+	MountPoint string `json:"mountPoint,omitempty"`
+
+	// publish the connection info in a ConfigMap as well, for the consumers not allowed to read the Secrets
+	// +kubebuilder:validation:Optional
+	ConfigMap bool `json:"configMap,omitempty"`
+}
+
+type NetworkFSLease struct {
+	// the period the lease is valid for after it is renewed
+	// +kubebuilder:validation:Required
+	Duration metav1.Duration `json:"duration"`
+
+	// the time the lease was renewed, the consumers renew the lease by updating it.
+	// The lease counts from the creation of the networkFS if it is not set.
+	// +kubebuilder:validation:Optional
+	RenewTime *metav1.Time `json:"renewTime,omitempty"`
+}
+
+type NetworkFSLeaseStatus struct {
+	// the time the lease expires unless it is renewed
+	ExpireTime metav1.Time `json:"expireTime"`
+
+	// the time remaining before the lease expires, rounded up to the minute, 0 once it is expired
+	Remaining metav1.Duration `json:"remaining"`
+}
+
+type NetworkFSSchedule struct {
+	// the windows the networkFS endpoint is enabled in, the overlapping windows are merged
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems:=1
+	Windows []NetworkFSScheduleWindow `json:"windows"`
+
+	// the IANA time zone the windows are evaluated in, e.g. "Europe/Berlin", UTC if it is not set
+	// +kubebuilder:validation:Optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+type NetworkFSScheduleWindow struct {
+	// the cron expression of the window opening, in the standard 5-field format, e.g. "0 22 * * *"
+	// +kubebuilder:validation:Required
+	Start string `json:"start"`
+
+	// the period the window stays open for
+	// +kubebuilder:validation:Required
+	Duration metav1.Duration `json:"duration"`
+}
+
+type NetworkFSScheduleStatus struct {
+	// a window of the schedule is open
+	Open bool `json:"open"`
+
+	// the time the open windows close or the next window opens, unset if no window opens anymore
+	NextTransitionTime *metav1.Time `json:"nextTransitionTime,omitempty"`
+
+	// the schedule cannot be parsed, the desired state is not overridden
+	Error string `json:"error,omitempty"`
+}
+
+type NetworkFSIdleStatus struct {
+	// the last time a client was seen connected to the networkFS endpoint
+	LastActivityTime *metav1.Time `json:"lastActivityTime,omitempty"`
+
+	// the time the networkFS endpoint is disabled unless a client connects, set while it is enabled
+	DisableTime *metav1.Time `json:"disableTime,omitempty"`
+}
+
+type NetworkFSPlacementStatus struct {
+	// the node the attachment ticket requests, empty if Longhorn picks the node
+	Node string `json:"node,omitempty"`
+
+	// the reason of the placement, options are "Preferred", "Fallback", "WaitingForFailback" or "NoEligibleNode"
+	Reason string `json:"reason"`
+
+	// the more preferred node the networkFS endpoint moves back to at the failback time, unless it is unavailable again
+	FailbackNode string `json:"failbackNode,omitempty"`
+
+	// the time the failback node became available to the networkFS endpoint, the failback delay counts from it
+	FailbackNodeAvailableSince *metav1.Time `json:"failbackNodeAvailableSince,omitempty"`
+
+	// the time the networkFS endpoint moves back to the failback node
+	FailbackTime *metav1.Time `json:"failbackTime,omitempty"`
+}
+
+type NetworkFSExposeStatus struct {
+	// the name of the Service in the namespace of the networkFS
+	Service string `json:"service"`
+
+	// the type of the Service
+	Type corev1.ServiceType `json:"type"`
+
+	// the cluster IP of the Service
+	ClusterIP string `json:"clusterIP,omitempty"`
+
+	// the node port of the Service, set for "NodePort" and "LoadBalancer"
+	NodePort int32 `json:"nodePort,omitempty"`
+
+	// the ingress address of the load balancer, set for "LoadBalancer" once it is assigned
+	LoadBalancerAddress string `json:"loadBalancerAddress,omitempty"`
+}
+
+type NetworkFSAccessPolicy struct {
+	// the client CIDRs allowed to access the networkFS endpoint, all clients are allowed if it is empty.
+	// It is enforced by a NetworkPolicy on the share-manager pod, which also admits the internal addresses of the
+	// nodes so the manager can probe the export from the host network. The addresses the pod network or a
+	// "NodePort" or "LoadBalancer" Service translate the clients to must be allowed too. The allowed clients have
+	// read-write access, the share-manager has no option to export the volume read-only.
+	// +kubebuilder:validation:Optional
+	AllowedCIDRs []string `json:"allowedCIDRs,omitempty"`
+}
+
+type NetworkFSAccessPolicyStatus struct {
+	// the NetworkPolicy enforcing the allowed CIDRs, in the namespace/name format
+	NetworkPolicy string `json:"networkPolicy,omitempty"`
+
+	// the client CIDRs allowed by the NetworkPolicy, all clients are allowed if it is empty. The internal addresses of
+	// the nodes are admitted as well and are not listed.
+	AllowedCIDRs []string `json:"allowedCIDRs,omitempty"`
+}
+
+type NetworkFSConsumer struct {
+	// the kind of the consumer, "Pod" or "AttachmentTicket" for the in-cluster ones, any other kind for the
+	// registered ones, e.g. "VirtualMachine"
+	Kind string `json:"kind"`
+
+	// the namespace of the consumer, empty for the attachment ticket
+	// +kubebuilder:validation:Optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// the name of the consumer, the ID of the attachment ticket
+	Name string `json:"name"`
+
+	// the node the pod runs on or the ticket attaches to
+	// +kubebuilder:validation:Optional
+	NodeName string `json:"nodeName,omitempty"`
+}
+
+type NetworkFSExport struct {
+	// the addresses serving the export
+	Addresses []string `json:"addresses,omitempty"`
+
+	// the port serving the export
+	Port int32 `json:"port,omitempty"`
+
+	// the transport protocol of the export port
+	Protocol corev1.Protocol `json:"protocol,omitempty"`
+
+	// the exported path on the NFS server
+	ExportPath string `json:"exportPath,omitempty"`
+
+	// the supported NFS versions
+	NFSVersions []string `json:"nfsVersions,omitempty"`
+
+	// the ready-to-use mount source, e.g. "10.52.0.10:/pvc-xxx"
+	MountSource string `json:"mountSource,omitempty"`
+
+	// the recommended mount options of the export
+	MountOptions string `json:"mountOptions,omitempty"`
+}
+
+type NetworkFSCondition struct {
+	Type               ConditionType          `json:"type"`
+	Status             corev1.ConditionStatus `json:"status"`
+	LastTransitionTime metav1.Time            `json:"lastTransitionTime"`
+	Reason             string                 `json:"reason,omitempty"`
+	Message            string                 `json:"message,omitempty"`
+}
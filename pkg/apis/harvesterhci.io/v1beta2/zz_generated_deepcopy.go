@@ -0,0 +1,586 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+/*
+Copyright 2024 Rancher Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by main. DO NOT EDIT.
+
+package v1beta2
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSAccessPolicy) DeepCopyInto(out *NetworkFSAccessPolicy) {
+	*out = *in
+	if in.AllowedCIDRs != nil {
+		in, out := &in.AllowedCIDRs, &out.AllowedCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSAccessPolicy.
+func (in *NetworkFSAccessPolicy) DeepCopy() *NetworkFSAccessPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSAccessPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSAccessPolicyStatus) DeepCopyInto(out *NetworkFSAccessPolicyStatus) {
+	*out = *in
+	if in.AllowedCIDRs != nil {
+		in, out := &in.AllowedCIDRs, &out.AllowedCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSAccessPolicyStatus.
+func (in *NetworkFSAccessPolicyStatus) DeepCopy() *NetworkFSAccessPolicyStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSAccessPolicyStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSBinding) DeepCopyInto(out *NetworkFSBinding) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSBinding.
+func (in *NetworkFSBinding) DeepCopy() *NetworkFSBinding {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSBinding)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSClaimRef) DeepCopyInto(out *NetworkFSClaimRef) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSClaimRef.
+func (in *NetworkFSClaimRef) DeepCopy() *NetworkFSClaimRef {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSClaimRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSCondition) DeepCopyInto(out *NetworkFSCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSCondition.
+func (in *NetworkFSCondition) DeepCopy() *NetworkFSCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSConsumer) DeepCopyInto(out *NetworkFSConsumer) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSConsumer.
+func (in *NetworkFSConsumer) DeepCopy() *NetworkFSConsumer {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSConsumer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSExport) DeepCopyInto(out *NetworkFSExport) {
+	*out = *in
+	if in.Addresses != nil {
+		in, out := &in.Addresses, &out.Addresses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NFSVersions != nil {
+		in, out := &in.NFSVersions, &out.NFSVersions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSExport.
+func (in *NetworkFSExport) DeepCopy() *NetworkFSExport {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSExport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSExpose) DeepCopyInto(out *NetworkFSExpose) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSExpose.
+func (in *NetworkFSExpose) DeepCopy() *NetworkFSExpose {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSExpose)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSExposeStatus) DeepCopyInto(out *NetworkFSExposeStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSExposeStatus.
+func (in *NetworkFSExposeStatus) DeepCopy() *NetworkFSExposeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSExposeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSIdleStatus) DeepCopyInto(out *NetworkFSIdleStatus) {
+	*out = *in
+	if in.LastActivityTime != nil {
+		in, out := &in.LastActivityTime, &out.LastActivityTime
+		*out = (*in).DeepCopy()
+	}
+	if in.DisableTime != nil {
+		in, out := &in.DisableTime, &out.DisableTime
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSIdleStatus.
+func (in *NetworkFSIdleStatus) DeepCopy() *NetworkFSIdleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSIdleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSLease) DeepCopyInto(out *NetworkFSLease) {
+	*out = *in
+	out.Duration = in.Duration
+	if in.RenewTime != nil {
+		in, out := &in.RenewTime, &out.RenewTime
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSLease.
+func (in *NetworkFSLease) DeepCopy() *NetworkFSLease {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSLease)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSLeaseStatus) DeepCopyInto(out *NetworkFSLeaseStatus) {
+	*out = *in
+	in.ExpireTime.DeepCopyInto(&out.ExpireTime)
+	out.Remaining = in.Remaining
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSLeaseStatus.
+func (in *NetworkFSLeaseStatus) DeepCopy() *NetworkFSLeaseStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSLeaseStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSPlacementStatus) DeepCopyInto(out *NetworkFSPlacementStatus) {
+	*out = *in
+	if in.FailbackNodeAvailableSince != nil {
+		in, out := &in.FailbackNodeAvailableSince, &out.FailbackNodeAvailableSince
+		*out = (*in).DeepCopy()
+	}
+	if in.FailbackTime != nil {
+		in, out := &in.FailbackTime, &out.FailbackTime
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSPlacementStatus.
+func (in *NetworkFSPlacementStatus) DeepCopy() *NetworkFSPlacementStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSPlacementStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSSchedule) DeepCopyInto(out *NetworkFSSchedule) {
+	*out = *in
+	if in.Windows != nil {
+		in, out := &in.Windows, &out.Windows
+		*out = make([]NetworkFSScheduleWindow, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSSchedule.
+func (in *NetworkFSSchedule) DeepCopy() *NetworkFSSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSScheduleStatus) DeepCopyInto(out *NetworkFSScheduleStatus) {
+	*out = *in
+	if in.NextTransitionTime != nil {
+		in, out := &in.NextTransitionTime, &out.NextTransitionTime
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSScheduleStatus.
+func (in *NetworkFSScheduleStatus) DeepCopy() *NetworkFSScheduleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSScheduleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSScheduleWindow) DeepCopyInto(out *NetworkFSScheduleWindow) {
+	*out = *in
+	out.Duration = in.Duration
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSScheduleWindow.
+func (in *NetworkFSScheduleWindow) DeepCopy() *NetworkFSScheduleWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSScheduleWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSSpec) DeepCopyInto(out *NetworkFSSpec) {
+	*out = *in
+	in.VolumeRef.DeepCopyInto(&out.VolumeRef)
+	if in.PreferredNodes != nil {
+		in, out := &in.PreferredNodes, &out.PreferredNodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Expose != nil {
+		in, out := &in.Expose, &out.Expose
+		*out = new(NetworkFSExpose)
+		**out = **in
+	}
+	if in.Binding != nil {
+		in, out := &in.Binding, &out.Binding
+		*out = new(NetworkFSBinding)
+		**out = **in
+	}
+	if in.AccessPolicy != nil {
+		in, out := &in.AccessPolicy, &out.AccessPolicy
+		*out = new(NetworkFSAccessPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Consumers != nil {
+		in, out := &in.Consumers, &out.Consumers
+		*out = make([]NetworkFSConsumer, len(*in))
+		copy(*out, *in)
+	}
+	if in.ConsumerGracePeriod != nil {
+		in, out := &in.ConsumerGracePeriod, &out.ConsumerGracePeriod
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Lease != nil {
+		in, out := &in.Lease, &out.Lease
+		*out = new(NetworkFSLease)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Schedule != nil {
+		in, out := &in.Schedule, &out.Schedule
+		*out = new(NetworkFSSchedule)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IdleTimeout != nil {
+		in, out := &in.IdleTimeout, &out.IdleTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.TransitionTimeout != nil {
+		in, out := &in.TransitionTimeout, &out.TransitionTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSSpec.
+func (in *NetworkFSSpec) DeepCopy() *NetworkFSSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSStatus) DeepCopyInto(out *NetworkFSStatus) {
+	*out = *in
+	if in.NetworkFSConds != nil {
+		in, out := &in.NetworkFSConds, &out.NetworkFSConds
+		*out = make([]NetworkFSCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AutoDisableTime != nil {
+		in, out := &in.AutoDisableTime, &out.AutoDisableTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Lease != nil {
+		in, out := &in.Lease, &out.Lease
+		*out = new(NetworkFSLeaseStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Schedule != nil {
+		in, out := &in.Schedule, &out.Schedule
+		*out = new(NetworkFSScheduleStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Idle != nil {
+		in, out := &in.Idle, &out.Idle
+		*out = new(NetworkFSIdleStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Placement != nil {
+		in, out := &in.Placement, &out.Placement
+		*out = new(NetworkFSPlacementStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Export != nil {
+		in, out := &in.Export, &out.Export
+		*out = new(NetworkFSExport)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Transition != nil {
+		in, out := &in.Transition, &out.Transition
+		*out = new(NetworkFSTransition)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Binding != nil {
+		in, out := &in.Binding, &out.Binding
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	if in.AccessPolicy != nil {
+		in, out := &in.AccessPolicy, &out.AccessPolicy
+		*out = new(NetworkFSAccessPolicyStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Expose != nil {
+		in, out := &in.Expose, &out.Expose
+		*out = new(NetworkFSExposeStatus)
+		**out = **in
+	}
+	if in.Consumers != nil {
+		in, out := &in.Consumers, &out.Consumers
+		*out = make([]NetworkFSConsumer, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSStatus.
+func (in *NetworkFSStatus) DeepCopy() *NetworkFSStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSTransition) DeepCopyInto(out *NetworkFSTransition) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSTransition.
+func (in *NetworkFSTransition) DeepCopy() *NetworkFSTransition {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSTransition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFSVolumeRef) DeepCopyInto(out *NetworkFSVolumeRef) {
+	*out = *in
+	if in.PersistentVolumeClaim != nil {
+		in, out := &in.PersistentVolumeClaim, &out.PersistentVolumeClaim
+		*out = new(NetworkFSClaimRef)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFSVolumeRef.
+func (in *NetworkFSVolumeRef) DeepCopy() *NetworkFSVolumeRef {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFSVolumeRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFilesystem) DeepCopyInto(out *NetworkFilesystem) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFilesystem.
+func (in *NetworkFilesystem) DeepCopy() *NetworkFilesystem {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFilesystem)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NetworkFilesystem) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkFilesystemList) DeepCopyInto(out *NetworkFilesystemList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NetworkFilesystem, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkFilesystemList.
+func (in *NetworkFilesystemList) DeepCopy() *NetworkFilesystemList {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkFilesystemList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NetworkFilesystemList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/rancher/wrangler/v3/pkg/controller-gen/args"
 
 	netfsv1 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta1"
+	netfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
 )
 
 func main() {
@@ -19,13 +20,17 @@ func main() {
 			"harvesterhci.io": {
 				Types: []interface{}{
 					netfsv1.NetworkFilesystem{},
+					netfsv2.NetworkFilesystem{},
 				},
 				GenerateTypes:   true,
 				GenerateClients: true,
 			},
 			longhornv1.SchemeGroupVersion.Group: {
 				Types: []interface{}{
+					longhornv1.Node{},
 					longhornv1.ShareManager{},
+					longhornv1.Volume{},
+					longhornv1.VolumeAttachment{},
 				},
 				GenerateTypes:   false,
 				GenerateClients: true,
@@ -0,0 +1,364 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	ctlv1 "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+	ctlstoragev1 "github.com/rancher/wrangler/v3/pkg/generated/controllers/storage/v1"
+	"github.com/rancher/wrangler/v3/pkg/relatedresource"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/controller/networkfilesystem"
+	ctlntefsv2 "github.com/harvester/networkfs-manager/pkg/generated/controllers/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/metrics"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+const (
+	discoveryHandlerName        = "harvester-network-filesystem-discovery"
+	discoveryRelatedHandlerName = "harvester-network-filesystem-discovery-related"
+	discoveryGCHandlerName      = "harvester-network-filesystem-discovery-gc"
+
+	pvByStorageClassIndex = "networkfs.harvesterhci.io/pv-by-storageclass"
+
+	// the Harvester VM images and disks are migratable RWX block volumes, they are not exported over NFS
+	migratableAttribute = "migratable"
+
+	eventReasonDiscovered       = "Discovered"
+	eventReasonGarbageCollected = "GarbageCollected"
+	eventReasonUndiscovered     = "Undiscovered"
+)
+
+// Controller creates a NetworkFilesystem for each Longhorn RWX volume, depending on the discovery annotations
+type Controller struct {
+	namespace         string
+	autoDiscovery     bool
+	gcOrphaned        bool
+	PVCache           ctlv1.PersistentVolumeCache
+	PVCCache          ctlv1.PersistentVolumeClaimCache
+	StorageClassCache ctlstoragev1.StorageClassCache
+	NetworkFSCache    ctlntefsv2.NetworkFilesystemCache
+	NetworkFilsystems ctlntefsv2.NetworkFilesystemController
+
+	recorder record.EventRecorder
+}
+
+// Register register the discovery controller, it relies on the indexers added by the network filesystem controller
+func Register(ctx context.Context, coreClient ctlv1.Interface, storageClient ctlstoragev1.Interface, netfilesystems ctlntefsv2.NetworkFilesystemController, recorder record.EventRecorder, opt *utils.Option) error {
+	pvs := coreClient.PersistentVolume()
+	pvcs := coreClient.PersistentVolumeClaim()
+	storageClasses := storageClient.StorageClass()
+	c := &Controller{
+		namespace:         opt.Namespace,
+		autoDiscovery:     opt.AutoDiscovery,
+		gcOrphaned:        opt.GCOrphaned,
+		PVCache:           pvs.Cache(),
+		PVCCache:          pvcs.Cache(),
+		StorageClassCache: storageClasses.Cache(),
+		NetworkFSCache:    netfilesystems.Cache(),
+		NetworkFilsystems: netfilesystems,
+		recorder:          recorder,
+	}
+
+	c.PVCache.AddIndexer(pvByStorageClassIndex, indexPVByStorageClass)
+
+	pvs.OnChange(ctx, discoveryHandlerName, metrics.Instrument(discoveryHandlerName, c.OnPVChange))
+	netfilesystems.OnChange(ctx, discoveryGCHandlerName, metrics.Instrument(discoveryGCHandlerName, c.OnNetworkFSChange))
+
+	relatedresource.WatchClusterScoped(ctx, discoveryRelatedHandlerName, c.resolvePVC, pvs, pvcs)
+	relatedresource.WatchClusterScoped(ctx, discoveryRelatedHandlerName, c.resolveStorageClass, pvs, storageClasses)
+	return nil
+}
+
+func indexPVByStorageClass(pv *corev1.PersistentVolume) ([]string, error) {
+	if pv.Spec.StorageClassName == "" {
+		return nil, nil
+	}
+	return []string{pv.Spec.StorageClassName}, nil
+}
+
+// resolvePVC maps the PVC to the PV it is bound to
+func (c *Controller) resolvePVC(_, _ string, obj runtime.Object) ([]relatedresource.Key, error) {
+	pvc, ok := obj.(*corev1.PersistentVolumeClaim)
+	if !ok || pvc.Spec.VolumeName == "" {
+		return nil, nil
+	}
+	return []relatedresource.Key{relatedresource.NewKey("", pvc.Spec.VolumeName)}, nil
+}
+
+// resolveStorageClass maps the StorageClass to the PVs provisioned from it
+func (c *Controller) resolveStorageClass(_, name string, _ runtime.Object) ([]relatedresource.Key, error) {
+	pvs, err := c.PVCache.GetByIndex(pvByStorageClassIndex, name)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]relatedresource.Key, 0, len(pvs))
+	for _, pv := range pvs {
+		keys = append(keys, relatedresource.NewKey("", pv.Name))
+	}
+	return keys, nil
+}
+
+// OnPVChange creates the NetworkFilesystem of the discovered Longhorn RWX volume, and deletes (or releases, once it
+// is enabled) the discovered one when the volume opts out of the discovery
+func (c *Controller) OnPVChange(_ string, pv *corev1.PersistentVolume) (*corev1.PersistentVolume, error) {
+	if pv == nil || pv.DeletionTimestamp != nil {
+		return nil, nil
+	}
+	if !isLonghornRWXVolume(pv) {
+		return pv, nil
+	}
+
+	pvc, err := c.getClaim(pv)
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := c.discoveryEnabled(pv, pvc)
+	if err != nil {
+		return nil, err
+	}
+
+	volumeName := pv.Spec.CSI.VolumeHandle
+	if networkFS, err := c.NetworkFSCache.Get(c.namespace, pv.Name); err == nil {
+		if !isDiscovered(networkFS) || networkFS.Spec.VolumeRef.VolumeName != volumeName {
+			return pv, nil
+		}
+		if enabled {
+			return pv, c.adoptDiscovered(pv, networkFS)
+		}
+		return pv, c.releaseDiscovered(networkFS)
+	} else if !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if !enabled {
+		return pv, nil
+	}
+	// the volume may be exported by a network filesystem under another name
+	existing, err := c.NetworkFSCache.GetByIndex(networkfilesystem.NetworkFSByVolumeIndex, volumeName)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 0 {
+		return pv, nil
+	}
+
+	networkFS := &networkfsv2.NetworkFilesystem{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pv.Name,
+			Namespace: c.namespace,
+			Labels: map[string]string{
+				networkfsv2.LabelDiscovered: "true",
+			},
+		},
+		Spec: networkfsv2.NetworkFSSpec{
+			VolumeRef: networkfsv2.NetworkFSVolumeRef{
+				VolumeName: volumeName,
+			},
+			DesiredState: networkfsv2.NetworkFSStateDisabled,
+			Protocol:     networkfsv2.NetworkFSProtocolNFS,
+		},
+	}
+	if c.gcOrphaned {
+		networkFS.OwnerReferences = []metav1.OwnerReference{pvOwnerReference(pv)}
+	}
+	if pvc != nil {
+		networkFS.Annotations = map[string]string{
+			networkfsv2.AnnotationDiscoveredFrom: fmt.Sprintf("%s/%s", pvc.Namespace, pvc.Name),
+		}
+	}
+
+	logrus.Infof("Create network filesystem %s/%s for the discovered Longhorn RWX volume", c.namespace, pv.Name)
+	created, err := c.NetworkFilsystems.Create(networkFS)
+	if err != nil {
+		if errors.IsAlreadyExists(err) {
+			return pv, nil
+		}
+		return nil, err
+	}
+	c.recorder.Eventf(created, corev1.EventTypeNormal, eventReasonDiscovered, "Discovered Longhorn RWX volume %s of persistent volume %s", volumeName, pv.Name)
+	if pvc != nil {
+		c.recorder.Eventf(pvc, corev1.EventTypeNormal, eventReasonDiscovered, "Network filesystem %s/%s is created for the volume", created.Namespace, created.Name)
+	}
+	return pv, nil
+}
+
+// adoptDiscovered adds the PV owner reference to the discovered NetworkFilesystem created without it, so the garbage
+// collector deletes it with the PV
+func (c *Controller) adoptDiscovered(pv *corev1.PersistentVolume, networkFS *networkfsv2.NetworkFilesystem) error {
+	if !c.gcOrphaned || hasOwnerReference(networkFS, pv.UID) {
+		return nil
+	}
+	networkFSCpy := networkFS.DeepCopy()
+	networkFSCpy.OwnerReferences = append(networkFSCpy.OwnerReferences, pvOwnerReference(pv))
+	_, err := c.NetworkFilsystems.Update(networkFSCpy)
+	return err
+}
+
+// releaseDiscovered deletes the disabled discovered NetworkFilesystem of the volume opted out of the discovery. The
+// enabled one may be mounted, it is kept and released from the discovery: it loses the discovered label and the PV
+// owner reference, and is managed by the user from now on.
+func (c *Controller) releaseDiscovered(networkFS *networkfsv2.NetworkFilesystem) error {
+	if networkFS.DeletionTimestamp != nil {
+		return nil
+	}
+	if networkFS.Spec.DesiredState != networkfsv2.NetworkFSStateEnabled {
+		logrus.Infof("Delete network filesystem %s/%s of the volume opted out of the discovery", networkFS.Namespace, networkFS.Name)
+		if err := c.NetworkFilsystems.Delete(networkFS.Namespace, networkFS.Name, &metav1.DeleteOptions{}); err != nil {
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		c.recorder.Event(networkFS, corev1.EventTypeNormal, eventReasonUndiscovered, "Deleted the network filesystem, the volume opted out of the discovery")
+		return nil
+	}
+
+	logrus.Infof("Release enabled network filesystem %s/%s of the volume opted out of the discovery", networkFS.Namespace, networkFS.Name)
+	networkFSCpy := networkFS.DeepCopy()
+	delete(networkFSCpy.Labels, networkfsv2.LabelDiscovered)
+	ownerReferences := networkFSCpy.OwnerReferences[:0]
+	for _, ref := range networkFSCpy.OwnerReferences {
+		if ref.APIVersion == "v1" && ref.Kind == "PersistentVolume" {
+			continue
+		}
+		ownerReferences = append(ownerReferences, ref)
+	}
+	networkFSCpy.OwnerReferences = ownerReferences
+	if _, err := c.NetworkFilsystems.Update(networkFSCpy); err != nil {
+		return err
+	}
+	c.recorder.Event(networkFS, corev1.EventTypeNormal, eventReasonUndiscovered, "Released the enabled network filesystem from the discovery, the volume opted out of it")
+	return nil
+}
+
+// OnNetworkFSChange deletes the discovered NetworkFilesystem once its volume is gone, if the garbage collection is enabled
+func (c *Controller) OnNetworkFSChange(_ string, networkFS *networkfsv2.NetworkFilesystem) (*networkfsv2.NetworkFilesystem, error) {
+	if !c.gcOrphaned || networkFS == nil || networkFS.DeletionTimestamp != nil {
+		return networkFS, nil
+	}
+	if !isDiscovered(networkFS) {
+		return networkFS, nil
+	}
+	if !isOrphaned(networkFS) {
+		return networkFS, nil
+	}
+
+	logrus.Infof("Delete orphaned network filesystem %s/%s", networkFS.Namespace, networkFS.Name)
+	if err := c.NetworkFilsystems.Delete(networkFS.Namespace, networkFS.Name, &metav1.DeleteOptions{}); err != nil {
+		if errors.IsNotFound(err) {
+			return networkFS, nil
+		}
+		return nil, err
+	}
+	c.recorder.Event(networkFS, corev1.EventTypeNormal, eventReasonGarbageCollected, "Deleted the network filesystem of the removed volume")
+	return networkFS, nil
+}
+
+func (c *Controller) getClaim(pv *corev1.PersistentVolume) (*corev1.PersistentVolumeClaim, error) {
+	if pv.Spec.ClaimRef == nil {
+		return nil, nil
+	}
+	pvc, err := c.PVCCache.Get(pv.Spec.ClaimRef.Namespace, pv.Spec.ClaimRef.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if pvc.Spec.VolumeName != pv.Name {
+		return nil, nil
+	}
+	return pvc, nil
+}
+
+// discoveryEnabled resolves the discovery annotation, the PVC overrides the StorageClass which overrides the default
+func (c *Controller) discoveryEnabled(pv *corev1.PersistentVolume, pvc *corev1.PersistentVolumeClaim) (bool, error) {
+	if pvc != nil {
+		if enabled, ok := parseDiscoveryAnnotation(pvc.Annotations); ok {
+			return enabled, nil
+		}
+	}
+
+	if pv.Spec.StorageClassName != "" {
+		sc, err := c.StorageClassCache.Get(pv.Spec.StorageClassName)
+		if err != nil && !errors.IsNotFound(err) {
+			return false, err
+		}
+		if err == nil {
+			if enabled, ok := parseDiscoveryAnnotation(sc.Annotations); ok {
+				return enabled, nil
+			}
+		}
+	}
+	return c.autoDiscovery, nil
+}
+
+func parseDiscoveryAnnotation(annotations map[string]string) (bool, bool) {
+	value, ok := annotations[networkfsv2.AnnotationDiscovery]
+	if !ok {
+		return false, false
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		logrus.Warnf("Ignore invalid annotation %s=%s", networkfsv2.AnnotationDiscovery, value)
+		return false, false
+	}
+	return enabled, true
+}
+
+// isLonghornRWXVolume checks the PV is a Longhorn RWX filesystem volume which could be exported over NFS
+func isLonghornRWXVolume(pv *corev1.PersistentVolume) bool {
+	csi := pv.Spec.CSI
+	if csi == nil || csi.Driver != utils.LHCSIDriverName {
+		return false
+	}
+	if pv.Spec.VolumeMode != nil && *pv.Spec.VolumeMode == corev1.PersistentVolumeBlock {
+		return false
+	}
+	if migratable, _ := strconv.ParseBool(csi.VolumeAttributes[migratableAttribute]); migratable {
+		return false
+	}
+	for _, mode := range pv.Spec.AccessModes {
+		if mode == corev1.ReadWriteMany {
+			return true
+		}
+	}
+	return false
+}
+
+func isOrphaned(networkFS *networkfsv2.NetworkFilesystem) bool {
+	return utils.IsNetworkFSConditionTrue(networkFS.Status.NetworkFSConds, networkfsv2.ConditionTypeOrphaned)
+}
+
+func isDiscovered(networkFS *networkfsv2.NetworkFilesystem) bool {
+	return networkFS.Labels[networkfsv2.LabelDiscovered] == "true"
+}
+
+// pvOwnerReference is the owner reference of the discovered NetworkFilesystem to its PV, the namespaced object may be
+// owned by the cluster-scoped one
+func pvOwnerReference(pv *corev1.PersistentVolume) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "PersistentVolume",
+		Name:       pv.Name,
+		UID:        pv.UID,
+	}
+}
+
+func hasOwnerReference(networkFS *networkfsv2.NetworkFilesystem, uid types.UID) bool {
+	for _, ref := range networkFS.OwnerReferences {
+		if ref.UID == uid {
+			return true
+		}
+	}
+	return false
+}
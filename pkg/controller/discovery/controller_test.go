@@ -0,0 +1,322 @@
+package discovery
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rancher/wrangler/v3/pkg/generic"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	ctlntefsv2 "github.com/harvester/networkfs-manager/pkg/generated/controllers/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+const (
+	testNamespace = "harvester-system"
+	testPV        = "pvc-1"
+	testVolume    = "pvc-1"
+)
+
+// fakeCache returns the objects from the slice, index maps the object to the keys of the only indexer of the cache
+type fakeCache[T generic.RuntimeMetaObject] struct {
+	generic.CacheInterface[T]
+	objects []T
+	index   func(T) []string
+}
+
+func (c *fakeCache[T]) Get(namespace, name string) (T, error) {
+	for _, obj := range c.objects {
+		if obj.GetNamespace() == namespace && obj.GetName() == name {
+			return obj, nil
+		}
+	}
+	var none T
+	return none, apierrors.NewNotFound(schema.GroupResource{}, name)
+}
+
+func (c *fakeCache[T]) GetByIndex(_, key string) ([]T, error) {
+	var objs []T
+	for _, obj := range c.objects {
+		for _, value := range c.index(obj) {
+			if value == key {
+				objs = append(objs, obj)
+			}
+		}
+	}
+	return objs, nil
+}
+
+type fakeStorageClassCache struct {
+	generic.NonNamespacedCacheInterface[*storagev1.StorageClass]
+	objects []*storagev1.StorageClass
+}
+
+func (c *fakeStorageClassCache) Get(name string) (*storagev1.StorageClass, error) {
+	for _, sc := range c.objects {
+		if sc.Name == name {
+			return sc, nil
+		}
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{}, name)
+}
+
+// fakeNetworkFSs records the changes of the controller, the last created or updated network filesystem is kept
+type fakeNetworkFSs struct {
+	ctlntefsv2.NetworkFilesystemController
+	actions []string
+	last    *networkfsv2.NetworkFilesystem
+}
+
+func (c *fakeNetworkFSs) Create(networkFS *networkfsv2.NetworkFilesystem) (*networkfsv2.NetworkFilesystem, error) {
+	c.actions = append(c.actions, "create "+networkFS.Namespace+"/"+networkFS.Name)
+	c.last = networkFS
+	return networkFS, nil
+}
+
+func (c *fakeNetworkFSs) Update(networkFS *networkfsv2.NetworkFilesystem) (*networkfsv2.NetworkFilesystem, error) {
+	c.actions = append(c.actions, "update "+networkFS.Namespace+"/"+networkFS.Name)
+	c.last = networkFS
+	return networkFS, nil
+}
+
+func (c *fakeNetworkFSs) Delete(namespace, name string, _ *metav1.DeleteOptions) error {
+	c.actions = append(c.actions, "delete "+namespace+"/"+name)
+	return nil
+}
+
+type testEnv struct {
+	autoDiscovery bool
+	gcOrphaned    bool
+	pvcs          []*corev1.PersistentVolumeClaim
+	scs           []*storagev1.StorageClass
+	networkFSs    []*networkfsv2.NetworkFilesystem
+}
+
+func newTestController(env testEnv) (*Controller, *fakeNetworkFSs) {
+	networkFSs := &fakeNetworkFSs{}
+	return &Controller{
+		namespace:         testNamespace,
+		autoDiscovery:     env.autoDiscovery,
+		gcOrphaned:        env.gcOrphaned,
+		PVCCache:          &fakeCache[*corev1.PersistentVolumeClaim]{objects: env.pvcs},
+		StorageClassCache: &fakeStorageClassCache{objects: env.scs},
+		NetworkFSCache: &fakeCache[*networkfsv2.NetworkFilesystem]{
+			objects: env.networkFSs,
+			index: func(networkFS *networkfsv2.NetworkFilesystem) []string {
+				return []string{networkFS.Spec.VolumeRef.VolumeName}
+			},
+		},
+		NetworkFilsystems: networkFSs,
+		recorder:          record.NewFakeRecorder(10),
+	}, networkFSs
+}
+
+func rwxPV() *corev1.PersistentVolume {
+	return &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: testPV, UID: "pv-uid-1"},
+		Spec: corev1.PersistentVolumeSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+			StorageClassName: "longhorn",
+			ClaimRef:         &corev1.ObjectReference{Namespace: "default", Name: "data"},
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: utils.LHCSIDriverName, VolumeHandle: testVolume},
+			},
+		},
+	}
+}
+
+func claim(discovery string) *corev1.PersistentVolumeClaim {
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "data"},
+		Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: testPV},
+	}
+	if discovery != "" {
+		pvc.Annotations = map[string]string{networkfsv2.AnnotationDiscovery: discovery}
+	}
+	return pvc
+}
+
+func storageClass(discovery string) *storagev1.StorageClass {
+	return &storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "longhorn", Annotations: map[string]string{networkfsv2.AnnotationDiscovery: discovery}},
+	}
+}
+
+// discovered returns the network filesystem created by the discovery for the volume, in the desired state
+func discovered(state networkfsv2.NetworkFSState, ownerReferences ...metav1.OwnerReference) *networkfsv2.NetworkFilesystem {
+	return &networkfsv2.NetworkFilesystem{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       testNamespace,
+			Name:            testPV,
+			Labels:          map[string]string{networkfsv2.LabelDiscovered: "true"},
+			OwnerReferences: ownerReferences,
+		},
+		Spec: networkfsv2.NetworkFSSpec{
+			VolumeRef:    networkfsv2.NetworkFSVolumeRef{VolumeName: testVolume},
+			DesiredState: state,
+		},
+	}
+}
+
+func TestOnPVChange(t *testing.T) {
+	pvOwner := pvOwnerReference(rwxPV())
+	otherOwner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "app", UID: "app-uid"}
+	userCreated := discovered(networkfsv2.NetworkFSStateDisabled)
+	userCreated.Labels = nil
+	deleting := discovered(networkfsv2.NetworkFSStateDisabled)
+	deleting.DeletionTimestamp = &metav1.Time{}
+	otherName := discovered(networkfsv2.NetworkFSStateEnabled)
+	otherName.Name = "data"
+	rwo := rwxPV()
+	rwo.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+
+	tests := []struct {
+		name          string
+		pv            *corev1.PersistentVolume
+		env           testEnv
+		wantActions   []string
+		wantNetworkFS *networkfsv2.NetworkFilesystem
+	}{
+		{name: "not a RWX volume", pv: rwo, env: testEnv{autoDiscovery: true}},
+		{
+			name:        "auto discovery",
+			pv:          rwxPV(),
+			env:         testEnv{autoDiscovery: true, gcOrphaned: true, pvcs: []*corev1.PersistentVolumeClaim{claim("")}},
+			wantActions: []string{"create harvester-system/pvc-1"},
+			wantNetworkFS: &networkfsv2.NetworkFilesystem{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:       testNamespace,
+					Name:            testPV,
+					Labels:          map[string]string{networkfsv2.LabelDiscovered: "true"},
+					Annotations:     map[string]string{networkfsv2.AnnotationDiscoveredFrom: "default/data"},
+					OwnerReferences: []metav1.OwnerReference{pvOwner},
+				},
+				Spec: networkfsv2.NetworkFSSpec{
+					VolumeRef:    networkfsv2.NetworkFSVolumeRef{VolumeName: testVolume},
+					DesiredState: networkfsv2.NetworkFSStateDisabled,
+					Protocol:     networkfsv2.NetworkFSProtocolNFS,
+				},
+			},
+		},
+		{name: "claim opts out", pv: rwxPV(), env: testEnv{autoDiscovery: true, pvcs: []*corev1.PersistentVolumeClaim{claim("false")}}},
+		{name: "storage class opts out", pv: rwxPV(), env: testEnv{autoDiscovery: true, scs: []*storagev1.StorageClass{storageClass("false")}}},
+		{
+			name:        "claim overrides the storage class",
+			pv:          rwxPV(),
+			env:         testEnv{pvcs: []*corev1.PersistentVolumeClaim{claim("true")}, scs: []*storagev1.StorageClass{storageClass("false")}},
+			wantActions: []string{"create harvester-system/pvc-1"},
+		},
+		{
+			name: "volume is exported under another name",
+			pv:   rwxPV(),
+			env:  testEnv{autoDiscovery: true, networkFSs: []*networkfsv2.NetworkFilesystem{otherName}},
+		},
+		{
+			name:        "disabled network filesystem is deleted on opt out",
+			pv:          rwxPV(),
+			env:         testEnv{gcOrphaned: true, pvcs: []*corev1.PersistentVolumeClaim{claim("false")}, networkFSs: []*networkfsv2.NetworkFilesystem{discovered(networkfsv2.NetworkFSStateDisabled, pvOwner)}},
+			wantActions: []string{"delete harvester-system/pvc-1"},
+		},
+		{
+			name: "enabled network filesystem is released on opt out",
+			pv:   rwxPV(),
+			env: testEnv{
+				gcOrphaned: true,
+				pvcs:       []*corev1.PersistentVolumeClaim{claim("false")},
+				networkFSs: []*networkfsv2.NetworkFilesystem{discovered(networkfsv2.NetworkFSStateEnabled, otherOwner, pvOwner)},
+			},
+			wantActions: []string{"update harvester-system/pvc-1"},
+			wantNetworkFS: &networkfsv2.NetworkFilesystem{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:       testNamespace,
+					Name:            testPV,
+					Labels:          map[string]string{},
+					OwnerReferences: []metav1.OwnerReference{otherOwner},
+				},
+				Spec: networkfsv2.NetworkFSSpec{
+					VolumeRef:    networkfsv2.NetworkFSVolumeRef{VolumeName: testVolume},
+					DesiredState: networkfsv2.NetworkFSStateEnabled,
+				},
+			},
+		},
+		{
+			name: "deleting network filesystem is left alone on opt out",
+			pv:   rwxPV(),
+			env:  testEnv{pvcs: []*corev1.PersistentVolumeClaim{claim("false")}, networkFSs: []*networkfsv2.NetworkFilesystem{deleting}},
+		},
+		{
+			name: "network filesystem of the user is left alone on opt out",
+			pv:   rwxPV(),
+			env:  testEnv{pvcs: []*corev1.PersistentVolumeClaim{claim("false")}, networkFSs: []*networkfsv2.NetworkFilesystem{userCreated}},
+		},
+		{
+			name:          "discovered network filesystem is adopted once the garbage collection is enabled",
+			pv:            rwxPV(),
+			env:           testEnv{autoDiscovery: true, gcOrphaned: true, networkFSs: []*networkfsv2.NetworkFilesystem{discovered(networkfsv2.NetworkFSStateEnabled)}},
+			wantActions:   []string{"update harvester-system/pvc-1"},
+			wantNetworkFS: discovered(networkfsv2.NetworkFSStateEnabled, pvOwner),
+		},
+		{
+			name: "adopted network filesystem is left alone",
+			pv:   rwxPV(),
+			env:  testEnv{autoDiscovery: true, gcOrphaned: true, networkFSs: []*networkfsv2.NetworkFilesystem{discovered(networkfsv2.NetworkFSStateEnabled, pvOwner)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, networkFSs := newTestController(tt.env)
+			if _, err := c.OnPVChange(tt.pv.Name, tt.pv); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(networkFSs.actions, tt.wantActions) {
+				t.Errorf("actions = %v, want %v", networkFSs.actions, tt.wantActions)
+			}
+			if tt.wantNetworkFS != nil && !reflect.DeepEqual(networkFSs.last, tt.wantNetworkFS) {
+				t.Errorf("network filesystem = %+v, want %+v", networkFSs.last, tt.wantNetworkFS)
+			}
+		})
+	}
+}
+
+func TestOnNetworkFSChange(t *testing.T) {
+	orphaned := func(networkFS *networkfsv2.NetworkFilesystem) *networkfsv2.NetworkFilesystem {
+		networkFS.Status.NetworkFSConds = []networkfsv2.NetworkFSCondition{{Type: networkfsv2.ConditionTypeOrphaned, Status: corev1.ConditionTrue}}
+		return networkFS
+	}
+	userCreated := orphaned(discovered(networkfsv2.NetworkFSStateDisabled))
+	userCreated.Labels = nil
+	deleting := orphaned(discovered(networkfsv2.NetworkFSStateDisabled))
+	deleting.DeletionTimestamp = &metav1.Time{}
+
+	tests := []struct {
+		name        string
+		gcOrphaned  bool
+		networkFS   *networkfsv2.NetworkFilesystem
+		wantActions []string
+	}{
+		{name: "orphaned", gcOrphaned: true, networkFS: orphaned(discovered(networkfsv2.NetworkFSStateEnabled)), wantActions: []string{"delete harvester-system/pvc-1"}},
+		{name: "garbage collection is disabled", networkFS: orphaned(discovered(networkfsv2.NetworkFSStateEnabled))},
+		{name: "volume exists", gcOrphaned: true, networkFS: discovered(networkfsv2.NetworkFSStateEnabled)},
+		{name: "network filesystem of the user", gcOrphaned: true, networkFS: userCreated},
+		{name: "deleting", gcOrphaned: true, networkFS: deleting},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, networkFSs := newTestController(testEnv{gcOrphaned: tt.gcOrphaned})
+			if _, err := c.OnNetworkFSChange(tt.networkFS.Name, tt.networkFS); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(networkFSs.actions, tt.wantActions) {
+				t.Errorf("actions = %v, want %v", networkFSs.actions, tt.wantActions)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package networkfilesystem
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+
+	"github.com/rancher/wrangler/v3/pkg/relatedresource"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+const (
+	// shareManagerPodLabel selects the share-manager pod of the Longhorn volume
+	shareManagerPodLabel = "longhorn.io/share-manager"
+	maxPort              = 65535
+)
+
+// accessPolicyName returns the name of the NetworkPolicy of the network filesystem in the Longhorn namespace. The
+// namespace and the name are hashed, joining them would be ambiguous, e.g. a-b/c and a/b-c, and could be too long.
+func accessPolicyName(networkFS *networkfsv2.NetworkFilesystem) string {
+	sum := sha256.Sum256([]byte(networkFS.Namespace + "/" + networkFS.Name))
+	return "networkfs-" + hex.EncodeToString(sum[:])[:16]
+}
+
+// isAccessPolicyOwner returns true if the NetworkPolicy is labeled with the network filesystem
+func isAccessPolicyOwner(networkPolicy *networkingv1.NetworkPolicy, networkFS *networkfsv2.NetworkFilesystem) bool {
+	return networkPolicy.Labels[networkfsv2.LabelNetworkFS] == networkFS.Name &&
+		networkPolicy.Labels[networkfsv2.LabelNetworkFSNamespace] == networkFS.Namespace
+}
+
+// hasAccessPolicy returns true if the network filesystem restricts its clients
+func hasAccessPolicy(networkFS *networkfsv2.NetworkFilesystem) bool {
+	return networkFS.Spec.AccessPolicy != nil && len(networkFS.Spec.AccessPolicy.AllowedCIDRs) > 0
+}
+
+// reconcileAccessPolicy creates or updates the NetworkPolicy restricting the NFS port of the share-manager pod to
+// the allowed CIDRs, and removes it once no CIDR is required. The NetworkPolicy lives in the Longhorn namespace with
+// the share-manager pod, it cannot be owned by the network filesystem and is tracked by the labels instead.
+func (c *Controller) reconcileAccessPolicy(networkFS *networkfsv2.NetworkFilesystem, observed *observedState) (*networkingv1.NetworkPolicy, error) {
+	if !hasAccessPolicy(networkFS) || observed.volumeName == "" {
+		return nil, c.removeAccessPolicy(networkFS)
+	}
+
+	nodes, err := c.NodeCache.List(labels.Everything())
+	if err != nil {
+		logrus.Errorf("Failed to list nodes: %v", err)
+		return nil, err
+	}
+	desired := accessNetworkPolicy(networkFS, observed.volumeName, nodeCIDRs(nodes))
+	existing, err := c.NetworkPolicyCache.Get(desired.Namespace, desired.Name)
+	if err != nil && !errors.IsNotFound(err) {
+		logrus.Errorf("Failed to get network policy %s/%s: %v", desired.Namespace, desired.Name, err)
+		return nil, err
+	}
+	if errors.IsNotFound(err) {
+		logrus.Infof("Create network policy %s/%s for network filesystem %s", desired.Namespace, desired.Name, networkFS.Name)
+		return c.NetworkPolicies.Create(desired)
+	}
+	if !isAccessPolicyOwner(existing, networkFS) {
+		return nil, fmt.Errorf("network policy %s/%s is not owned by network filesystem %s/%s", existing.Namespace, existing.Name, networkFS.Namespace, networkFS.Name)
+	}
+	if reflect.DeepEqual(existing.Spec, desired.Spec) {
+		return existing, nil
+	}
+	policyCpy := existing.DeepCopy()
+	policyCpy.Spec = desired.Spec
+	logrus.Infof("Update network policy %s/%s of network filesystem %s", desired.Namespace, desired.Name, networkFS.Name)
+	return c.NetworkPolicies.Update(policyCpy)
+}
+
+// removeAccessPolicy removes the NetworkPolicy of the network filesystem, if any
+func (c *Controller) removeAccessPolicy(networkFS *networkfsv2.NetworkFilesystem) error {
+	name := accessPolicyName(networkFS)
+	existing, err := c.NetworkPolicyCache.Get(utils.LHNameSpace, name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		logrus.Errorf("Failed to get network policy %s/%s: %v", utils.LHNameSpace, name, err)
+		return err
+	}
+	if !isAccessPolicyOwner(existing, networkFS) {
+		// the network filesystem has no network policy, the one of the name belongs to someone else
+		return nil
+	}
+	logrus.Infof("Remove network policy %s/%s of network filesystem %s", utils.LHNameSpace, name, networkFS.Name)
+	if err := c.NetworkPolicies.Delete(utils.LHNameSpace, name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// nodeCIDRs returns the internal addresses of the nodes as single-address CIDRs, in order
+func nodeCIDRs(nodes []*corev1.Node) []string {
+	seen := map[string]bool{}
+	var cidrs []string
+	for _, node := range nodes {
+		for _, address := range node.Status.Addresses {
+			ip := net.ParseIP(address.Address)
+			if address.Type != corev1.NodeInternalIP || ip == nil {
+				continue
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			cidr := fmt.Sprintf("%s/%d", ip.String(), bits)
+			if !seen[cidr] {
+				seen[cidr] = true
+				cidrs = append(cidrs, cidr)
+			}
+		}
+	}
+	sort.Strings(cidrs)
+	return cidrs
+}
+
+// accessNetworkPolicy only restricts the NFS port, the other ports of the share-manager pod stay open for Longhorn.
+// The first rule admits the allowed CIDRs, the last one admits the nodes since the manager probes the export from the
+// host network of its node.
+func accessNetworkPolicy(networkFS *networkfsv2.NetworkFilesystem, volumeName string, nodeCIDRs []string) *networkingv1.NetworkPolicy {
+	tcp := corev1.ProtocolTCP
+	udp := corev1.ProtocolUDP
+	nfsPort := intstr.FromInt32(utils.NFSPort)
+	lowPort, highPort := intstr.FromInt32(1), intstr.FromInt32(utils.NFSPort+1)
+	lowEnd, highEnd := int32(utils.NFSPort-1), int32(maxPort)
+
+	var peers []networkingv1.NetworkPolicyPeer
+	for _, cidr := range networkFS.Spec.AccessPolicy.AllowedCIDRs {
+		peers = append(peers, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: canonicalCIDR(cidr)}})
+	}
+	var nodePeers []networkingv1.NetworkPolicyPeer
+	for _, cidr := range nodeCIDRs {
+		nodePeers = append(nodePeers, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}})
+	}
+	networkPolicy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      accessPolicyName(networkFS),
+			Namespace: utils.LHNameSpace,
+			Labels: map[string]string{
+				networkfsv2.LabelNetworkFS:          networkFS.Name,
+				networkfsv2.LabelNetworkFSNamespace: networkFS.Namespace,
+			},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{shareManagerPodLabel: volumeName},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					From:  peers,
+					Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &nfsPort}, {Protocol: &udp, Port: &nfsPort}},
+				},
+				{
+					Ports: []networkingv1.NetworkPolicyPort{
+						{Protocol: &tcp, Port: &lowPort, EndPort: &lowEnd},
+						{Protocol: &tcp, Port: &highPort, EndPort: &highEnd},
+						{Protocol: &udp, Port: &lowPort, EndPort: &lowEnd},
+						{Protocol: &udp, Port: &highPort, EndPort: &highEnd},
+					},
+				},
+			},
+		},
+	}
+	if len(nodePeers) > 0 {
+		networkPolicy.Spec.Ingress = append(networkPolicy.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+			From:  nodePeers,
+			Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &nfsPort}, {Protocol: &udp, Port: &nfsPort}},
+		})
+	}
+	return networkPolicy
+}
+
+// canonicalCIDR returns the network of the CIDR, e.g. 10.0.0.0/8 for 10.1.2.3/8, the webhook rejects the invalid ones
+func canonicalCIDR(cidr string) string {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return cidr
+	}
+	return network.String()
+}
+
+// accessPolicyStatus returns the access policy in effect, the allowed CIDRs are the ones of the first rule of the
+// NetworkPolicy, the nodes admitted by the last one are left out
+func accessPolicyStatus(networkFS *networkfsv2.NetworkFilesystem, networkPolicy *networkingv1.NetworkPolicy) *networkfsv2.NetworkFSAccessPolicyStatus {
+	if networkFS.Spec.AccessPolicy == nil {
+		return nil
+	}
+	status := &networkfsv2.NetworkFSAccessPolicyStatus{}
+	if networkPolicy == nil {
+		return status
+	}
+	status.NetworkPolicy = fmt.Sprintf("%s/%s", networkPolicy.Namespace, networkPolicy.Name)
+	if len(networkPolicy.Spec.Ingress) == 0 {
+		return status
+	}
+	for _, peer := range networkPolicy.Spec.Ingress[0].From {
+		if peer.IPBlock != nil {
+			status.AllowedCIDRs = append(status.AllowedCIDRs, peer.IPBlock.CIDR)
+		}
+	}
+	return status
+}
+
+// resolveNetworkPolicy maps the NetworkPolicy in the Longhorn namespace to the NetworkFilesystem through its labels
+func (c *Controller) resolveNetworkPolicy(namespace, _ string, obj runtime.Object) ([]relatedresource.Key, error) {
+	networkPolicy, ok := obj.(*networkingv1.NetworkPolicy)
+	if !ok || namespace != utils.LHNameSpace {
+		return nil, nil
+	}
+	name, namespace := networkPolicy.Labels[networkfsv2.LabelNetworkFS], networkPolicy.Labels[networkfsv2.LabelNetworkFSNamespace]
+	if name == "" || namespace == "" {
+		return nil, nil
+	}
+	return []relatedresource.Key{relatedresource.NewKey(namespace, name)}, nil
+}
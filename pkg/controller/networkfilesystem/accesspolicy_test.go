@@ -0,0 +1,60 @@
+package networkfilesystem
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+func nodeWithAddresses(name string, addresses ...corev1.NodeAddress) *corev1.Node {
+	return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}, Status: corev1.NodeStatus{Addresses: addresses}}
+}
+
+func TestAccessNetworkPolicy(t *testing.T) {
+	nodes := []*corev1.Node{
+		nodeWithAddresses("node-2",
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "192.168.0.12"},
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "fd00::12"},
+			corev1.NodeAddress{Type: corev1.NodeHostName, Address: "node-2"}),
+		nodeWithAddresses("node-1",
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "192.168.0.11"},
+			corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: "203.0.113.11"}),
+	}
+	cidrs := nodeCIDRs(nodes)
+	wantCIDRs := []string{"192.168.0.11/32", "192.168.0.12/32", "fd00::12/128"}
+	if !reflect.DeepEqual(cidrs, wantCIDRs) {
+		t.Fatalf("node CIDRs = %v, want %v", cidrs, wantCIDRs)
+	}
+
+	networkFS := &networkfsv2.NetworkFilesystem{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pvc-1"},
+		Spec: networkfsv2.NetworkFSSpec{
+			AccessPolicy: &networkfsv2.NetworkFSAccessPolicy{AllowedCIDRs: []string{"10.1.2.3/16"}},
+		},
+	}
+	policy := accessNetworkPolicy(networkFS, "pvc-1", cidrs)
+	if len(policy.Spec.Ingress) != 3 {
+		t.Fatalf("ingress rules = %d, want the allowed CIDRs, the other ports and the nodes", len(policy.Spec.Ingress))
+	}
+	var nodePeers []string
+	for _, peer := range policy.Spec.Ingress[2].From {
+		nodePeers = append(nodePeers, peer.IPBlock.CIDR)
+	}
+	if !reflect.DeepEqual(nodePeers, wantCIDRs) {
+		t.Errorf("node peers = %v, want %v", nodePeers, wantCIDRs)
+	}
+	if ports := policy.Spec.Ingress[2].Ports; len(ports) != 2 || ports[0].Port.IntValue() != utils.NFSPort {
+		t.Errorf("node ports = %v, want the NFS port", ports)
+	}
+
+	// the status lists the allowed CIDRs only
+	status := accessPolicyStatus(networkFS, policy)
+	if !reflect.DeepEqual(status.AllowedCIDRs, []string{"10.1.0.0/16"}) {
+		t.Errorf("allowed CIDRs = %v, want [10.1.0.0/16]", status.AllowedCIDRs)
+	}
+}
@@ -0,0 +1,207 @@
+package networkfilesystem
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+const (
+	// bindingType is the type of the binding, the Secret type is derived from it as the Service Binding spec suggests
+	bindingType     = "nfs"
+	bindingProvider = "harvester-networkfs"
+	// bindingMountPointDir is the parent of the default mount point, /mnt/<name>
+	bindingMountPointDir = "/mnt"
+)
+
+// Keys of the binding Secret, see https://servicebinding.io/spec/core/1.0.0/#well-known-secret-entries
+const (
+	BindingKeyType          = "type"
+	BindingKeyProvider      = "provider"
+	BindingKeyHost          = "host"
+	BindingKeyPort          = "port"
+	BindingKeyPath          = "path"
+	BindingKeyMountOptions  = "mountOptions"
+	BindingKeyMountPoint    = "mountPoint"
+	BindingKeyFstab         = "fstab"
+	BindingKeyMountUnit     = "mountUnit"
+	BindingKeyMountUnitName = "mountUnitName"
+)
+
+// reconcileBinding maintains the binding Secret, and the ConfigMap if it is requested, with the connection info of the
+// export. They are kept while the network filesystem is not exported, with the type and the provider only, so the
+// workloads projecting them still start and see no connection info.
+func (c *Controller) reconcileBinding(networkFS *networkfsv2.NetworkFilesystem, status *networkfsv2.NetworkFSStatus) (*corev1.LocalObjectReference, error) {
+	name := utils.NetworkFSObjectName(networkFS.Name)
+	secret, err := c.SecretCache.Get(networkFS.Namespace, name)
+	if err != nil && !errors.IsNotFound(err) {
+		logrus.Errorf("Failed to get secret %s/%s: %v", networkFS.Namespace, name, err)
+		return nil, err
+	}
+	if err == nil && !metav1.IsControlledBy(secret, networkFS) {
+		return nil, fmt.Errorf("secret %s/%s is not owned by network filesystem %s", networkFS.Namespace, name, networkFS.Name)
+	}
+
+	data := bindingData(networkFS, status)
+	if errors.IsNotFound(err) {
+		logrus.Infof("Create binding secret %s/%s for network filesystem %s", networkFS.Namespace, name, networkFS.Name)
+		secret, err = c.Secrets.Create(&corev1.Secret{
+			ObjectMeta: ownedObjectMeta(networkFS),
+			Type:       corev1.SecretType("servicebinding.io/" + bindingType),
+			StringData: data,
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else if !reflect.DeepEqual(secret.Data, bytesData(data)) {
+		logrus.Infof("Update binding secret %s/%s of network filesystem %s", networkFS.Namespace, name, networkFS.Name)
+		secretCpy := secret.DeepCopy()
+		secretCpy.Data = bytesData(data)
+		if _, err := c.Secrets.Update(secretCpy); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.reconcileBindingConfigMap(networkFS, data); err != nil {
+		return nil, err
+	}
+	return &corev1.LocalObjectReference{Name: secret.Name}, nil
+}
+
+// reconcileBindingConfigMap mirrors the binding Secret to the ConfigMap, and removes it once it is not requested
+func (c *Controller) reconcileBindingConfigMap(networkFS *networkfsv2.NetworkFilesystem, data map[string]string) error {
+	name := utils.NetworkFSObjectName(networkFS.Name)
+	configMap, err := c.ConfigMapCache.Get(networkFS.Namespace, name)
+	if err != nil && !errors.IsNotFound(err) {
+		logrus.Errorf("Failed to get configmap %s/%s: %v", networkFS.Namespace, name, err)
+		return err
+	}
+	if err == nil && !metav1.IsControlledBy(configMap, networkFS) {
+		return fmt.Errorf("configmap %s/%s is not owned by network filesystem %s", networkFS.Namespace, name, networkFS.Name)
+	}
+
+	if networkFS.Spec.Binding == nil || !networkFS.Spec.Binding.ConfigMap {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		logrus.Infof("Remove binding configmap %s/%s of network filesystem %s", networkFS.Namespace, name, networkFS.Name)
+		if err := c.ConfigMaps.Delete(networkFS.Namespace, name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	if errors.IsNotFound(err) {
+		logrus.Infof("Create binding configmap %s/%s for network filesystem %s", networkFS.Namespace, name, networkFS.Name)
+		_, err = c.ConfigMaps.Create(&corev1.ConfigMap{
+			ObjectMeta: ownedObjectMeta(networkFS),
+			Data:       data,
+		})
+		return err
+	}
+	if reflect.DeepEqual(configMap.Data, data) {
+		return nil
+	}
+	configMapCpy := configMap.DeepCopy()
+	configMapCpy.Data = data
+	_, err = c.ConfigMaps.Update(configMapCpy)
+	return err
+}
+
+// isExported returns true if the export is enabled and has an endpoint
+func isExported(status *networkfsv2.NetworkFSStatus) bool {
+	return status.State == networkfsv2.NetworkFSStateEnabled && status.Export != nil && len(status.Export.Addresses) > 0
+}
+
+// bindingData returns the connection info of the export, only the type and the provider while it is not exported
+func bindingData(networkFS *networkfsv2.NetworkFilesystem, status *networkfsv2.NetworkFSStatus) map[string]string {
+	data := map[string]string{
+		BindingKeyType:     bindingType,
+		BindingKeyProvider: bindingProvider,
+	}
+	if !isExported(status) {
+		return data
+	}
+
+	export := status.Export
+	host := export.Addresses[0]
+	options := utils.ExportMountOptions(export)
+	mountPoint := bindingMountPoint(networkFS)
+	unitName := mountUnitName(mountPoint)
+	what := fmt.Sprintf("%s:%s", mountHost(host), export.ExportPath)
+
+	data[BindingKeyHost] = host
+	data[BindingKeyPort] = strconv.Itoa(int(export.Port))
+	data[BindingKeyPath] = export.ExportPath
+	data[BindingKeyMountOptions] = options
+	data[BindingKeyMountPoint] = mountPoint
+	data[BindingKeyFstab] = fmt.Sprintf("%s %s nfs _netdev,%s 0 0\n", what, fstabEscape(mountPoint), options)
+	data[BindingKeyMountUnitName] = unitName
+	data[BindingKeyMountUnit] = fmt.Sprintf(`[Unit]
+Description=Network filesystem %s/%s
+Wants=network-online.target
+After=network-online.target
+
+[Mount]
+What=%s
+Where=%s
+Type=nfs
+Options=%s
+
+[Install]
+WantedBy=remote-fs.target
+`, networkFS.Namespace, networkFS.Name, what, mountPoint, options)
+	return data
+}
+
+func bindingMountPoint(networkFS *networkfsv2.NetworkFilesystem) string {
+	if networkFS.Spec.Binding != nil && networkFS.Spec.Binding.MountPoint != "" {
+		return networkFS.Spec.Binding.MountPoint
+	}
+	return path.Join(bindingMountPointDir, networkFS.Name)
+}
+
+// mountUnitName returns the name of the systemd mount unit of the mount point, escaped as systemd-escape --path does
+func mountUnitName(mountPoint string) string {
+	trimmed := strings.Trim(path.Clean(mountPoint), "/")
+	if trimmed == "" {
+		return "-.mount"
+	}
+	var b strings.Builder
+	for i := 0; i < len(trimmed); i++ {
+		ch := trimmed[i]
+		switch {
+		case ch == '/':
+			b.WriteByte('-')
+		case ch == '.' && i == 0,
+			!(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == ':' || ch == '_' || ch == '.'):
+			fmt.Fprintf(&b, `\x%02x`, ch)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String() + ".mount"
+}
+
+// fstabEscape escapes the whitespaces of the fstab field
+func fstabEscape(field string) string {
+	return strings.NewReplacer(" ", `\040`, "\t", `\011`).Replace(field)
+}
+
+func bytesData(data map[string]string) map[string][]byte {
+	bytes := make(map[string][]byte, len(data))
+	for key, value := range data {
+		bytes[key] = []byte(value)
+	}
+	return bytes
+}
@@ -0,0 +1,61 @@
+package networkfilesystem
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+)
+
+func TestBindingData(t *testing.T) {
+	networkFS := &networkfsv2.NetworkFilesystem{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pvc-1"}}
+	export := &networkfsv2.NetworkFSExport{Addresses: []string{"10.52.0.10"}, Port: 2049, ExportPath: "/pvc-1", MountOptions: "vers=4.1"}
+	emptied := map[string]string{BindingKeyType: bindingType, BindingKeyProvider: bindingProvider}
+
+	tests := []struct {
+		name   string
+		status networkfsv2.NetworkFSStatus
+		// want is the expected data, nil expects the connection info
+		want map[string]string
+	}{
+		{
+			name:   "disabled",
+			status: networkfsv2.NetworkFSStatus{State: networkfsv2.NetworkFSStateDisabled},
+			want:   emptied,
+		},
+		{
+			name:   "disabling with the last export",
+			status: networkfsv2.NetworkFSStatus{State: networkfsv2.NetworkFSStateDisabling, Export: export},
+			want:   emptied,
+		},
+		{
+			name:   "enabled without an address",
+			status: networkfsv2.NetworkFSStatus{State: networkfsv2.NetworkFSStateEnabled, Export: &networkfsv2.NetworkFSExport{}},
+			want:   emptied,
+		},
+		{
+			name:   "enabled",
+			status: networkfsv2.NetworkFSStatus{State: networkfsv2.NetworkFSStateEnabled, Export: export},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := bindingData(networkFS, &tt.status)
+			if tt.want != nil {
+				if !reflect.DeepEqual(data, tt.want) {
+					t.Errorf("data = %v, want %v", data, tt.want)
+				}
+				return
+			}
+			if data[BindingKeyType] != bindingType || data[BindingKeyHost] != "10.52.0.10" || data[BindingKeyPath] != "/pvc-1" {
+				t.Errorf("data = %v, want the connection info of the export", data)
+			}
+			if data[BindingKeyFstab] != "10.52.0.10:/pvc-1 /mnt/pvc-1 nfs _netdev,vers=4.1 0 0\n" {
+				t.Errorf("fstab = %q", data[BindingKeyFstab])
+			}
+		})
+	}
+}
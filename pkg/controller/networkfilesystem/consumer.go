@@ -0,0 +1,150 @@
+package networkfilesystem
+
+import (
+	"fmt"
+	"strings"
+
+	longhornv2 "github.com/longhorn/longhorn-manager/k8s/pkg/apis/longhorn/v1beta2"
+	"github.com/rancher/wrangler/v3/pkg/relatedresource"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+)
+
+const (
+	podByClaimIndex = "networkfs.harvesterhci.io/pod-by-claim"
+)
+
+// indexPodByClaim indexes the running pods by the namespace/name of the volume claims they mount
+func indexPodByClaim(pod *corev1.Pod) ([]string, error) {
+	if isPodTerminated(pod) {
+		return nil, nil
+	}
+	var keys []string
+	for _, vol := range pod.Spec.Volumes {
+		if vol.PersistentVolumeClaim != nil {
+			keys = append(keys, claimKey(pod.Namespace, vol.PersistentVolumeClaim.ClaimName))
+		}
+	}
+	return keys, nil
+}
+
+// resolvePod maps the pod to the network filesystems of the volume claims it mounts
+func (c *Controller) resolvePod(namespace, _ string, obj runtime.Object) ([]relatedresource.Key, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return nil, nil
+	}
+
+	var keys []relatedresource.Key
+	for _, vol := range pod.Spec.Volumes {
+		if vol.PersistentVolumeClaim == nil {
+			continue
+		}
+		pvc, err := c.PersistentVolumeClaimCache.Get(namespace, vol.PersistentVolumeClaim.ClaimName)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		if pvc.Spec.VolumeName == "" {
+			continue
+		}
+		pv, err := c.PersistentVolumeCache.Get(pvc.Spec.VolumeName)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		pvKeys, err := c.resolvePersistentVolume("", pv.Name, pv)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, pvKeys...)
+	}
+	return keys, nil
+}
+
+// observeConsumers returns the pods mounting the volume claim bound to the persistent volume
+func (c *Controller) observeConsumers(pv *corev1.PersistentVolume) ([]*corev1.Pod, error) {
+	if pv == nil || pv.Spec.ClaimRef == nil {
+		return nil, nil
+	}
+	return c.PodCache.GetByIndex(podByClaimIndex, claimKey(pv.Spec.ClaimRef.Namespace, pv.Spec.ClaimRef.Name))
+}
+
+// consumers returns the in-cluster consumers of the volume: the pods mounting the claim
+// and the foreign CSI attachment tickets, including the ones of another network filesystem of the volume
+func consumers(networkFS *networkfsv2.NetworkFilesystem, observed *observedState) []networkfsv2.NetworkFSConsumer {
+	var result []networkfsv2.NetworkFSConsumer
+	for _, pod := range observed.pods {
+		result = append(result, networkfsv2.NetworkFSConsumer{
+			Kind:      networkfsv2.ConsumerKindPod,
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+			NodeName:  pod.Spec.NodeName,
+		})
+	}
+	if observed.volumeAttachment != nil {
+		for _, id := range foreignTicketIDs(networkFS, observed.volumeAttachment) {
+			ticket := observed.volumeAttachment.Spec.AttachmentTickets[id]
+			// the tickets of the other controllers, e.g. a backup, come and go with their operation
+			if ticket.Type != longhornv2.AttacherTypeCSIAttacher {
+				continue
+			}
+			result = append(result, networkfsv2.NetworkFSConsumer{
+				Kind:     networkfsv2.ConsumerKindAttachmentTicket,
+				Name:     id,
+				NodeName: ticket.NodeID,
+			})
+		}
+	}
+	return result
+}
+
+// isDisableBlocked returns true if the export is still up and the consumers of the volume block the disable request.
+// Every disable request is deferred, the expired lease and the idle export too, the Blocked condition tells which one.
+func isDisableBlocked(networkFS *networkfsv2.NetworkFilesystem, observed *observedState) bool {
+	if networkFS.Spec.Force {
+		return false
+	}
+	if !isExporting(&networkFS.Status) {
+		return false
+	}
+	return len(consumers(networkFS, observed)) > 0
+}
+
+// blockedMessage returns the message of the Blocked condition, the request of the deferred disable and the consumers
+// of the volume deferring it
+func blockedMessage(desiredStateReason string, consumers []networkfsv2.NetworkFSConsumer) string {
+	names := make([]string, 0, len(consumers))
+	for _, consumer := range consumers {
+		if consumer.Namespace != "" {
+			names = append(names, fmt.Sprintf("%s %s/%s", consumer.Kind, consumer.Namespace, consumer.Name))
+		} else {
+			names = append(names, fmt.Sprintf("%s %s", consumer.Kind, consumer.Name))
+		}
+	}
+	request := "Disable is requested"
+	switch desiredStateReason {
+	case networkfsv2.DesiredStateReasonScheduleClosed:
+		request = "Schedule window is closed"
+	case networkfsv2.DesiredStateReasonLeaseExpired:
+		request = "Lease expired"
+	case networkfsv2.DesiredStateReasonIdle:
+		request = "Export is idle"
+	}
+	return fmt.Sprintf("%s, but the volume is still used by %s, set spec.force to disable anyway", request, strings.Join(names, ", "))
+}
+
+func isPodTerminated(pod *corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed
+}
+
+func claimKey(namespace, name string) string {
+	return namespace + "/" + name
+}
@@ -2,291 +2,472 @@ package networkfilesystem
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"reflect"
+	"sync"
+	"time"
 
 	longhornv2 "github.com/longhorn/longhorn-manager/k8s/pkg/apis/longhorn/v1beta2"
-	lhclientset "github.com/longhorn/longhorn-manager/k8s/pkg/client/clientset/versioned"
 	ctlv1 "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+	ctlnetworkingv1 "github.com/rancher/wrangler/v3/pkg/generated/controllers/networking.k8s.io/v1"
+	"github.com/rancher/wrangler/v3/pkg/relatedresource"
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-
-	networkfsv1 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta1"
-	ctlntefsv1 "github.com/harvester/networkfs-manager/pkg/generated/controllers/harvesterhci.io/v1beta1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	ctlntefsv2 "github.com/harvester/networkfs-manager/pkg/generated/controllers/harvesterhci.io/v1beta2"
+	ctllonghornv1 "github.com/harvester/networkfs-manager/pkg/generated/controllers/longhorn.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/metrics"
 	"github.com/harvester/networkfs-manager/pkg/utils"
 )
 
 type Controller struct {
-	namespace string
-	nodeName  string
-
-	coreClient        ctlv1.Interface
-	lhClient          *lhclientset.Clientset
-	endpointsClient   ctlv1.EndpointsController
-	NetworkFSCache    ctlntefsv1.NetworkFilesystemCache
-	NetworkFilsystems ctlntefsv1.NetworkFilesystemController
+	namespace           string
+	nodeName            string
+	transitionTimeout   time.Duration
+	consumerGracePeriod time.Duration
+	failbackDelay       time.Duration
+
+	EndpointCache              ctlv1.EndpointsCache
+	Endpoints                  ctlv1.EndpointsController
+	ServiceCache               ctlv1.ServiceCache
+	Services                   ctlv1.ServiceController
+	PersistentVolumeCache      ctlv1.PersistentVolumeCache
+	PersistentVolumeClaimCache ctlv1.PersistentVolumeClaimCache
+	PodCache                   ctlv1.PodCache
+	NodeCache                  ctlv1.NodeCache
+	SecretCache                ctlv1.SecretCache
+	Secrets                    ctlv1.SecretClient
+	ConfigMapCache             ctlv1.ConfigMapCache
+	ConfigMaps                 ctlv1.ConfigMapClient
+	ShareManagerCache          ctllonghornv1.ShareManagerCache
+	VolumeCache                ctllonghornv1.VolumeCache
+	VolumeAttachmentCache      ctllonghornv1.VolumeAttachmentCache
+	VolumeAttachments          ctllonghornv1.VolumeAttachmentController
+	NetworkPolicyCache         ctlnetworkingv1.NetworkPolicyCache
+	NetworkPolicies            ctlnetworkingv1.NetworkPolicyController
+	NetworkFSCache             ctlntefsv2.NetworkFilesystemCache
+	NetworkFilsystems          ctlntefsv2.NetworkFilesystemController
+
+	// nodeStates holds the nodeState last seen of every node, keyed by the node name
+	nodeStates sync.Map
+
+	prober   *exportProber
+	recorder record.EventRecorder
+	// clock is the time the status is computed at, e.g. the time the schedule is evaluated at
+	clock clock.PassiveClock
 }
 
 const (
-	netFSHandlerName = "harvester-network-filesystem-handler"
+	netFSHandlerName        = "harvester-network-filesystem-handler"
+	netFSRelatedHandlerName = "harvester-network-filesystem-related-handler"
+	nodeHandlerName         = "harvester-network-filesystem-node-handler"
 )
 
-// Register register the longhorn node CRD controller
-func Register(ctx context.Context, coreClient ctlv1.Interface, lhClient *lhclientset.Clientset, endpoints ctlv1.EndpointsController, netfilesystems ctlntefsv1.NetworkFilesystemController, opt *utils.Option) error {
-
+// Register register the network filesystem controller, the single writer of the NetworkFilesystem status. The Secrets
+// and the ConfigMaps of the binding client are only the ones labeled with their network filesystem, so the controller
+// does not cache all of them.
+func Register(ctx context.Context, coreClient, bindingClient ctlv1.Interface, lhClient ctllonghornv1.Interface, networkingClient ctlnetworkingv1.Interface, netfilesystems ctlntefsv2.NetworkFilesystemController, recorder record.EventRecorder, opt *utils.Option) error {
+
+	endpoints := coreClient.Endpoints()
+	pvs := coreClient.PersistentVolume()
+	pvcs := coreClient.PersistentVolumeClaim()
+	pods := coreClient.Pod()
+	nodes := coreClient.Node()
+	services := coreClient.Service()
+	secrets := bindingClient.Secret()
+	configmaps := bindingClient.ConfigMap()
+	sharemanagers := lhClient.ShareManager()
+	volumes := lhClient.Volume()
+	volumeattachments := lhClient.VolumeAttachment()
+	networkpolicies := networkingClient.NetworkPolicy()
 	c := &Controller{
-		namespace:         opt.Namespace,
-		nodeName:          opt.NodeName,
-		coreClient:        coreClient,
-		lhClient:          lhClient,
-		endpointsClient:   endpoints,
-		NetworkFilsystems: netfilesystems,
-		NetworkFSCache:    netfilesystems.Cache(),
+		namespace:                  opt.Namespace,
+		nodeName:                   opt.NodeName,
+		transitionTimeout:          opt.TransitionTimeout,
+		consumerGracePeriod:        opt.ConsumerGracePeriod,
+		failbackDelay:              opt.FailbackDelay,
+		EndpointCache:              endpoints.Cache(),
+		Endpoints:                  endpoints,
+		ServiceCache:               services.Cache(),
+		Services:                   services,
+		PersistentVolumeCache:      pvs.Cache(),
+		PersistentVolumeClaimCache: pvcs.Cache(),
+		PodCache:                   pods.Cache(),
+		NodeCache:                  nodes.Cache(),
+		SecretCache:                secrets.Cache(),
+		Secrets:                    secrets,
+		ConfigMapCache:             configmaps.Cache(),
+		ConfigMaps:                 configmaps,
+		ShareManagerCache:          sharemanagers.Cache(),
+		VolumeCache:                volumes.Cache(),
+		VolumeAttachmentCache:      volumeattachments.Cache(),
+		VolumeAttachments:          volumeattachments,
+		NetworkPolicyCache:         networkpolicies.Cache(),
+		NetworkPolicies:            networkpolicies,
+		NetworkFilsystems:          netfilesystems,
+		NetworkFSCache:             netfilesystems.Cache(),
+		recorder:                   recorder,
+		clock:                      clock.RealClock{},
 	}
 
-	c.NetworkFilsystems.OnChange(ctx, netFSHandlerName, c.OnNetworkFSChange)
-	c.NetworkFilsystems.OnRemove(ctx, netFSHandlerName, c.OnNetworkFSDelete)
+	c.PodCache.AddIndexer(podByClaimIndex, indexPodByClaim)
+	c.PersistentVolumeCache.AddIndexer(pvByVolumeHandleIndex, indexPVByVolumeHandle)
+	c.NetworkFSCache.AddIndexer(NetworkFSByVolumeIndex, indexNetworkFSByVolume)
+	c.NetworkFSCache.AddIndexer(networkFSByClaimIndex, indexNetworkFSByClaim)
+
+	c.NetworkFilsystems.OnChange(ctx, netFSHandlerName, metrics.Instrument(netFSHandlerName, c.OnNetworkFSChange))
+	c.NetworkFilsystems.OnRemove(ctx, netFSHandlerName, metrics.Instrument(netFSHandlerName, c.OnNetworkFSDelete))
+
+	// Longhorn objects of an RWX volume share the volume name, the NetworkFilesystem is indexed by it
+	relatedresource.Watch(ctx, netFSRelatedHandlerName, c.resolveLonghornObject, c.NetworkFilsystems, endpoints, sharemanagers, volumes, volumeattachments)
+	relatedresource.Watch(ctx, netFSRelatedHandlerName, c.resolvePersistentVolume, c.NetworkFilsystems, pvs)
+	relatedresource.Watch(ctx, netFSRelatedHandlerName, c.resolvePersistentVolumeClaim, c.NetworkFilsystems, pvcs)
+	relatedresource.Watch(ctx, netFSRelatedHandlerName, c.resolvePod, c.NetworkFilsystems, pods)
+	relatedresource.Watch(ctx, netFSRelatedHandlerName, c.resolveNetworkPolicy, c.NetworkFilsystems, networkpolicies)
+	// the Node status is updated on every heartbeat, only the changes of the placement and the access policy are relevant
+	nodes.OnChange(ctx, nodeHandlerName, c.OnNodeChange)
+	// the Service and the Endpoints exposing the NetworkFilesystem, and its binding Secret and ConfigMap, are owned by it
+	relatedresource.Watch(ctx, netFSRelatedHandlerName, relatedresource.OwnerResolver(true, networkfsv2.SchemeGroupVersion.String(), "NetworkFilesystem"), c.NetworkFilsystems, services, endpoints, secrets, configmaps)
+
+	if opt.ProbeInterval > 0 {
+		c.prober = newExportProber(opt, c.NetworkFSCache, c.NetworkFilsystems.Enqueue)
+		go c.prober.run(ctx)
+	}
 	return nil
 }
 
-func (c *Controller) OnNetworkFSChange(_ string, networkFS *networkfsv1.NetworkFilesystem) (*networkfsv1.NetworkFilesystem, error) {
-	if networkFS == nil || networkFS.DeletionTimestamp != nil {
-		logrus.Infof("Skip this round because the network filesystem %s is deleting", networkFS.Name)
+// resolveLonghornObject maps the Endpoints/ShareManager/Volume/VolumeAttachment in the Longhorn namespace to the NetworkFilesystem
+func (c *Controller) resolveLonghornObject(namespace, name string, _ runtime.Object) ([]relatedresource.Key, error) {
+	if namespace != utils.LHNameSpace {
 		return nil, nil
 	}
-	logrus.Infof("Handling network filesystem %s change event", networkFS.Name)
+	return c.resolveNetworkFS(name)
+}
 
-	if networkFS.Spec.DesiredState == networkFS.Status.State {
-		logrus.Infof("Skip this round because the network filesystem %s is already in desired state %s", networkFS.Name, networkFS.Spec.DesiredState)
+// resolvePersistentVolume maps the cluster-scoped PV to the NetworkFilesystem through its Longhorn volume,
+// and through its claim for the NetworkFilesystem referring to the PVC
+func (c *Controller) resolvePersistentVolume(_, _ string, obj runtime.Object) ([]relatedresource.Key, error) {
+	pv, ok := obj.(*corev1.PersistentVolume)
+	if !ok {
 		return nil, nil
 	}
+	var keys []relatedresource.Key
+	if volumeNames, _ := indexPVByVolumeHandle(pv); len(volumeNames) > 0 {
+		volumeKeys, err := c.resolveNetworkFS(volumeNames[0])
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, volumeKeys...)
+	}
+	if pv.Spec.ClaimRef != nil {
+		claimKeys, err := c.resolvePersistentVolumeClaim(pv.Spec.ClaimRef.Namespace, pv.Spec.ClaimRef.Name, nil)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, claimKeys...)
+	}
+	return keys, nil
+}
 
-	// Disabled -> Enabling -> Enabled -> Disabling -> Disabled
-	switch networkFS.Spec.DesiredState {
-	case networkfsv1.NetworkFSStateEnabled:
-		return c.enableNetworkFS(networkFS)
-	case networkfsv1.NetworkFSStateDisabled:
-		return c.disableNetworkFS(networkFS)
-	default:
-		logrus.Errorf("Unknown desired state %s for network filesystem %s", networkFS.Spec.DesiredState, networkFS.Name)
+// resolveNetworkFS maps the Longhorn volume to the NetworkFilesystems exporting it
+func (c *Controller) resolveNetworkFS(volumeName string) ([]relatedresource.Key, error) {
+	networkFSs, err := c.NetworkFSCache.GetByIndex(NetworkFSByVolumeIndex, volumeName)
+	if err != nil {
+		return nil, err
 	}
+	return networkFSKeys(networkFSs), nil
+}
 
-	return nil, nil
+func networkFSKeys(networkFSs []*networkfsv2.NetworkFilesystem) []relatedresource.Key {
+	keys := make([]relatedresource.Key, 0, len(networkFSs))
+	for _, networkFS := range networkFSs {
+		keys = append(keys, relatedresource.NewKey(networkFS.Namespace, networkFS.Name))
+	}
+	return keys
 }
 
-func (c *Controller) OnNetworkFSDelete(_ string, networkFS *networkfsv1.NetworkFilesystem) (*networkfsv1.NetworkFilesystem, error) {
+// OnNetworkFSChange reconciles the NetworkFilesystem, the whole status is computed from the observed state in one pass
+func (c *Controller) OnNetworkFSChange(_ string, networkFS *networkfsv2.NetworkFilesystem) (*networkfsv2.NetworkFilesystem, error) {
 	if networkFS == nil || networkFS.DeletionTimestamp != nil {
-		logrus.Infof("Skip this round because the network filesystem %s is deleting", networkFS.Name)
+		logrus.Infof("Skip this round because the network filesystem is deleted or deleting")
 		return nil, nil
 	}
-	logrus.Infof("Handling network filesystem %s delete event", networkFS.Name)
+	logrus.Debugf("Handling network filesystem %s change event", networkFS.Name)
 
-	return nil, nil
+	updated, err := c.reconcile(networkFS)
+	if err != nil {
+		c.recorder.Eventf(networkFS, corev1.EventTypeWarning, EventReasonReconcileError, "Failed to reconcile: %v", err)
+		return nil, err
+	}
+	return updated, nil
 }
 
-func (c *Controller) disableNetworkFS(networkFS *networkfsv1.NetworkFilesystem) (*networkfsv1.NetworkFilesystem, error) {
-	logrus.Infof("Disable network filesystem %s", networkFS.Name)
+// reconcile computes and updates the status of the network filesystem after writing or removing its attachment ticket
+func (c *Controller) reconcile(networkFS *networkfsv2.NetworkFilesystem) (*networkfsv2.NetworkFilesystem, error) {
+	observed, err := c.observe(networkFS)
+	if err != nil {
+		return nil, err
+	}
 
-	if !isDisabling(networkFS) {
-		if err := c.updateLHVolumeAttachment(networkFS, false); err != nil {
-			return nil, err
+	// Disabled -> Enabling -> Enabled -> Disabling -> Disabled
+	switch observed.desiredState {
+	case networkfsv2.NetworkFSStateEnabled, networkfsv2.NetworkFSStateDisabled:
+		if observed.volume == nil {
+			// unresolved or orphaned, nothing to attach or detach, see computeStatus for the Orphaned condition
+			break
 		}
-		networkFSCpy := networkFS.DeepCopy()
-		networkFSCpy.Status.State = networkfsv1.NetworkFSStateDisabling
-		if !reflect.DeepEqual(networkFS, networkFSCpy) {
-			return c.NetworkFilsystems.UpdateStatus(networkFSCpy)
+		if err := c.reconcileVolumeAttachment(networkFS, observed); err != nil {
+			return nil, err
 		}
+	default:
+		logrus.Errorf("Unknown desired state %s for network filesystem %s", observed.desiredState, networkFS.Name)
+		return nil, nil
 	}
-	return nil, nil
-}
 
-func (c *Controller) enableNetworkFS(networkFS *networkfsv1.NetworkFilesystem) (*networkfsv1.NetworkFilesystem, error) {
-	logrus.Infof("Enable network filesystem %s", networkFS.Name)
+	if observed.service, err = c.reconcileExposeService(networkFS); err != nil {
+		return nil, err
+	}
+	if observed.networkPolicy, err = c.reconcileAccessPolicy(networkFS, observed); err != nil {
+		return nil, err
+	}
 
-	// check endpoint status first
-	endpoint, err := c.endpointsClient.Get(utils.LHNameSpace, networkFS.Name, metav1.GetOptions{})
-	if err != nil && !errors.IsNotFound(err) {
-		logrus.Errorf("Failed to get endpoint %s: %v", networkFS.Name, err)
+	networkFSCpy := networkFS.DeepCopy()
+	networkFSCpy.Status = computeStatus(networkFS, observed)
+	if err := c.reconcileExposeEndpoints(networkFS, &networkFSCpy.Status, observed); err != nil {
+		return nil, err
+	}
+	if networkFSCpy.Status.Binding, err = c.reconcileBinding(networkFS, &networkFSCpy.Status); err != nil {
 		return nil, err
 	}
-	if !isEnabling(networkFS) || errors.IsNotFound(err) || endpoint.Subsets == nil || len(endpoint.Subsets) == 0 || len(endpoint.Subsets[0].Addresses) == 0 {
-		logrus.Infof("Endpoint %s is not ready, update lhVA to trigger export endpoint", networkFS.Name)
-		if err := c.updateLHVolumeAttachment(networkFS, true); err != nil {
+	// the ongoing transition is not always followed by an event of the related objects, check it again later
+	if delay, retry := retryAfter(&networkFSCpy.Status, observed); retry {
+		c.NetworkFilsystems.EnqueueAfter(networkFS.Namespace, networkFS.Name, delay)
+	}
+	if !reflect.DeepEqual(networkFS.Status, networkFSCpy.Status) {
+		logrus.Infof("Prepare to update networkfilesystem %s status %+v", networkFS.Name, networkFSCpy.Status)
+		updated, err := c.NetworkFilsystems.UpdateStatus(networkFSCpy)
+		if err != nil {
 			return nil, err
 		}
-		networkFSCpy := networkFS.DeepCopy()
-		networkFSCpy.Status.State = networkfsv1.NetworkFSStateEnabling
-		networkFSCpy.Status.Status = networkfsv1.EndpointStatusNotReady
-		networkFSCpy.Status.Type = networkfsv1.NetworkFSTypeNFS
-		if !reflect.DeepEqual(networkFS, networkFSCpy) {
-			return c.NetworkFilsystems.UpdateStatus(networkFSCpy)
-		}
+		recordStatusMetrics(&networkFS.Status, &updated.Status, networkFS.Namespace, networkFS.Name, observed.now.Time)
+		recordStatusEvents(c.recorder, updated, &networkFS.Status, &updated.Status)
+		return updated, nil
 	}
+	return networkFS, nil
+}
 
-	// LH RWX volume endpoint should only have one address and one port
-	if len(endpoint.Subsets) > 1 || len(endpoint.Subsets[0].Addresses) > 1 || len(endpoint.Subsets[0].Ports) > 1 {
-		return nil, fmt.Errorf("endpoint %s has more than one subSets", networkFS.Name)
+// recordStatusMetrics records the endpoint changes and the time the export took to be Enabled
+func recordStatusMetrics(prev, cur *networkfsv2.NetworkFSStatus, namespace, name string, now time.Time) {
+	if endpointAddress(prev) != "" && endpointAddress(cur) != "" && endpointAddress(prev) != endpointAddress(cur) {
+		metrics.IncEndpointChanges(namespace, name)
 	}
-	if endpoint.Subsets[0].Ports[0].Name != "nfs" {
-		return nil, fmt.Errorf("endpoint %s has no nfs port", networkFS.Name)
+	if prev.State != networkfsv2.NetworkFSStateEnabled && cur.State == networkfsv2.NetworkFSStateEnabled &&
+		prev.Transition != nil && prev.Transition.DesiredState == networkfsv2.NetworkFSStateEnabled {
+		metrics.ObserveEnableDuration(now.Sub(prev.Transition.StartTime.Time))
 	}
+}
 
-	pv, err := c.coreClient.PersistentVolume().Get(networkFS.Name, metav1.GetOptions{})
-	if err != nil && !errors.IsNotFound(err) {
-		logrus.Errorf("Failed to get persistent volume %s: %v", networkFS.Name, err)
-		return nil, err
+// reconcileVolumeAttachment writes or removes the attachment ticket of the network filesystem
+func (c *Controller) reconcileVolumeAttachment(networkFS *networkfsv2.NetworkFilesystem, observed *observedState) error {
+	if observed.desiredState == networkfsv2.NetworkFSStateEnabled {
+		return c.updateLHVolumeAttachment(networkFS, observed.volumeName, observed.placement, true)
 	}
-	opts := ""
-	if _, found := pv.Spec.CSI.VolumeAttributes["nfsOptions"]; found {
-		opts = pv.Spec.CSI.VolumeAttributes["nfsOptions"]
+	// keep the export while the volume is still used in the cluster, see computeStatus for the Blocked condition
+	if isDisableBlocked(networkFS, observed) {
+		return nil
 	}
-	// update network filesystem status
-	networkFSCpy := networkFS.DeepCopy()
-	networkFSCpy.Status.Endpoint = endpoint.Subsets[0].Addresses[0].IP
-	networkFSCpy.Status.State = networkfsv1.NetworkFSStateEnabled
-	networkFSCpy.Status.Type = networkfsv1.NetworkFSTypeNFS
-	networkFSCpy.Status.Status = networkfsv1.EndpointStatusReady
-	networkFSCpy.Status.MountOpts = opts
-	conds := networkfsv1.NetworkFSCondition{
-		Type:               networkfsv1.ConditionTypeReady,
-		Status:             corev1.ConditionTrue,
-		LastTransitionTime: metav1.Now(),
-		Reason:             "Endpoint is ready",
-		Message:            "Endpoint contains the corresponding address",
-	}
-	networkFSCpy.Status.NetworkFSConds = utils.UpdateNetworkFSConds(networkFSCpy.Status.NetworkFSConds, conds)
-	logrus.Infof("Prepare to update networkfilesystem %+v", networkFSCpy)
-	return c.NetworkFilsystems.UpdateStatus(networkFSCpy)
+	return c.updateLHVolumeAttachment(networkFS, observed.volumeName, nil, false)
 }
 
-func (c *Controller) updateLHVolumeAttachment(networkFS *networkfsv1.NetworkFilesystem, attach bool) error {
-	logrus.Infof("Update Longhorn volume attachment for network filesystem %s, attach: %v", networkFS.Name, attach)
+// OnNetworkFSDelete holds the finalizer until the attachment tickets of the network filesystem are removed
+// and the ShareManager is stopped, unless other attachers keep using the volume or the deletion is forced.
+func (c *Controller) OnNetworkFSDelete(_ string, networkFS *networkfsv2.NetworkFilesystem) (*networkfsv2.NetworkFilesystem, error) {
+	if networkFS == nil {
+		return nil, nil
+	}
+	logrus.Infof("Handling network filesystem %s delete event", networkFS.Name)
+	metrics.DeleteEndpointChanges(networkFS.Namespace, networkFS.Name)
+	metrics.DeleteExportProbe(networkFS.Namespace, networkFS.Name)
+
+	if err := c.removeAccessPolicy(networkFS); err != nil {
+		c.recorder.Eventf(networkFS, corev1.EventTypeWarning, EventReasonReconcileError, "Failed to remove the network policy: %v", err)
+		return nil, err
+	}
 
-	// get Longhorn volume attachment
-	lhva, err := c.lhClient.LonghornV1beta2().VolumeAttachments(utils.LHNameSpace).Get(context.Background(), networkFS.Name, metav1.GetOptions{})
+	released, err := c.release(networkFS)
 	if err != nil {
-		logrus.Errorf("Failed to get Longhorn volume attachment %s: %v", networkFS.Name, err)
-		return err
-	}
-
-	if attach {
-		return c.doAttachLHVolumeAttachment(networkFS, lhva)
-	}
-	return c.doDeattachLHVolumeAttachment(networkFS, lhva)
-	//lhvaCpy := lhva.DeepCopy()
-	//lhvaCpy.Spec.AttachmentTickets = map[string]*longhornv2.AttachmentTicket{}
-	//nodeID := ""
-	//if networkFS.Spec.PreferredNode != "" {
-	//	nodeID = networkFS.Spec.PreferredNode
-	//}
-	//csiTicketID := fmt.Sprintf("csi-%s", networkFS.Name)
-	//shareMgrTicketID := fmt.Sprintf("share-manager-controller-%s", networkFS.Name)
-
-	//// RWX volume should have two attachment tickets (CSI and share-manager)
-	//attachmentTicketCSI, ok := lhva.Spec.AttachmentTickets[csiTicketID]
-	//if !ok {
-	//	// Create new one
-	//	attachmentTicketCSI = &longhornv2.AttachmentTicket{
-	//		ID:     csiTicketID,
-	//		Type:   longhornv2.AttacherTypeCSIAttacher,
-	//		NodeID: nodeID,
-	//		Parameters: map[string]string{
-	//			longhornv2.AttachmentParameterDisableFrontend: "false",
-	//		},
-	//	}
-	//}
-	//lhvaCpy.Spec.AttachmentTickets[csiTicketID] = attachmentTicketCSI
-
-	//attachmentTicketSM, ok := lhva.Spec.AttachmentTickets[shareMgrTicketID]
-	//if !ok {
-	//	// Create new one
-	//	attachmentTicketSM = &longhornv2.AttachmentTicket{
-	//		ID:     shareMgrTicketID,
-	//		Type:   longhornv2.AttacherTypeShareManagerController,
-	//		NodeID: nodeID,
-	//		Parameters: map[string]string{
-	//			longhornv2.AttachmentParameterDisableFrontend: "false",
-	//		},
-	//	}
-	//}
-	//lhvaCpy.Spec.AttachmentTickets[shareMgrTicketID] = attachmentTicketSM
-
-	//if !reflect.DeepEqual(lhva, lhvaCpy) {
-	//	if _, err := c.lhClient.LonghornV1beta2().VolumeAttachments(utils.LHNameSpace).Update(context.Background(), lhvaCpy, metav1.UpdateOptions{}); err != nil {
-	//		logrus.Errorf("Failed to update Longhorn volume attachment %s: %v", networkFS.Name, err)
-	//		return err
-	//	}
-	//}
-
-	//return nil
+		var waiting *waitingError
+		if stderrors.As(err, &waiting) {
+			c.recorder.Event(networkFS, corev1.EventTypeNormal, EventReasonWaitingForShareManager, waiting.Error())
+		} else {
+			c.recorder.Eventf(networkFS, corev1.EventTypeWarning, EventReasonReconcileError, "Failed to release: %v", err)
+		}
+		return nil, err
+	}
+	c.recorder.Event(networkFS, corev1.EventTypeNormal, EventReasonReleased, "Network filesystem is released")
+	return released, nil
 }
 
-func (c *Controller) doDeattachLHVolumeAttachment(networkFS *networkfsv1.NetworkFilesystem, lhva *longhornv2.VolumeAttachment) error {
-	lhvaCpy := lhva.DeepCopy()
-	lhvaCpy.Spec.AttachmentTickets = map[string]*longhornv2.AttachmentTicket{}
-	if !reflect.DeepEqual(lhva, lhvaCpy) {
-		if _, err := c.lhClient.LonghornV1beta2().VolumeAttachments(utils.LHNameSpace).Update(context.Background(), lhvaCpy, metav1.UpdateOptions{}); err != nil {
-			logrus.Errorf("Failed to update Longhorn volume attachment %s: %v", networkFS.Name, err)
-			return err
+// release removes the attachment tickets and checks the ShareManager of the deleted network filesystem
+func (c *Controller) release(networkFS *networkfsv2.NetworkFilesystem) (*networkfsv2.NetworkFilesystem, error) {
+	volumeName := releaseVolumeName(networkFS)
+	if volumeName == "" {
+		logrus.Infof("Network filesystem %s never resolved its volume, release it", networkFS.Name)
+		return networkFS, nil
+	}
+
+	lhva, err := c.VolumeAttachmentCache.Get(utils.LHNameSpace, volumeName)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			logrus.Infof("Longhorn volume attachment %s is gone, release network filesystem %s", volumeName, networkFS.Name)
+			return networkFS, nil
 		}
+		logrus.Errorf("Failed to get Longhorn volume attachment %s: %v", volumeName, err)
+		return nil, err
 	}
-	return nil
+	if err := c.doDeattachLHVolumeAttachment(networkFS, lhva); err != nil {
+		return nil, err
+	}
+
+	if networkFS.Annotations[networkfsv2.AnnotationForceDelete] == "true" {
+		logrus.Infof("Force delete network filesystem %s without waiting for the ShareManager", networkFS.Name)
+		return networkFS, nil
+	}
+	if others := foreignTicketIDs(networkFS, lhva); len(others) > 0 {
+		logrus.Infof("Longhorn volume %s is still used by %v, release network filesystem %s", volumeName, others, networkFS.Name)
+		return networkFS, nil
+	}
+
+	sharemanager, err := c.ShareManagerCache.Get(utils.LHNameSpace, volumeName)
+	if err != nil && !errors.IsNotFound(err) {
+		logrus.Errorf("Failed to get sharemanager %s: %v", volumeName, err)
+		return nil, err
+	}
+	if err == nil && !isShareManagerStopped(sharemanager) {
+		// keep the finalizer, the ShareManager change enqueues the network filesystem again
+		return nil, &waitingError{reason: fmt.Sprintf("waiting for sharemanager %s to stop, current state is %s", volumeName, sharemanager.Status.State)}
+	}
+
+	logrus.Infof("ShareManager %s is stopped, release network filesystem %s", volumeName, networkFS.Name)
+	return networkFS, nil
 }
 
-func (c *Controller) doAttachLHVolumeAttachment(networkFS *networkfsv1.NetworkFilesystem, lhva *longhornv2.VolumeAttachment) error {
-	lhvaCpy := lhva.DeepCopy()
-	lhvaCpy.Spec.AttachmentTickets = map[string]*longhornv2.AttachmentTicket{}
-	nodeID := ""
-	if networkFS.Spec.PreferredNode != "" {
-		nodeID = networkFS.Spec.PreferredNode
+// observe collects the related objects of the network filesystem, missing objects are left nil
+func (c *Controller) observe(networkFS *networkfsv2.NetworkFilesystem) (*observedState, error) {
+	observed := &observedState{
+		now:               metav1.NewTime(c.clock.Now()),
+		transitionTimeout: transitionTimeout(networkFS, c.transitionTimeout),
 	}
-	csiTicketID := fmt.Sprintf("csi-%s", networkFS.Name)
-	shareMgrTicketID := fmt.Sprintf("share-manager-controller-%s", networkFS.Name)
+	observed.schedule = scheduleStatus(networkFS, observed.now)
+	observed.idle = idleStatus(networkFS)
+	observed.desiredState, observed.desiredStateReason, observed.autoDisableTime =
+		effectiveDesiredState(networkFS, observed.schedule, observed.idle, observed.now, consumerGracePeriod(networkFS, c.consumerGracePeriod))
 
-	// RWX volume should have two attachment tickets (CSI and share-manager)
-	attachmentTicketCSI, ok := lhva.Spec.AttachmentTickets[csiTicketID]
-	if !ok {
-		// Create new one
-		attachmentTicketCSI = &longhornv2.AttachmentTicket{
-			ID:     csiTicketID,
-			Type:   longhornv2.AttacherTypeCSIAttacher,
-			NodeID: nodeID,
-			Parameters: map[string]string{
-				longhornv2.AttachmentParameterDisableFrontend: "false",
-			},
+	pv, volumeName, err := c.resolveVolume(networkFS)
+	if err != nil {
+		unresolved, ok := err.(*unresolvedError)
+		if !ok {
+			logrus.Errorf("Failed to resolve the volume of network filesystem %s: %v", networkFS.Name, err)
+			return nil, err
 		}
+		// nothing else to observe, the PVC change enqueues the network filesystem again
+		observed.unresolved = unresolved
+		return observed, nil
 	}
-	lhvaCpy.Spec.AttachmentTickets[csiTicketID] = attachmentTicketCSI
+	observed.pv = pv
+	observed.volumeName = volumeName
 
-	attachmentTicketSM, ok := lhva.Spec.AttachmentTickets[shareMgrTicketID]
-	if !ok {
-		// Create new one
-		attachmentTicketSM = &longhornv2.AttachmentTicket{
-			ID:     shareMgrTicketID,
-			Type:   longhornv2.AttacherTypeShareManagerController,
-			NodeID: nodeID,
-			Parameters: map[string]string{
-				longhornv2.AttachmentParameterDisableFrontend: "false",
-			},
-		}
+	endpoint, err := c.EndpointCache.Get(utils.LHNameSpace, volumeName)
+	if err != nil && !errors.IsNotFound(err) {
+		logrus.Errorf("Failed to get endpoint %s: %v", volumeName, err)
+		return nil, err
+	}
+	if err == nil {
+		observed.endpoint = endpoint
+	}
+
+	sharemanager, err := c.ShareManagerCache.Get(utils.LHNameSpace, volumeName)
+	if err != nil && !errors.IsNotFound(err) {
+		logrus.Errorf("Failed to get sharemanager %s: %v", volumeName, err)
+		return nil, err
+	}
+	if err == nil {
+		observed.shareManager = sharemanager
+	}
+
+	volume, err := c.VolumeCache.Get(utils.LHNameSpace, volumeName)
+	if err != nil && !errors.IsNotFound(err) {
+		logrus.Errorf("Failed to get Longhorn volume %s: %v", volumeName, err)
+		return nil, err
+	}
+	if err == nil {
+		observed.volume = volume
+	}
+
+	lhva, err := c.VolumeAttachmentCache.Get(utils.LHNameSpace, volumeName)
+	if err != nil && !errors.IsNotFound(err) {
+		logrus.Errorf("Failed to get Longhorn volume attachment %s: %v", volumeName, err)
+		return nil, err
+	}
+	if err == nil {
+		observed.volumeAttachment = lhva
 	}
-	lhvaCpy.Spec.AttachmentTickets[shareMgrTicketID] = attachmentTicketSM
 
-	if !reflect.DeepEqual(lhva, lhvaCpy) {
-		if _, err := c.lhClient.LonghornV1beta2().VolumeAttachments(utils.LHNameSpace).Update(context.Background(), lhvaCpy, metav1.UpdateOptions{}); err != nil {
-			logrus.Errorf("Failed to update Longhorn volume attachment %s: %v", networkFS.Name, err)
-			return err
+	if hasPlacement(networkFS) || isNodePortExposed(networkFS) {
+		observed.nodes, err = c.NodeCache.List(labels.Everything())
+		if err != nil {
+			logrus.Errorf("Failed to list nodes: %v", err)
+			return nil, err
 		}
 	}
-	return nil
-}
+	if hasPlacement(networkFS) {
+		observed.placement = placementStatus(networkFS, observed.nodes, observed.volumeAttachment, observed.now, c.failbackDelay)
+	}
+
+	observed.probe = c.prober.result(networkFS)
+
+	observed.pods, err = c.observeConsumers(observed.pv)
+	if err != nil {
+		logrus.Errorf("Failed to get the pods using persistent volume %s: %v", volumeName, err)
+		return nil, err
+	}
 
-func isEnabling(networkFS *networkfsv1.NetworkFilesystem) bool {
-	return networkFS.Status.State == networkfsv1.NetworkFSStateEnabling
+	return observed, nil
 }
 
-func isDisabling(networkFS *networkfsv1.NetworkFilesystem) bool {
-	return networkFS.Status.State == networkfsv1.NetworkFSStateDisabling
+// observedState is the snapshot of the related objects used to compute the status
+type observedState struct {
+	// the Longhorn volume resolved from the reference, empty if it is unresolved
+	volumeName       string
+	unresolved       *unresolvedError
+	endpoint         *corev1.Endpoints
+	service          *corev1.Service
+	networkPolicy    *networkingv1.NetworkPolicy
+	shareManager     *longhornv2.ShareManager
+	pv               *corev1.PersistentVolume
+	volume           *longhornv2.Volume
+	volumeAttachment *longhornv2.VolumeAttachment
+	pods             []*corev1.Pod
+	probe            *probeResult
+	// the nodes, only listed for the placement and the node port
+	nodes []*corev1.Node
+
+	now               metav1.Time
+	transitionTimeout time.Duration
+	schedule          *networkfsv2.NetworkFSScheduleStatus
+	idle              *networkfsv2.NetworkFSIdleStatus
+	placement         *networkfsv2.NetworkFSPlacementStatus
+	// the effective desired state, see effectiveDesiredState
+	desiredState       networkfsv2.NetworkFSState
+	desiredStateReason string
+	autoDisableTime    *metav1.Time
 }
@@ -0,0 +1,207 @@
+package networkfilesystem
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/harvester/networkfs-manager/pkg/activity"
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/schedule"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+// consumerGracePeriod returns the period the export is kept after the last consumer is unregistered, the spec
+// overrides the global default
+func consumerGracePeriod(networkFS *networkfsv2.NetworkFilesystem, defaultPeriod time.Duration) time.Duration {
+	if networkFS.Spec.ConsumerGracePeriod != nil {
+		return networkFS.Spec.ConsumerGracePeriod.Duration
+	}
+	return defaultPeriod
+}
+
+// effectiveDesiredState returns the desired state the network filesystem is reconciled to, with its reason and the
+// time the export is automatically disabled. The schedule overrides spec.desiredState while it is set. The registered
+// consumers keep the export enabled regardless of both, and for the grace period after the last one is unregistered.
+// The expired lease disables the export regardless of all of them, and so does the idle timeout.
+func effectiveDesiredState(networkFS *networkfsv2.NetworkFilesystem, schedule *networkfsv2.NetworkFSScheduleStatus, idle *networkfsv2.NetworkFSIdleStatus, now metav1.Time, gracePeriod time.Duration) (networkfsv2.NetworkFSState, string, *metav1.Time) {
+	state, reason, disableTime := consumersDesiredState(networkFS, schedule, now, gracePeriod)
+	if state != networkfsv2.NetworkFSStateEnabled {
+		return state, reason, disableTime
+	}
+	if isLeaseExpired(networkFS, now) {
+		return networkfsv2.NetworkFSStateDisabled, networkfsv2.DesiredStateReasonLeaseExpired, nil
+	}
+	if isIdle(networkFS, idle, now) {
+		return networkfsv2.NetworkFSStateDisabled, networkfsv2.DesiredStateReasonIdle, nil
+	}
+	return state, reason, disableTime
+}
+
+func consumersDesiredState(networkFS *networkfsv2.NetworkFilesystem, schedule *networkfsv2.NetworkFSScheduleStatus, now metav1.Time, gracePeriod time.Duration) (networkfsv2.NetworkFSState, string, *metav1.Time) {
+	state, reason := scheduledDesiredState(networkFS, schedule)
+	if state == networkfsv2.NetworkFSStateEnabled {
+		return state, reason, nil
+	}
+	if len(networkFS.Spec.Consumers) > 0 {
+		return networkfsv2.NetworkFSStateEnabled, networkfsv2.DesiredStateReasonConsumers, nil
+	}
+
+	switch networkFS.Status.DesiredStateReason {
+	case networkfsv2.DesiredStateReasonConsumers, networkfsv2.DesiredStateReasonGracePeriod:
+	default:
+		// the export was not enabled for the consumers
+		return state, reason, nil
+	}
+	disableTime := networkFS.Status.AutoDisableTime
+	if disableTime == nil {
+		t := metav1.NewTime(now.Add(gracePeriod)).Rfc3339Copy()
+		disableTime = &t
+	}
+	if !now.Before(disableTime) {
+		return state, reason, nil
+	}
+	return networkfsv2.NetworkFSStateEnabled, networkfsv2.DesiredStateReasonGracePeriod, disableTime
+}
+
+// scheduledDesiredState returns the desired state of the schedule, spec.desiredState if there is no valid schedule
+func scheduledDesiredState(networkFS *networkfsv2.NetworkFilesystem, schedule *networkfsv2.NetworkFSScheduleStatus) (networkfsv2.NetworkFSState, string) {
+	switch {
+	case schedule == nil || schedule.Error != "":
+		return networkFS.Spec.DesiredState, networkfsv2.DesiredStateReasonSpec
+	case schedule.Open:
+		return networkfsv2.NetworkFSStateEnabled, networkfsv2.DesiredStateReasonScheduleOpen
+	}
+	return networkfsv2.NetworkFSStateDisabled, networkfsv2.DesiredStateReasonScheduleClosed
+}
+
+// scheduleStatus evaluates the schedule of the network filesystem at the time, nil if it has no schedule
+func scheduleStatus(networkFS *networkfsv2.NetworkFilesystem, now metav1.Time) *networkfsv2.NetworkFSScheduleStatus {
+	if networkFS.Spec.Schedule == nil {
+		return nil
+	}
+	parsed, err := schedule.Parse(networkFS.Spec.Schedule)
+	if err != nil {
+		// the webhook rejects the invalid schedule, it is only reported for the objects created without it
+		return &networkfsv2.NetworkFSScheduleStatus{Error: err.Error()}
+	}
+	open, next := parsed.At(now.Time)
+	status := &networkfsv2.NetworkFSScheduleStatus{Open: open}
+	if !next.IsZero() {
+		nextTime := metav1.NewTime(next.UTC()).Rfc3339Copy()
+		status.NextTransitionTime = &nextTime
+	}
+	return status
+}
+
+// scheduleRetryAfter returns the delay before the next transition of the schedule
+func scheduleRetryAfter(status *networkfsv2.NetworkFSStatus, now metav1.Time) (time.Duration, bool) {
+	if status.Schedule == nil || status.Schedule.NextTransitionTime == nil {
+		return 0, false
+	}
+	delay := status.Schedule.NextTransitionTime.Sub(now.Time)
+	if delay < minRetryInterval {
+		delay = minRetryInterval
+	}
+	return delay, true
+}
+
+// leaseExpireTime returns the time the lease of the network filesystem expires, nil if it has no lease
+func leaseExpireTime(networkFS *networkfsv2.NetworkFilesystem) *metav1.Time {
+	lease := networkFS.Spec.Lease
+	if lease == nil {
+		return nil
+	}
+	renewTime := networkFS.CreationTimestamp
+	if lease.RenewTime != nil {
+		renewTime = *lease.RenewTime
+	}
+	// rounded up to the second as the status holds it, so the check at the expire time of the status finds it expired
+	expireTime := metav1.NewTime(renewTime.Add(lease.Duration.Duration + time.Second - 1)).Rfc3339Copy()
+	return &expireTime
+}
+
+func isLeaseExpired(networkFS *networkfsv2.NetworkFilesystem, now metav1.Time) bool {
+	expireTime := leaseExpireTime(networkFS)
+	return expireTime != nil && !now.Before(expireTime)
+}
+
+// leaseStatus returns the status of the lease. The remaining time is rounded up to the minute, so the status is not
+// rewritten on every check, see leaseRetryAfter.
+func leaseStatus(networkFS *networkfsv2.NetworkFilesystem, now metav1.Time) *networkfsv2.NetworkFSLeaseStatus {
+	expireTime := leaseExpireTime(networkFS)
+	if expireTime == nil {
+		return nil
+	}
+	status := &networkfsv2.NetworkFSLeaseStatus{ExpireTime: *expireTime}
+	if remaining := expireTime.Sub(now.Time); remaining > 0 {
+		status.Remaining = metav1.Duration{Duration: (remaining + time.Minute - 1).Truncate(time.Minute)}
+	}
+	return status
+}
+
+// leaseRetryAfter returns the delay before the remaining time of the lease is rounded to the next minute, or before
+// the lease expires
+func leaseRetryAfter(status *networkfsv2.NetworkFSStatus, now metav1.Time) (time.Duration, bool) {
+	if status.Lease == nil {
+		return 0, false
+	}
+	remaining := status.Lease.ExpireTime.Sub(now.Time)
+	if remaining <= 0 {
+		return 0, false
+	}
+	if delay := remaining % time.Minute; delay > 0 {
+		return delay, true
+	}
+	return time.Minute, true
+}
+
+// isIdle returns true if the idle export is disabled. It stays disabled until the spec changes, or the export is
+// requested again by the schedule, the lease or the consumers once they disabled it meanwhile.
+func isIdle(networkFS *networkfsv2.NetworkFilesystem, idle *networkfsv2.NetworkFSIdleStatus, now metav1.Time) bool {
+	if idle == nil {
+		return false
+	}
+	if networkFS.Status.DesiredStateReason == networkfsv2.DesiredStateReasonIdle && networkFS.Generation == networkFS.Status.ObservedGeneration {
+		return true
+	}
+	return idle.DisableTime != nil && !now.Before(idle.DisableTime)
+}
+
+// idleStatus returns the client activity of the network filesystem, nil if it has no idle timeout. The idle timeout
+// counts from the last activity, or from the time the export got ready if no client was seen since.
+func idleStatus(networkFS *networkfsv2.NetworkFilesystem) *networkfsv2.NetworkFSIdleStatus {
+	if networkFS.Spec.IdleTimeout == nil {
+		return nil
+	}
+	status := &networkfsv2.NetworkFSIdleStatus{}
+	if last, ok := activity.LastActivity(networkFS); ok {
+		lastActivityTime := metav1.NewTime(last)
+		status.LastActivityTime = &lastActivityTime
+	}
+
+	ready := utils.GetNetworkFSCondition(networkFS.Status.NetworkFSConds, networkfsv2.ConditionTypeReady)
+	if networkFS.Status.State != networkfsv2.NetworkFSStateEnabled || ready == nil || ready.Status != corev1.ConditionTrue {
+		return status
+	}
+	since := ready.LastTransitionTime
+	if status.LastActivityTime != nil && status.LastActivityTime.After(since.Time) {
+		since = *status.LastActivityTime
+	}
+	disableTime := metav1.NewTime(since.Add(networkFS.Spec.IdleTimeout.Duration)).Rfc3339Copy()
+	status.DisableTime = &disableTime
+	return status
+}
+
+// idleRetryAfter returns the delay before the idle export is disabled
+func idleRetryAfter(status *networkfsv2.NetworkFSStatus, now metav1.Time) (time.Duration, bool) {
+	if status.Idle == nil || status.Idle.DisableTime == nil || status.DesiredStateReason == networkfsv2.DesiredStateReasonIdle {
+		return 0, false
+	}
+	delay := status.Idle.DisableTime.Sub(now.Time)
+	if delay < minRetryInterval {
+		delay = minRetryInterval
+	}
+	return delay, true
+}
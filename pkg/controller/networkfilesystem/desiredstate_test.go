@@ -0,0 +1,119 @@
+package networkfilesystem
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+)
+
+func scheduledNetworkFS(timeZone string, windows ...networkfsv2.NetworkFSScheduleWindow) *networkfsv2.NetworkFilesystem {
+	return &networkfsv2.NetworkFilesystem{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "harvester-system", Name: "pvc-1"},
+		Spec: networkfsv2.NetworkFSSpec{
+			DesiredState: networkfsv2.NetworkFSStateDisabled,
+			Schedule:     &networkfsv2.NetworkFSSchedule{TimeZone: timeZone, Windows: windows},
+		},
+	}
+}
+
+func TestScheduleRequeue(t *testing.T) {
+	// the window opens at 22:00 in Berlin, 21:00 UTC in winter
+	networkFS := scheduledNetworkFS("Europe/Berlin", networkfsv2.NetworkFSScheduleWindow{Start: "0 22 * * *", Duration: metav1.Duration{Duration: 2 * time.Hour}})
+	clock := clocktesting.NewFakePassiveClock(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC))
+
+	steps := []struct {
+		wantState  networkfsv2.NetworkFSState
+		wantReason string
+		wantDelay  time.Duration
+	}{
+		{wantState: networkfsv2.NetworkFSStateDisabled, wantReason: networkfsv2.DesiredStateReasonScheduleClosed, wantDelay: 9 * time.Hour},
+		{wantState: networkfsv2.NetworkFSStateEnabled, wantReason: networkfsv2.DesiredStateReasonScheduleOpen, wantDelay: 2 * time.Hour},
+		{wantState: networkfsv2.NetworkFSStateDisabled, wantReason: networkfsv2.DesiredStateReasonScheduleClosed, wantDelay: 22 * time.Hour},
+		{wantState: networkfsv2.NetworkFSStateEnabled, wantReason: networkfsv2.DesiredStateReasonScheduleOpen, wantDelay: 2 * time.Hour},
+	}
+	for i, step := range steps {
+		now := metav1.NewTime(clock.Now())
+		status := &networkfsv2.NetworkFSStatus{Schedule: scheduleStatus(networkFS, now)}
+		state, reason := scheduledDesiredState(networkFS, status.Schedule)
+		if state != step.wantState || reason != step.wantReason {
+			t.Errorf("step %d at %s: desired state = %s (%s), want %s (%s)", i, now.UTC(), state, reason, step.wantState, step.wantReason)
+		}
+		delay, retry := scheduleRetryAfter(status, now)
+		if !retry || delay != step.wantDelay {
+			t.Fatalf("step %d at %s: retry after %s (%t), want %s", i, now.UTC(), delay, retry, step.wantDelay)
+		}
+		// the requeue lands on the transition
+		clock.SetTime(clock.Now().Add(delay))
+	}
+}
+
+func TestScheduleRetryAfter(t *testing.T) {
+	now := metav1.NewTime(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC))
+	at := func(d time.Duration) *metav1.Time {
+		t := metav1.NewTime(now.Add(d))
+		return &t
+	}
+
+	tests := []struct {
+		name      string
+		schedule  *networkfsv2.NetworkFSScheduleStatus
+		wantDelay time.Duration
+		wantRetry bool
+	}{
+		{
+			name: "no schedule",
+		},
+		{
+			name:     "windows never open again",
+			schedule: &networkfsv2.NetworkFSScheduleStatus{},
+		},
+		{
+			name:     "invalid schedule",
+			schedule: &networkfsv2.NetworkFSScheduleStatus{Error: "no window is scheduled"},
+		},
+		{
+			name:      "next transition",
+			schedule:  &networkfsv2.NetworkFSScheduleStatus{Open: true, NextTransitionTime: at(time.Hour)},
+			wantDelay: time.Hour,
+			wantRetry: true,
+		},
+		{
+			name:      "imminent transition",
+			schedule:  &networkfsv2.NetworkFSScheduleStatus{NextTransitionTime: at(time.Second)},
+			wantDelay: minRetryInterval,
+			wantRetry: true,
+		},
+		{
+			name:      "transition in the past",
+			schedule:  &networkfsv2.NetworkFSScheduleStatus{NextTransitionTime: at(-time.Minute)},
+			wantDelay: minRetryInterval,
+			wantRetry: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, retry := scheduleRetryAfter(&networkfsv2.NetworkFSStatus{Schedule: tt.schedule}, now)
+			if delay != tt.wantDelay || retry != tt.wantRetry {
+				t.Errorf("retry after %s (%t), want %s (%t)", delay, retry, tt.wantDelay, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestScheduleStatusInvalid(t *testing.T) {
+	networkFS := scheduledNetworkFS("Mars/Olympus", networkfsv2.NetworkFSScheduleWindow{Start: "@daily", Duration: metav1.Duration{Duration: time.Hour}})
+	status := scheduleStatus(networkFS, metav1.Now())
+	if status == nil || status.Error == "" || status.NextTransitionTime != nil {
+		t.Fatalf("schedule status = %+v, want the error", status)
+	}
+	// the invalid schedule does not override spec.desiredState
+	state, reason := scheduledDesiredState(networkFS, status)
+	if state != networkfsv2.NetworkFSStateDisabled || reason != networkfsv2.DesiredStateReasonSpec {
+		t.Errorf("desired state = %s (%s), want %s (%s)", state, reason, networkfsv2.NetworkFSStateDisabled, networkfsv2.DesiredStateReasonSpec)
+	}
+}
@@ -0,0 +1,152 @@
+package networkfilesystem
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+// Reasons of the events recorded on the NetworkFilesystem
+const (
+	EventReasonEnableRequested     = "EnableRequested"
+	EventReasonDisableRequested    = "DisableRequested"
+	EventReasonTicketWritten       = "TicketWritten"
+	EventReasonTicketRemoved       = "TicketRemoved"
+	EventReasonEndpointAssigned    = "EndpointAssigned"
+	EventReasonEndpointChanged     = "EndpointChanged"
+	EventReasonEndpointLost        = "EndpointLost"
+	EventReasonShareManagerStopped = "ShareManagerStopped"
+	EventReasonDisableBlocked      = "DisableBlocked"
+	EventReasonTransitionFailed    = "TransitionFailed"
+	EventReasonVolumeOrphaned      = "VolumeOrphaned"
+	EventReasonExportUnreachable   = "ExportUnreachable"
+	EventReasonExportReachable     = "ExportReachable"
+	EventReasonReconcileError      = "ReconcileError"
+	EventReasonReleased            = "Released"
+	EventReasonExposed             = "Exposed"
+	EventReasonConsumersGone       = "ConsumersGone"
+	EventReasonLeaseExpired        = "LeaseExpired"
+	EventReasonLeaseRenewed        = "LeaseRenewed"
+	EventReasonScheduleOpened      = "ScheduleOpened"
+	EventReasonScheduleClosed      = "ScheduleClosed"
+	EventReasonIdle                = "Idle"
+	EventReasonExportMoving        = "ExportMoving"
+
+	EventReasonWaitingForShareManager = "WaitingForShareManager"
+)
+
+// waitingError is returned while the deletion waits for the ShareManager to stop, it is not a failure
+type waitingError struct {
+	reason string
+}
+
+func (e *waitingError) Error() string {
+	return e.reason
+}
+
+// recordStatusEvents records the events of the transitions between the previous and the current status
+func recordStatusEvents(recorder record.EventRecorder, networkFS *networkfsv2.NetworkFilesystem, prev, cur *networkfsv2.NetworkFSStatus) {
+	if cur.Transition != nil && (prev.Transition == nil || prev.Transition.DesiredState != cur.Transition.DesiredState) {
+		if cur.Transition.DesiredState == networkfsv2.NetworkFSStateEnabled {
+			recorder.Event(networkFS, corev1.EventTypeNormal, EventReasonEnableRequested, "Enabling the export")
+		} else {
+			recorder.Event(networkFS, corev1.EventTypeNormal, EventReasonDisableRequested, "Disabling the export")
+		}
+	}
+
+	if cur.Schedule != nil && cur.Schedule.Error == "" && (prev.Schedule == nil || prev.Schedule.Open != cur.Schedule.Open) {
+		until := "no other window is scheduled"
+		if cur.Schedule.NextTransitionTime != nil {
+			until = "until " + cur.Schedule.NextTransitionTime.UTC().Format(time.RFC3339)
+		}
+		if cur.Schedule.Open {
+			recorder.Eventf(networkFS, corev1.EventTypeNormal, EventReasonScheduleOpened, "Schedule window is open, %s", until)
+		} else {
+			recorder.Eventf(networkFS, corev1.EventTypeNormal, EventReasonScheduleClosed, "Schedule window is closed, %s", until)
+		}
+	}
+
+	// the disable of the expired lease and the idle export is deferred while the volume is in use
+	disabled := "the export is disabled"
+	if utils.IsNetworkFSConditionTrue(cur.NetworkFSConds, networkfsv2.ConditionTypeBlocked) {
+		disabled = "the export is disabled once the volume is not in use"
+	}
+	switch {
+	case cur.DesiredStateReason == networkfsv2.DesiredStateReasonLeaseExpired && prev.DesiredStateReason != networkfsv2.DesiredStateReasonLeaseExpired:
+		recorder.Eventf(networkFS, corev1.EventTypeWarning, EventReasonLeaseExpired, "Lease expired at %s, %s",
+			cur.Lease.ExpireTime.UTC().Format(time.RFC3339), disabled)
+	case prev.DesiredStateReason == networkfsv2.DesiredStateReasonLeaseExpired && cur.DesiredStateReason != networkfsv2.DesiredStateReasonLeaseExpired && cur.Lease != nil:
+		recorder.Eventf(networkFS, corev1.EventTypeNormal, EventReasonLeaseRenewed, "Lease is renewed until %s",
+			cur.Lease.ExpireTime.UTC().Format(time.RFC3339))
+	}
+	if cur.DesiredStateReason == networkfsv2.DesiredStateReasonIdle && prev.DesiredStateReason != networkfsv2.DesiredStateReasonIdle {
+		since := "it got ready"
+		if cur.Idle != nil && cur.Idle.LastActivityTime != nil {
+			since = cur.Idle.LastActivityTime.UTC().Format(time.RFC3339)
+		}
+		recorder.Eventf(networkFS, corev1.EventTypeNormal, EventReasonIdle, "No client is connected since %s, %s", since, disabled)
+	}
+	if cur.AutoDisableTime != nil && prev.AutoDisableTime == nil {
+		recorder.Eventf(networkFS, corev1.EventTypeNormal, EventReasonConsumersGone, "Last consumer is unregistered, the export is disabled at %s",
+			cur.AutoDisableTime.UTC().Format(time.RFC3339))
+	}
+
+	switch {
+	case endpointAddress(prev) == "" && endpointAddress(cur) != "":
+		recorder.Eventf(networkFS, corev1.EventTypeNormal, EventReasonEndpointAssigned, "Export is served at %s", endpointAddress(cur))
+	case endpointAddress(prev) != "" && endpointAddress(cur) != "" && endpointAddress(prev) != endpointAddress(cur):
+		recorder.Eventf(networkFS, corev1.EventTypeWarning, EventReasonEndpointChanged, "Export moved from %s to %s, the clients need to remount", endpointAddress(prev), endpointAddress(cur))
+	case endpointAddress(prev) != "" && endpointAddress(cur) == "" && cur.State != networkfsv2.NetworkFSStateDisabled && cur.State != networkfsv2.NetworkFSStateDisabling:
+		recorder.Eventf(networkFS, corev1.EventTypeWarning, EventReasonEndpointLost, "Export at %s is lost", endpointAddress(prev))
+	}
+
+	if prev.State == networkfsv2.NetworkFSStateDisabling && cur.State == networkfsv2.NetworkFSStateDisabled {
+		recorder.Event(networkFS, corev1.EventTypeNormal, EventReasonShareManagerStopped, "ShareManager is stopped, the export is disabled")
+	}
+
+	if prev.State != networkfsv2.NetworkFSStateFailed && cur.State == networkfsv2.NetworkFSStateFailed {
+		recorder.Event(networkFS, corev1.EventTypeWarning, EventReasonTransitionFailed, conditionMessage(cur.NetworkFSConds, networkfsv2.ConditionTypeDegraded))
+	}
+
+	if becameTrue(prev.NetworkFSConds, cur.NetworkFSConds, networkfsv2.ConditionTypeBlocked) {
+		recorder.Event(networkFS, corev1.EventTypeWarning, EventReasonDisableBlocked, conditionMessage(cur.NetworkFSConds, networkfsv2.ConditionTypeBlocked))
+	}
+	if becameTrue(prev.NetworkFSConds, cur.NetworkFSConds, networkfsv2.ConditionTypeOrphaned) {
+		recorder.Event(networkFS, corev1.EventTypeWarning, EventReasonVolumeOrphaned, conditionMessage(cur.NetworkFSConds, networkfsv2.ConditionTypeOrphaned))
+	}
+
+	switch {
+	case conditionStatus(prev.NetworkFSConds, networkfsv2.ConditionTypeReachable) != corev1.ConditionFalse &&
+		conditionStatus(cur.NetworkFSConds, networkfsv2.ConditionTypeReachable) == corev1.ConditionFalse:
+		recorder.Event(networkFS, corev1.EventTypeWarning, EventReasonExportUnreachable, conditionMessage(cur.NetworkFSConds, networkfsv2.ConditionTypeReachable))
+	case conditionStatus(prev.NetworkFSConds, networkfsv2.ConditionTypeReachable) == corev1.ConditionFalse &&
+		conditionStatus(cur.NetworkFSConds, networkfsv2.ConditionTypeReachable) == corev1.ConditionTrue:
+		recorder.Event(networkFS, corev1.EventTypeNormal, EventReasonExportReachable, conditionMessage(cur.NetworkFSConds, networkfsv2.ConditionTypeReachable))
+	}
+}
+
+func becameTrue(prev, cur []networkfsv2.NetworkFSCondition, condType networkfsv2.ConditionType) bool {
+	return !utils.IsNetworkFSConditionTrue(prev, condType) && utils.IsNetworkFSConditionTrue(cur, condType)
+}
+
+func conditionStatus(conds []networkfsv2.NetworkFSCondition, condType networkfsv2.ConditionType) corev1.ConditionStatus {
+	if cond := utils.GetNetworkFSCondition(conds, condType); cond != nil {
+		return cond.Status
+	}
+	return ""
+}
+
+func conditionMessage(conds []networkfsv2.NetworkFSCondition, condType networkfsv2.ConditionType) string {
+	cond := utils.GetNetworkFSCondition(conds, condType)
+	if cond == nil {
+		return ""
+	}
+	if cond.Message != "" {
+		return cond.Message
+	}
+	return cond.Reason
+}
@@ -0,0 +1,262 @@
+package networkfilesystem
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+// exposePortName matches the port name of the Endpoints of the Longhorn share-manager
+const exposePortName = "nfs"
+
+// reconcileExposeService creates or updates the selectorless Service exposing the network filesystem, and removes it
+// once the expose is unset. The Service cannot select the share-manager pod in the Longhorn namespace, its Endpoints
+// mirror the Longhorn ones instead, see reconcileExposeEndpoints.
+func (c *Controller) reconcileExposeService(networkFS *networkfsv2.NetworkFilesystem) (*corev1.Service, error) {
+	name := utils.NetworkFSObjectName(networkFS.Name)
+	existing, err := c.ServiceCache.Get(networkFS.Namespace, name)
+	if err != nil && !errors.IsNotFound(err) {
+		logrus.Errorf("Failed to get service %s/%s: %v", networkFS.Namespace, name, err)
+		return nil, err
+	}
+	if err == nil && !metav1.IsControlledBy(existing, networkFS) {
+		return nil, fmt.Errorf("service %s/%s is not owned by network filesystem %s", networkFS.Namespace, name, networkFS.Name)
+	}
+
+	if networkFS.Spec.Expose == nil {
+		if existing == nil {
+			return nil, nil
+		}
+		logrus.Infof("Remove service %s/%s, network filesystem %s is not exposed anymore", networkFS.Namespace, name, networkFS.Name)
+		if err := c.Services.Delete(networkFS.Namespace, name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	desired := exposeService(networkFS)
+	if existing == nil {
+		logrus.Infof("Create %s service %s/%s for network filesystem %s", desired.Spec.Type, networkFS.Namespace, name, networkFS.Name)
+		created, err := c.Services.Create(desired)
+		if err != nil {
+			return nil, err
+		}
+		c.recorder.Eventf(networkFS, corev1.EventTypeNormal, EventReasonExposed, "Created %s service %s", desired.Spec.Type, name)
+		return created, nil
+	}
+
+	if ip := networkFS.Spec.Expose.IP; ip != "" && desired.Spec.ClusterIP != "" && existing.Spec.ClusterIP != ip {
+		// the cluster IP is immutable, the Service deletion enqueues the network filesystem again to recreate it
+		logrus.Infof("Recreate service %s/%s with the cluster IP %s", networkFS.Namespace, name, ip)
+		if err := c.Services.Delete(networkFS.Namespace, name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	svcCpy := existing.DeepCopy()
+	svcCpy.Labels = desired.Labels
+	svcCpy.Spec.Type = desired.Spec.Type
+	svcCpy.Spec.LoadBalancerIP = desired.Spec.LoadBalancerIP
+	svcCpy.Spec.Ports = desired.Spec.Ports
+	for i := range svcCpy.Spec.Ports {
+		// keep the allocated node port, it is dropped by the API server if the type does not need it anymore
+		for _, port := range existing.Spec.Ports {
+			if port.Name == svcCpy.Spec.Ports[i].Name {
+				svcCpy.Spec.Ports[i].NodePort = port.NodePort
+			}
+		}
+	}
+	if reflect.DeepEqual(existing.Labels, svcCpy.Labels) && reflect.DeepEqual(existing.Spec, svcCpy.Spec) {
+		return existing, nil
+	}
+	logrus.Infof("Update service %s/%s of network filesystem %s", networkFS.Namespace, name, networkFS.Name)
+	return c.Services.Update(svcCpy)
+}
+
+// reconcileExposeEndpoints mirrors the Endpoints of the share-manager to the Service exposing the network filesystem
+// while it is exported, the Endpoints are emptied otherwise so the Service does not reach a disabled export.
+// They are removed with the Service once the expose is unset.
+func (c *Controller) reconcileExposeEndpoints(networkFS *networkfsv2.NetworkFilesystem, status *networkfsv2.NetworkFSStatus, observed *observedState) error {
+	name := utils.NetworkFSObjectName(networkFS.Name)
+	existing, err := c.EndpointCache.Get(networkFS.Namespace, name)
+	if err != nil && !errors.IsNotFound(err) {
+		logrus.Errorf("Failed to get endpoint %s/%s: %v", networkFS.Namespace, name, err)
+		return err
+	}
+	if err == nil && !metav1.IsControlledBy(existing, networkFS) {
+		return fmt.Errorf("endpoint %s/%s is not owned by network filesystem %s", networkFS.Namespace, name, networkFS.Name)
+	}
+
+	if networkFS.Spec.Expose == nil {
+		if existing == nil {
+			return nil
+		}
+		if err := c.Endpoints.Delete(networkFS.Namespace, name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	desired := &corev1.Endpoints{
+		ObjectMeta: ownedObjectMeta(networkFS),
+	}
+	if status.Export != nil && observed.endpoint != nil {
+		for _, subset := range observed.endpoint.Subsets {
+			mirrored := corev1.EndpointSubset{Ports: subset.Ports}
+			for _, addr := range subset.Addresses {
+				// the target pod lives in the Longhorn namespace, it is not referred from the mirrored address
+				mirrored.Addresses = append(mirrored.Addresses, corev1.EndpointAddress{IP: addr.IP, NodeName: addr.NodeName})
+			}
+			desired.Subsets = append(desired.Subsets, mirrored)
+		}
+	}
+
+	if existing == nil {
+		_, err = c.Endpoints.Create(desired)
+		return err
+	}
+	if reflect.DeepEqual(existing.Labels, desired.Labels) && reflect.DeepEqual(existing.Subsets, desired.Subsets) {
+		return nil
+	}
+	endpointCpy := existing.DeepCopy()
+	endpointCpy.Labels = desired.Labels
+	endpointCpy.Subsets = desired.Subsets
+	_, err = c.Endpoints.Update(endpointCpy)
+	return err
+}
+
+func exposeService(networkFS *networkfsv2.NetworkFilesystem) *corev1.Service {
+	expose := networkFS.Spec.Expose
+	svc := &corev1.Service{
+		ObjectMeta: ownedObjectMeta(networkFS),
+		Spec: corev1.ServiceSpec{
+			Type: expose.Type,
+			Ports: []corev1.ServicePort{{
+				Name:       exposePortName,
+				Protocol:   corev1.ProtocolTCP,
+				Port:       utils.NFSPort,
+				TargetPort: intstr.FromInt32(utils.NFSPort),
+			}},
+		},
+	}
+	if expose.Type == corev1.ServiceTypeLoadBalancer {
+		svc.Spec.LoadBalancerIP = expose.IP
+	} else {
+		svc.Spec.ClusterIP = expose.IP
+	}
+	return svc
+}
+
+// ownedObjectMeta returns the metadata of the objects owned by the network filesystem in its namespace
+func ownedObjectMeta(networkFS *networkfsv2.NetworkFilesystem) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      utils.NetworkFSObjectName(networkFS.Name),
+		Namespace: networkFS.Namespace,
+		Labels: map[string]string{
+			networkfsv2.LabelNetworkFS: networkFS.Name,
+		},
+		OwnerReferences: []metav1.OwnerReference{
+			*metav1.NewControllerRef(networkFS, networkfsv2.SchemeGroupVersion.WithKind("NetworkFilesystem")),
+		},
+	}
+}
+
+// exposeStatus returns the status of the Service exposing the network filesystem
+func exposeStatus(networkFS *networkfsv2.NetworkFilesystem, svc *corev1.Service) *networkfsv2.NetworkFSExposeStatus {
+	if networkFS.Spec.Expose == nil || svc == nil {
+		return nil
+	}
+	status := &networkfsv2.NetworkFSExposeStatus{
+		Service:   svc.Name,
+		Type:      svc.Spec.Type,
+		ClusterIP: svc.Spec.ClusterIP,
+	}
+	for _, port := range svc.Spec.Ports {
+		if port.Name == exposePortName {
+			status.NodePort = port.NodePort
+		}
+	}
+	if svc.Spec.Type == corev1.ServiceTypeLoadBalancer {
+		for _, ingress := range svc.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				status.LoadBalancerAddress = ingress.IP
+				break
+			}
+			if ingress.Hostname != "" {
+				status.LoadBalancerAddress = ingress.Hostname
+				break
+			}
+		}
+	}
+	return status
+}
+
+// isNodePortExposed returns true if the network filesystem is served at the node port of the nodes
+func isNodePortExposed(networkFS *networkfsv2.NetworkFilesystem) bool {
+	return networkFS.Spec.Expose != nil && networkFS.Spec.Expose.Type == corev1.ServiceTypeNodePort
+}
+
+// exposedAddresses returns the stable addresses and port of the exposed network filesystem, or the reason why it is
+// not ready yet. It is the load balancer address for "LoadBalancer", the internal addresses of the available nodes
+// with the node port for "NodePort", and the cluster IP for "ClusterIP".
+func exposedAddresses(networkFS *networkfsv2.NetworkFilesystem, svc *corev1.Service, nodes []*corev1.Node) ([]string, int32, string) {
+	status := exposeStatus(networkFS, svc)
+	if status == nil {
+		return nil, 0, "Service is not found"
+	}
+	if status.Type != networkFS.Spec.Expose.Type {
+		return nil, 0, fmt.Sprintf("Service type is %s", status.Type)
+	}
+	switch status.Type {
+	case corev1.ServiceTypeLoadBalancer:
+		if status.LoadBalancerAddress == "" {
+			return nil, 0, "LoadBalancer address is not assigned"
+		}
+		return []string{status.LoadBalancerAddress}, utils.NFSPort, ""
+	case corev1.ServiceTypeNodePort:
+		if status.NodePort == 0 {
+			return nil, 0, "Service node port is not allocated"
+		}
+		addresses := nodeAddresses(nodes)
+		if len(addresses) == 0 {
+			return nil, 0, "No node is available to serve the node port"
+		}
+		return addresses, status.NodePort, ""
+	}
+	if status.ClusterIP == "" || status.ClusterIP == corev1.ClusterIPNone {
+		return nil, 0, "Service cluster IP is not allocated"
+	}
+	return []string{status.ClusterIP}, utils.NFSPort, ""
+}
+
+// nodeAddresses returns the internal addresses of the available nodes in the order of their names, so the first
+// address only changes once its node becomes unavailable
+func nodeAddresses(nodes []*corev1.Node) []string {
+	available := make([]*corev1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if isNodeAvailable(node) {
+			available = append(available, node)
+		}
+	}
+	sort.Slice(available, func(i, j int) bool { return available[i].Name < available[j].Name })
+
+	var addresses []string
+	for _, node := range available {
+		for _, address := range node.Status.Addresses {
+			if address.Type == corev1.NodeInternalIP {
+				addresses = append(addresses, address.Address)
+			}
+		}
+	}
+	return addresses
+}
@@ -0,0 +1,119 @@
+package networkfilesystem
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	longhornv2 "github.com/longhorn/longhorn-manager/k8s/pkg/apis/longhorn/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+)
+
+func exposedService(svcType corev1.ServiceType, clusterIP string, nodePort int32) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "networkfs-pvc-1"},
+		Spec: corev1.ServiceSpec{
+			Type:      svcType,
+			ClusterIP: clusterIP,
+			Ports:     []corev1.ServicePort{{Name: exposePortName, Port: 2049, NodePort: nodePort}},
+		},
+	}
+}
+
+func TestExposedAddresses(t *testing.T) {
+	since := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	internal := func(address string) corev1.NodeAddress {
+		return corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: address}
+	}
+	node := func(name string, addresses ...corev1.NodeAddress) *corev1.Node {
+		n := readyNode(name, since)
+		n.Status.Addresses = addresses
+		return n
+	}
+	notReady := node("node-0", internal("192.168.0.10"))
+	notReady.Status.Conditions[0].Status = corev1.ConditionFalse
+	nodes := []*corev1.Node{
+		node("node-3", internal("192.168.0.13"), corev1.NodeAddress{Type: corev1.NodeHostName, Address: "node-3"}),
+		cordoned(node("node-2", internal("192.168.0.12"))),
+		notReady,
+		node("node-1", internal("192.168.0.11"), internal("fd00::11"), corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: "203.0.113.11"}),
+	}
+	loadBalancer := exposedService(corev1.ServiceTypeLoadBalancer, "10.53.0.30", 30049)
+	loadBalancer.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "172.16.0.30"}}
+
+	tests := []struct {
+		name          string
+		expose        corev1.ServiceType
+		svc           *corev1.Service
+		nodes         []*corev1.Node
+		wantAddresses []string
+		wantPort      int32
+		wantReason    string
+	}{
+		{name: "no service", expose: corev1.ServiceTypeClusterIP, wantReason: "Service is not found"},
+		{name: "service type is updated", expose: corev1.ServiceTypeNodePort, svc: exposedService(corev1.ServiceTypeClusterIP, "10.53.0.30", 0), wantReason: "Service type is ClusterIP"},
+		{name: "cluster IP", expose: corev1.ServiceTypeClusterIP, svc: exposedService(corev1.ServiceTypeClusterIP, "10.53.0.30", 0), wantAddresses: []string{"10.53.0.30"}, wantPort: 2049},
+		{name: "no cluster IP", expose: corev1.ServiceTypeClusterIP, svc: exposedService(corev1.ServiceTypeClusterIP, "", 0), wantReason: "Service cluster IP is not allocated"},
+		{name: "load balancer", expose: corev1.ServiceTypeLoadBalancer, svc: loadBalancer, wantAddresses: []string{"172.16.0.30"}, wantPort: 2049},
+		{name: "no load balancer address", expose: corev1.ServiceTypeLoadBalancer, svc: exposedService(corev1.ServiceTypeLoadBalancer, "10.53.0.30", 30049), wantReason: "LoadBalancer address is not assigned"},
+		{
+			name:          "node port",
+			expose:        corev1.ServiceTypeNodePort,
+			svc:           exposedService(corev1.ServiceTypeNodePort, "10.53.0.30", 30049),
+			nodes:         nodes,
+			wantAddresses: []string{"192.168.0.11", "fd00::11", "192.168.0.13"},
+			wantPort:      30049,
+		},
+		{name: "no node port", expose: corev1.ServiceTypeNodePort, svc: exposedService(corev1.ServiceTypeNodePort, "10.53.0.30", 0), nodes: nodes, wantReason: "Service node port is not allocated"},
+		{
+			name:       "no available node",
+			expose:     corev1.ServiceTypeNodePort,
+			svc:        exposedService(corev1.ServiceTypeNodePort, "10.53.0.30", 30049),
+			nodes:      []*corev1.Node{notReady, cordoned(node("node-2", internal("192.168.0.12")))},
+			wantReason: "No node is available to serve the node port",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			networkFS := &networkfsv2.NetworkFilesystem{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pvc-1"},
+				Spec:       networkfsv2.NetworkFSSpec{Expose: &networkfsv2.NetworkFSExpose{Type: tt.expose}},
+			}
+			addresses, port, reason := exposedAddresses(networkFS, tt.svc, tt.nodes)
+			if reason != tt.wantReason {
+				t.Errorf("reason = %q, want %q", reason, tt.wantReason)
+			}
+			if !reflect.DeepEqual(addresses, tt.wantAddresses) || port != tt.wantPort {
+				t.Errorf("addresses = %v:%d, want %v:%d", addresses, port, tt.wantAddresses, tt.wantPort)
+			}
+		})
+	}
+}
+
+func TestNodePortExport(t *testing.T) {
+	networkFS := &networkfsv2.NetworkFilesystem{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pvc-1"},
+		Spec:       networkfsv2.NetworkFSSpec{Expose: &networkfsv2.NetworkFSExpose{Type: corev1.ServiceTypeNodePort}},
+	}
+	node := readyNode("node-1", time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC))
+	node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "192.168.0.11"}}
+
+	export, reason := exportInfo(networkFS, &observedState{
+		volumeName:   testVolume,
+		shareManager: shareManager(longhornv2.ShareManagerStateRunning),
+		endpoint:     shareManagerEndpoint("10.52.0.10"),
+		service:      exposedService(corev1.ServiceTypeNodePort, "10.53.0.30", 30049),
+		nodes:        []*corev1.Node{node},
+	})
+	if reason != "" {
+		t.Fatalf("export is not ready: %s", reason)
+	}
+	// the clients mount the node port, see utils.ExportMountOptions
+	if !reflect.DeepEqual(export.Addresses, []string{"192.168.0.11"}) || export.Port != 30049 || export.MountSource != "192.168.0.11:/"+testVolume {
+		t.Errorf("export = %+v, want the node address and the node port", export)
+	}
+}
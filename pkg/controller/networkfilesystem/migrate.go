@@ -0,0 +1,139 @@
+package networkfilesystem
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	ctlapiextv1 "github.com/rancher/wrangler/v3/pkg/generated/controllers/apiextensions.k8s.io/v1"
+	"github.com/sirupsen/logrus"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+
+	networkfsv1 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta1"
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	ctlntefsv2 "github.com/harvester/networkfs-manager/pkg/generated/controllers/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+const (
+	conversionPollInterval = 5 * time.Second
+	conversionPollTimeout  = 2 * time.Minute
+)
+
+// MigrateStorageVersion rewrites the network filesystems stored as v1beta1 in the storage version, and drops v1beta1
+// from the stored versions of the CRD. It waits for the conversion webhook first, the apiserver would drop the v1beta1
+// fields while reading the old objects without it.
+func MigrateStorageVersion(ctx context.Context, crds ctlapiextv1.CustomResourceDefinitionClient, netfilesystems ctlntefsv2.NetworkFilesystemClient) error {
+	legacyVersion := networkfsv1.SchemeGroupVersion.Version
+	err := wait.PollUntilContextTimeout(ctx, conversionPollInterval, conversionPollTimeout, true, func(context.Context) (bool, error) {
+		crd, err := crds.Get(utils.NetworkFSCRDName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if !slices.Contains(crd.Status.StoredVersions, legacyVersion) {
+			return true, nil
+		}
+		return crd.Spec.Conversion != nil && crd.Spec.Conversion.Strategy == apiextensionsv1.WebhookConverter, nil
+	})
+	if err != nil {
+		return fmt.Errorf("conversion webhook of CRD %s is not ready: %w", utils.NetworkFSCRDName, err)
+	}
+
+	crd, err := crds.Get(utils.NetworkFSCRDName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(crd.Status.StoredVersions, legacyVersion) {
+		return nil
+	}
+
+	networkFSList, err := netfilesystems.List(metav1.NamespaceAll, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, item := range networkFSList.Items {
+		// the update without changes is written in the storage version
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			networkFS, err := netfilesystems.Get(item.Namespace, item.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			_, err = netfilesystems.Update(networkFS)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to migrate network filesystem %s/%s: %w", item.Namespace, item.Name, err)
+		}
+	}
+
+	crdCpy := crd.DeepCopy()
+	crdCpy.Status.StoredVersions = []string{networkfsv2.SchemeGroupVersion.Version}
+	if _, err := crds.UpdateStatus(crdCpy); err != nil {
+		return err
+	}
+	logrus.Infof("Migrated %d network filesystems to the storage version %s", len(networkFSList.Items), networkfsv2.SchemeGroupVersion.Version)
+	return nil
+}
+
+// MigrateConditions rewrites the conditions written by the previous versions before the controllers start.
+// NotReady and Reconciling are dropped, Failed is renamed to Degraded, and the stale Ready condition is dropped,
+// the controller computes the rest on the first reconcile.
+func MigrateConditions(netfilesystems ctlntefsv2.NetworkFilesystemClient) error {
+	networkFSList, err := netfilesystems.List(metav1.NamespaceAll, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, item := range networkFSList.Items {
+		if _, changed := migrateConditions(&item.Status); !changed {
+			continue
+		}
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			networkFS, err := netfilesystems.Get(item.Namespace, item.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			conds, changed := migrateConditions(&networkFS.Status)
+			if !changed {
+				return nil
+			}
+			networkFSCpy := networkFS.DeepCopy()
+			networkFSCpy.Status.NetworkFSConds = conds
+			_, err = netfilesystems.UpdateStatus(networkFSCpy)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		logrus.Infof("Migrated the conditions of network filesystem %s/%s", item.Namespace, item.Name)
+	}
+	return nil
+}
+
+// migrateConditions returns the conditions of the current model, and whether they differ from the given ones
+func migrateConditions(status *networkfsv2.NetworkFSStatus) ([]networkfsv2.NetworkFSCondition, bool) {
+	conds := status.NetworkFSConds
+	conds = utils.RemoveNetworkFSCondition(conds, legacyConditionType(networkfsv1.ConditionTypeNotReady))
+	conds = utils.RemoveNetworkFSCondition(conds, legacyConditionType(networkfsv1.ConditionTypeReconciling))
+	if failed := utils.GetNetworkFSCondition(conds, legacyConditionType(networkfsv1.ConditionTypeFailed)); failed != nil {
+		degraded := *failed
+		degraded.Type = networkfsv2.ConditionTypeDegraded
+		conds = utils.RemoveNetworkFSCondition(conds, legacyConditionType(networkfsv1.ConditionTypeFailed))
+		conds = utils.RemoveNetworkFSCondition(conds, networkfsv2.ConditionTypeDegraded)
+		conds = append(conds, degraded)
+	}
+	if status.State != networkfsv2.NetworkFSStateEnabled && utils.IsNetworkFSConditionTrue(conds, networkfsv2.ConditionTypeReady) {
+		// the previous versions never turned Ready false, it is recomputed from the state
+		conds = utils.RemoveNetworkFSCondition(conds, networkfsv2.ConditionTypeReady)
+	}
+	return conds, !reflect.DeepEqual(conds, status.NetworkFSConds)
+}
+
+// legacyConditionType returns the v1beta1 condition type the previous versions wrote
+func legacyConditionType(condType networkfsv1.ConditionType) networkfsv2.ConditionType {
+	return networkfsv2.ConditionType(condType)
+}
@@ -0,0 +1,112 @@
+package networkfilesystem
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+)
+
+func TestMigrateConditions(t *testing.T) {
+	before := metav1.NewTime(time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC))
+	condition := func(condType string, status corev1.ConditionStatus, reason string) networkfsv2.NetworkFSCondition {
+		return networkfsv2.NetworkFSCondition{
+			Type:               networkfsv2.ConditionType(condType),
+			Status:             status,
+			LastTransitionTime: before,
+			Reason:             reason,
+			Message:            reason + " message",
+		}
+	}
+	ready := condition("Ready", corev1.ConditionTrue, "Endpoint is ready")
+	progressing := condition("Progressing", corev1.ConditionFalse, "Transition is completed")
+
+	tests := []struct {
+		name  string
+		state networkfsv2.NetworkFSState
+		conds []networkfsv2.NetworkFSCondition
+		want  []networkfsv2.NetworkFSCondition
+	}{
+		{
+			name:  "current conditions are kept",
+			state: networkfsv2.NetworkFSStateEnabled,
+			conds: []networkfsv2.NetworkFSCondition{ready, progressing},
+			want:  []networkfsv2.NetworkFSCondition{ready, progressing},
+		},
+		{
+			name:  "enabled by the previous version",
+			state: networkfsv2.NetworkFSStateEnabled,
+			conds: []networkfsv2.NetworkFSCondition{
+				condition("NotReady", corev1.ConditionFalse, ""),
+				condition("Reconciling", corev1.ConditionFalse, ""),
+				ready,
+			},
+			want: []networkfsv2.NetworkFSCondition{ready},
+		},
+		{
+			name:  "disabled by the previous version",
+			state: networkfsv2.NetworkFSStateDisabled,
+			conds: []networkfsv2.NetworkFSCondition{
+				condition("NotReady", corev1.ConditionTrue, "Endpoint is disabled"),
+				ready,
+			},
+			want: []networkfsv2.NetworkFSCondition{},
+		},
+		{
+			name:  "failed is renamed to degraded",
+			state: networkfsv2.NetworkFSStateEnabling,
+			conds: []networkfsv2.NetworkFSCondition{
+				condition("Failed", corev1.ConditionTrue, "Enable is timed out"),
+				condition("Reconciling", corev1.ConditionTrue, "Endpoint is enabling"),
+			},
+			want: []networkfsv2.NetworkFSCondition{condition("Degraded", corev1.ConditionTrue, "Enable is timed out")},
+		},
+		{
+			name:  "failed replaces an existing degraded",
+			state: networkfsv2.NetworkFSStateEnabled,
+			conds: []networkfsv2.NetworkFSCondition{
+				condition("Degraded", corev1.ConditionFalse, ""),
+				condition("Failed", corev1.ConditionTrue, "Enable is timed out"),
+				ready,
+			},
+			want: []networkfsv2.NetworkFSCondition{ready, condition("Degraded", corev1.ConditionTrue, "Enable is timed out")},
+		},
+		{
+			name:  "false ready is kept",
+			state: networkfsv2.NetworkFSStateDisabled,
+			conds: []networkfsv2.NetworkFSCondition{condition("Ready", corev1.ConditionFalse, "Endpoint is disabled")},
+			want:  []networkfsv2.NetworkFSCondition{condition("Ready", corev1.ConditionFalse, "Endpoint is disabled")},
+		},
+		{
+			name:  "no conditions",
+			state: networkfsv2.NetworkFSStateDisabled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := &networkfsv2.NetworkFSStatus{State: tt.state, NetworkFSConds: tt.conds}
+			original := status.DeepCopy()
+			conds, changed := migrateConditions(status)
+			if len(conds) != len(tt.want) || (len(conds) > 0 && !equality.Semantic.DeepEqual(conds, tt.want)) {
+				t.Errorf("conditions = %+v, want %+v", conds, tt.want)
+			}
+			if wantChanged := !equality.Semantic.DeepEqual(tt.conds, tt.want); changed != wantChanged {
+				t.Errorf("changed = %t, want %t", changed, wantChanged)
+			}
+			if !equality.Semantic.DeepEqual(status, original) {
+				t.Errorf("status is modified: %+v", status)
+			}
+
+			// the migration runs on every leader start
+			migrated := &networkfsv2.NetworkFSStatus{State: tt.state, NetworkFSConds: conds}
+			if again, changed := migrateConditions(migrated); changed {
+				t.Errorf("migrating again changes the conditions to %+v", again)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package networkfilesystem
+
+import (
+	"reflect"
+	"sort"
+	"time"
+
+	longhornv2 "github.com/longhorn/longhorn-manager/k8s/pkg/apis/longhorn/v1beta2"
+	"github.com/rancher/wrangler/v3/pkg/relatedresource"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+)
+
+// hasPlacement returns true if the network filesystem requests the nodes of its endpoint
+func hasPlacement(networkFS *networkfsv2.NetworkFilesystem) bool {
+	return len(networkFS.Spec.PreferredNodes) > 0 || networkFS.Spec.NodeSelector != nil
+}
+
+// nodeState is the part of the Node the placement and the access policy depend on
+type nodeState struct {
+	ready         corev1.ConditionStatus
+	readySince    metav1.Time
+	unschedulable bool
+	labels        map[string]string
+	addresses     []corev1.NodeAddress
+}
+
+func newNodeState(node *corev1.Node) nodeState {
+	state := nodeState{
+		unschedulable: node.Spec.Unschedulable,
+		labels:        node.Labels,
+		addresses:     node.Status.Addresses,
+	}
+	if ready := nodeReadyCondition(node); ready != nil {
+		state.ready = ready.Status
+		state.readySince = ready.LastTransitionTime
+	}
+	return state
+}
+
+// OnNodeChange enqueues the NetworkFilesystems depending on the node once its readiness, cordon, labels or addresses
+// change, or once it is removed. The heartbeats of the node are ignored.
+func (c *Controller) OnNodeChange(name string, node *corev1.Node) (*corev1.Node, error) {
+	if !c.nodeChanged(name, node) {
+		return node, nil
+	}
+	keys, err := c.resolveNode()
+	if err != nil {
+		return node, err
+	}
+	for _, key := range keys {
+		c.NetworkFilsystems.Enqueue(key.Namespace, key.Name)
+	}
+	return node, nil
+}
+
+// nodeChanged records the state of the node, and returns true if it differs from the one last seen
+func (c *Controller) nodeChanged(name string, node *corev1.Node) bool {
+	if node == nil || node.DeletionTimestamp != nil {
+		_, found := c.nodeStates.LoadAndDelete(name)
+		return found
+	}
+	state := newNodeState(node)
+	last, found := c.nodeStates.Swap(name, state)
+	return !found || !reflect.DeepEqual(last, state)
+}
+
+// resolveNode returns the NetworkFilesystems requesting the nodes of their endpoint, the readiness and the labels of
+// any node may change their placement, the ones restricting their clients, the NetworkPolicy admits the addresses
+// of the nodes, and the ones served at the node port of the available nodes
+func (c *Controller) resolveNode() ([]relatedresource.Key, error) {
+	networkFSs, err := c.NetworkFSCache.List("", labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	var placed []*networkfsv2.NetworkFilesystem
+	for _, networkFS := range networkFSs {
+		if hasPlacement(networkFS) || hasAccessPolicy(networkFS) || isNodePortExposed(networkFS) {
+			placed = append(placed, networkFS)
+		}
+	}
+	return networkFSKeys(placed), nil
+}
+
+// candidateNodes returns the eligible nodes in the order of preference, the preferred nodes first, then the nodes
+// matching the selector by name. The unavailable nodes are kept, so the current node can be ranked.
+func candidateNodes(networkFS *networkfsv2.NetworkFilesystem, nodes []*corev1.Node) []string {
+	candidates := append([]string{}, networkFS.Spec.PreferredNodes...)
+	if networkFS.Spec.NodeSelector == nil {
+		return candidates
+	}
+	selector, err := metav1.LabelSelectorAsSelector(networkFS.Spec.NodeSelector)
+	if err != nil {
+		// the webhook rejects the invalid selector, only the preferred nodes are eligible otherwise
+		return candidates
+	}
+
+	preferred := map[string]bool{}
+	for _, name := range candidates {
+		preferred[name] = true
+	}
+	var selected []string
+	for _, node := range nodes {
+		if !preferred[node.Name] && selector.Matches(labels.Set(node.Labels)) {
+			selected = append(selected, node.Name)
+		}
+	}
+	sort.Strings(selected)
+	return append(candidates, selected...)
+}
+
+// isNodeAvailable returns true if the node is ready and not cordoned
+func isNodeAvailable(node *corev1.Node) bool {
+	if node == nil || node.Spec.Unschedulable {
+		return false
+	}
+	ready := nodeReadyCondition(node)
+	return ready != nil && ready.Status == corev1.ConditionTrue
+}
+
+func nodeReadyCondition(node *corev1.Node) *corev1.NodeCondition {
+	for i := range node.Status.Conditions {
+		if node.Status.Conditions[i].Type == corev1.NodeReady {
+			return &node.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// currentNode returns the node of the attachment ticket of the network filesystem, false if it has no ticket
+func currentNode(networkFS *networkfsv2.NetworkFilesystem, lhva *longhornv2.VolumeAttachment) (string, bool) {
+	if lhva == nil {
+		return "", false
+	}
+	ticket := lhva.Spec.AttachmentTickets[ticketID(networkFS)]
+	if ticket == nil {
+		return "", false
+	}
+	return ticket.NodeID, true
+}
+
+// placementStatus returns the node the network filesystem is requested on, nil if it requests no node. The export
+// leaves its current node at once when the node is unavailable or no longer eligible, and falls back to the next
+// available node. It moves to a more preferred node only once that node has been available to it, ready, uncordoned
+// and eligible, for the failback delay, so the clients are not disrupted by the flapping node. The time the node became
+// available is kept in the status, since neither the uncordon nor the label change is recorded on the node.
+func placementStatus(networkFS *networkfsv2.NetworkFilesystem, nodes []*corev1.Node, lhva *longhornv2.VolumeAttachment, now metav1.Time, failbackDelay time.Duration) *networkfsv2.NetworkFSPlacementStatus {
+	if !hasPlacement(networkFS) {
+		return nil
+	}
+	byName := map[string]*corev1.Node{}
+	for _, node := range nodes {
+		byName[node.Name] = node
+	}
+	candidates := candidateNodes(networkFS, nodes)
+	rank := map[string]int{}
+	best := ""
+	for i, name := range candidates {
+		rank[name] = i
+		if best == "" && isNodeAvailable(byName[name]) {
+			best = name
+		}
+	}
+	current, found := currentNode(networkFS, lhva)
+	if best == "" {
+		status := &networkfsv2.NetworkFSPlacementStatus{Reason: networkfsv2.PlacementReasonNoEligibleNode}
+		// there is no better node to move the export to
+		if found && isNodeAvailable(byName[current]) {
+			status.Node = current
+		}
+		return status
+	}
+
+	status := &networkfsv2.NetworkFSPlacementStatus{Node: best, Reason: networkfsv2.PlacementReasonPreferred}
+	if best != candidates[0] {
+		status.Reason = networkfsv2.PlacementReasonFallback
+	}
+	if !found || current == best {
+		return status
+	}
+	// the current node is left at once if it is gone from the candidates or unavailable
+	if _, eligible := rank[current]; current != "" && (!eligible || !isNodeAvailable(byName[current])) {
+		return status
+	}
+	availableSince := failbackNodeAvailableSince(networkFS.Status.Placement, byName[best], now)
+	failbackTime := metav1.NewTime(availableSince.Add(failbackDelay)).Rfc3339Copy()
+	if !now.Before(&failbackTime) {
+		return status
+	}
+	status.Node = current
+	status.Reason = networkfsv2.PlacementReasonWaitingForFailback
+	status.FailbackNode = best
+	status.FailbackNodeAvailableSince = &availableSince
+	status.FailbackTime = &failbackTime
+	return status
+}
+
+// failbackNodeAvailableSince returns the time the node became available to the network filesystem, now if it was not
+// the failback node of the last placement. The node must also have stayed ready since then.
+func failbackNodeAvailableSince(last *networkfsv2.NetworkFSPlacementStatus, node *corev1.Node, now metav1.Time) metav1.Time {
+	since := now.Rfc3339Copy()
+	if last != nil && last.FailbackNode == node.Name && last.FailbackNodeAvailableSince != nil {
+		since = *last.FailbackNodeAvailableSince
+	}
+	if ready := nodeReadyCondition(node); ready != nil && since.Before(&ready.LastTransitionTime) {
+		since = ready.LastTransitionTime.Rfc3339Copy()
+	}
+	return since
+}
+
+// placementNode returns the node the attachment ticket requests, empty to let Longhorn pick one
+func placementNode(placement *networkfsv2.NetworkFSPlacementStatus) string {
+	if placement == nil {
+		return ""
+	}
+	return placement.Node
+}
+
+// placementRetryAfter returns the delay before the export moves back to the more preferred node
+func placementRetryAfter(status *networkfsv2.NetworkFSStatus, now metav1.Time) (time.Duration, bool) {
+	if status.Placement == nil || status.Placement.FailbackTime == nil {
+		return 0, false
+	}
+	delay := status.Placement.FailbackTime.Sub(now.Time)
+	if delay < minRetryInterval {
+		delay = minRetryInterval
+	}
+	return delay, true
+}
@@ -0,0 +1,175 @@
+package networkfilesystem
+
+import (
+	"testing"
+	"time"
+
+	longhornv2 "github.com/longhorn/longhorn-manager/k8s/pkg/apis/longhorn/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+)
+
+func readyNode(name string, readySince time.Time) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{{
+			Type:               corev1.NodeReady,
+			Status:             corev1.ConditionTrue,
+			LastTransitionTime: metav1.NewTime(readySince),
+		}}},
+	}
+}
+
+func cordoned(node *corev1.Node) *corev1.Node {
+	node.Spec.Unschedulable = true
+	return node
+}
+
+func attachedOn(networkFS *networkfsv2.NetworkFilesystem, nodeName string) *longhornv2.VolumeAttachment {
+	return &longhornv2.VolumeAttachment{Spec: longhornv2.VolumeAttachmentSpec{
+		AttachmentTickets: map[string]*longhornv2.AttachmentTicket{ticketID(networkFS): attachmentTicket(networkFS, nodeName)},
+	}}
+}
+
+func TestPlacementFailback(t *testing.T) {
+	now := metav1.NewTime(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC))
+	// node-1 has been ready for a day, it was cordoned and uncordoned in the meantime
+	longReady := now.Add(-24 * time.Hour)
+	delay := 5 * time.Minute
+	at := func(d time.Duration) *metav1.Time {
+		t := metav1.NewTime(now.Add(d))
+		return &t
+	}
+
+	tests := []struct {
+		name  string
+		nodes []*corev1.Node
+		last  *networkfsv2.NetworkFSPlacementStatus
+		want  *networkfsv2.NetworkFSPlacementStatus
+	}{
+		{
+			name:  "uncordoned node",
+			nodes: []*corev1.Node{readyNode("node-1", longReady), readyNode("node-2", longReady)},
+			last:  &networkfsv2.NetworkFSPlacementStatus{Node: "node-2", Reason: networkfsv2.PlacementReasonFallback},
+			want: &networkfsv2.NetworkFSPlacementStatus{
+				Node:                       "node-2",
+				Reason:                     networkfsv2.PlacementReasonWaitingForFailback,
+				FailbackNode:               "node-1",
+				FailbackNodeAvailableSince: at(0),
+				FailbackTime:               at(delay),
+			},
+		},
+		{
+			name:  "waiting for the failback",
+			nodes: []*corev1.Node{readyNode("node-1", longReady), readyNode("node-2", longReady)},
+			last:  &networkfsv2.NetworkFSPlacementStatus{Node: "node-2", Reason: networkfsv2.PlacementReasonWaitingForFailback, FailbackNode: "node-1", FailbackNodeAvailableSince: at(-time.Minute), FailbackTime: at(delay - time.Minute)},
+			want: &networkfsv2.NetworkFSPlacementStatus{
+				Node:                       "node-2",
+				Reason:                     networkfsv2.PlacementReasonWaitingForFailback,
+				FailbackNode:               "node-1",
+				FailbackNodeAvailableSince: at(-time.Minute),
+				FailbackTime:               at(delay - time.Minute),
+			},
+		},
+		{
+			name:  "node ready again while waiting",
+			nodes: []*corev1.Node{readyNode("node-1", now.Add(-time.Minute)), readyNode("node-2", longReady)},
+			last:  &networkfsv2.NetworkFSPlacementStatus{Node: "node-2", Reason: networkfsv2.PlacementReasonWaitingForFailback, FailbackNode: "node-1", FailbackNodeAvailableSince: at(-3 * time.Minute), FailbackTime: at(delay - 3*time.Minute)},
+			want: &networkfsv2.NetworkFSPlacementStatus{
+				Node:                       "node-2",
+				Reason:                     networkfsv2.PlacementReasonWaitingForFailback,
+				FailbackNode:               "node-1",
+				FailbackNodeAvailableSince: at(-time.Minute),
+				FailbackTime:               at(delay - time.Minute),
+			},
+		},
+		{
+			name:  "failback delay elapsed",
+			nodes: []*corev1.Node{readyNode("node-1", longReady), readyNode("node-2", longReady)},
+			last:  &networkfsv2.NetworkFSPlacementStatus{Node: "node-2", Reason: networkfsv2.PlacementReasonWaitingForFailback, FailbackNode: "node-1", FailbackNodeAvailableSince: at(-delay), FailbackTime: at(0)},
+			want:  &networkfsv2.NetworkFSPlacementStatus{Node: "node-1", Reason: networkfsv2.PlacementReasonPreferred},
+		},
+		{
+			name:  "current node cordoned",
+			nodes: []*corev1.Node{readyNode("node-1", longReady), cordoned(readyNode("node-2", longReady))},
+			want:  &networkfsv2.NetworkFSPlacementStatus{Node: "node-1", Reason: networkfsv2.PlacementReasonPreferred},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			networkFS := &networkfsv2.NetworkFilesystem{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "harvester-system", Name: "pvc-1"},
+				Spec:       networkfsv2.NetworkFSSpec{PreferredNodes: []string{"node-1", "node-2"}},
+				Status:     networkfsv2.NetworkFSStatus{Placement: tt.last},
+			}
+			got := placementStatus(networkFS, tt.nodes, attachedOn(networkFS, "node-2"), now, delay)
+			if !equality.Semantic.DeepEqual(got, tt.want) {
+				t.Errorf("placement = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeChanged(t *testing.T) {
+	since := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	base := func() *corev1.Node {
+		node := readyNode("node-1", since)
+		node.Labels = map[string]string{"zone": "a"}
+		node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "192.168.0.11"}}
+		return node
+	}
+
+	steps := []struct {
+		name   string
+		mutate func(*corev1.Node) *corev1.Node
+		want   bool
+	}{
+		{name: "first seen", mutate: func(node *corev1.Node) *corev1.Node { return node }, want: true},
+		{
+			name: "heartbeat",
+			mutate: func(node *corev1.Node) *corev1.Node {
+				node.ResourceVersion = "2"
+				node.Status.Conditions[0].LastHeartbeatTime = metav1.NewTime(since.Add(time.Minute))
+				node.Status.Conditions = append(node.Status.Conditions, corev1.NodeCondition{Type: corev1.NodeMemoryPressure, Status: corev1.ConditionFalse})
+				node.Annotations = map[string]string{"heartbeat": "1"}
+				return node
+			},
+		},
+		{name: "cordoned", mutate: cordoned, want: true},
+		{name: "labeled", mutate: func(node *corev1.Node) *corev1.Node { node.Labels["zone"] = "b"; return node }, want: true},
+		{
+			name: "address changed",
+			mutate: func(node *corev1.Node) *corev1.Node {
+				node.Status.Addresses[0].Address = "192.168.0.21"
+				return node
+			},
+			want: true,
+		},
+		{
+			name: "not ready",
+			mutate: func(node *corev1.Node) *corev1.Node {
+				node.Status.Conditions[0].Status = corev1.ConditionUnknown
+				node.Status.Conditions[0].LastTransitionTime = metav1.NewTime(since.Add(time.Hour))
+				return node
+			},
+			want: true,
+		},
+		{name: "removed", mutate: func(*corev1.Node) *corev1.Node { return nil }, want: true},
+		{name: "removed again", mutate: func(*corev1.Node) *corev1.Node { return nil }},
+	}
+
+	c := &Controller{}
+	node := base()
+	for _, step := range steps {
+		if node != nil {
+			node = step.mutate(node.DeepCopy())
+		}
+		if got := c.nodeChanged("node-1", node); got != step.want {
+			t.Errorf("%s: changed = %t, want %t", step.name, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package networkfilesystem
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	ctlntefsv2 "github.com/harvester/networkfs-manager/pkg/generated/controllers/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/metrics"
+	"github.com/harvester/networkfs-manager/pkg/nfsprobe"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+// maxConcurrentProbes bounds the exports probed at the same time
+const maxConcurrentProbes = 8
+
+// latencyBuckets round the latency reported by the Reachable condition, so the condition is not rewritten on every
+// probe, the exact latency goes to the probe_duration_seconds metric
+var latencyBuckets = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 20 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 200 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2 * time.Second, 5 * time.Second,
+}
+
+// probeResult is the outcome of the last probe of an export
+type probeResult struct {
+	address   string
+	reachable bool
+	reason    string
+	message   string
+}
+
+// exportProber periodically probes the data path of the enabled exports, and enqueues
+// the network filesystem when the result changes so the Reachable condition follows
+type exportProber struct {
+	prober   *nfsprobe.Prober
+	interval time.Duration
+	cache    ctlntefsv2.NetworkFilesystemCache
+	enqueue  func(namespace, name string)
+
+	lock    sync.RWMutex
+	results map[string]probeResult
+}
+
+func newExportProber(opt *utils.Option, cache ctlntefsv2.NetworkFilesystemCache, enqueue func(namespace, name string)) *exportProber {
+	return &exportProber{
+		prober:   nfsprobe.NewProber(opt.ProbeTimeout),
+		interval: opt.ProbeInterval,
+		cache:    cache,
+		enqueue:  enqueue,
+		results:  map[string]probeResult{},
+	}
+}
+
+func (p *exportProber) run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.probeAll(ctx)
+		}
+	}
+}
+
+// result returns the last probe result of the export, nil if it was not probed yet
+func (p *exportProber) result(networkFS *networkfsv2.NetworkFilesystem) *probeResult {
+	if p == nil {
+		return nil
+	}
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	result, ok := p.results[claimKey(networkFS.Namespace, networkFS.Name)]
+	if !ok {
+		return nil
+	}
+	return &result
+}
+
+func (p *exportProber) probeAll(ctx context.Context) {
+	networkFSs, err := p.cache.List("", labels.Everything())
+	if err != nil {
+		logrus.Errorf("Failed to list network filesystems to probe: %v", err)
+		return
+	}
+
+	probed := map[string]bool{}
+	sem := make(chan struct{}, maxConcurrentProbes)
+	var wg sync.WaitGroup
+	for _, networkFS := range networkFSs {
+		address := probeAddress(&networkFS.Status)
+		if address == "" {
+			continue
+		}
+		key := claimKey(networkFS.Namespace, networkFS.Name)
+		probed[key] = true
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(namespace, name, key, address, exportPath string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			result := p.probe(ctx, namespace, name, address, exportPath)
+
+			p.lock.Lock()
+			changed := !reflect.DeepEqual(p.results[key], result)
+			p.results[key] = result
+			p.lock.Unlock()
+			if changed {
+				p.enqueue(namespace, name)
+			}
+		}(networkFS.Namespace, networkFS.Name, key, address, networkFS.Status.Export.ExportPath)
+	}
+	wg.Wait()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for key := range p.results {
+		if !probed[key] {
+			delete(p.results, key)
+		}
+	}
+	for _, networkFS := range networkFSs {
+		if !probed[claimKey(networkFS.Namespace, networkFS.Name)] {
+			metrics.DeleteExportProbe(networkFS.Namespace, networkFS.Name)
+		}
+	}
+}
+
+func (p *exportProber) probe(ctx context.Context, namespace, name, address, exportPath string) probeResult {
+	res := p.prober.Probe(ctx, address, exportPath)
+	var total time.Duration
+	for stage, latency := range res.Latency {
+		metrics.ObserveProbeLatency(string(stage), latency)
+		total += latency
+	}
+	metrics.SetExportReachable(namespace, name, res.Err == nil)
+
+	result := probeResult{
+		address:   address,
+		reachable: res.Err == nil,
+	}
+	if res.Err == nil {
+		result.reason = "Export is reachable"
+		result.message = fmt.Sprintf("NFS server answered within %s and %s is found", latencyBucket(total), exportPath)
+		return result
+	}
+
+	metrics.IncProbeFailures(namespace, name, string(res.Stage))
+	switch res.Stage {
+	case nfsprobe.StageConnect:
+		result.reason = "Port is unreachable"
+	case nfsprobe.StageNull:
+		result.reason = "NFS program is not responding"
+	default:
+		result.reason = "Export lookup failed"
+	}
+	result.message = res.Err.Error()
+	logrus.Debugf("Probe of network filesystem %s/%s at %s failed: %v", namespace, name, address, res.Err)
+	return result
+}
+
+// latencyBucket returns the smallest bucket the latency fits in, the latency rounded up to the second beyond them
+func latencyBucket(latency time.Duration) time.Duration {
+	for _, bucket := range latencyBuckets {
+		if latency <= bucket {
+			return bucket
+		}
+	}
+	return (latency + time.Second - 1).Truncate(time.Second)
+}
+
+// probeAddress returns the host:port to probe, empty if the export is not enabled
+func probeAddress(status *networkfsv2.NetworkFSStatus) string {
+	if status.State != networkfsv2.NetworkFSStateEnabled || status.Export == nil || len(status.Export.Addresses) == 0 {
+		return ""
+	}
+	return net.JoinHostPort(status.Export.Addresses[0], strconv.Itoa(int(status.Export.Port)))
+}
+
+// updateReachableCondition records the last probe result of the enabled export,
+// the condition turns Unknown once the export is not enabled anymore
+func updateReachableCondition(conds []networkfsv2.NetworkFSCondition, status *networkfsv2.NetworkFSStatus, result *probeResult, now metav1.Time) []networkfsv2.NetworkFSCondition {
+	if status.State != networkfsv2.NetworkFSStateEnabled {
+		if utils.GetNetworkFSCondition(conds, networkfsv2.ConditionTypeReachable) == nil {
+			return conds
+		}
+		return utils.SetNetworkFSCondition(conds, networkfsv2.ConditionTypeReachable, corev1.ConditionUnknown, "Export is not enabled", "", now)
+	}
+	if result == nil || result.address != probeAddress(status) {
+		// not probed yet at the current address
+		return conds
+	}
+
+	condStatus := corev1.ConditionFalse
+	if result.reachable {
+		condStatus = corev1.ConditionTrue
+	}
+	return utils.SetNetworkFSCondition(conds, networkfsv2.ConditionTypeReachable, condStatus, result.reason, result.message, now)
+}
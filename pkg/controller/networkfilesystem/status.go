@@ -0,0 +1,278 @@
+package networkfilesystem
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	longhornv2 "github.com/longhorn/longhorn-manager/k8s/pkg/apis/longhorn/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+// computeStatus computes the whole status of the network filesystem from the observed state.
+// Conditions are only written on transitions, so the same observed state always yields the same status.
+func computeStatus(networkFS *networkfsv2.NetworkFilesystem, observed *observedState) networkfsv2.NetworkFSStatus {
+	current := networkFS
+	if networkFS.Status.State == networkfsv2.NetworkFSStateFailed && networkFS.Status.Transition != nil {
+		// the failed transition is still retried, compute the export as if it was ongoing
+		current = networkFS.DeepCopy()
+		current.Status.State = transitionalState(networkFS.Status.Transition.DesiredState)
+	}
+	status := updateTransition(networkFS, observed, computeExportStatus(current, observed))
+	status.ObservedGeneration = networkFS.Generation
+	status.NetworkFSConds = updateReadyCondition(status.NetworkFSConds, &status, observed.now)
+	status.NetworkFSConds = updateProgressingCondition(networkFS, status.NetworkFSConds, &status, observed)
+	status.NetworkFSConds = updateEndpointChangedCondition(status.NetworkFSConds, observed)
+	status.NetworkFSConds = updateReachableCondition(status.NetworkFSConds, &status, observed.probe, observed.now)
+	return status
+}
+
+// computeExportStatus computes the status of the export, regardless of the deadline of the transition
+func computeExportStatus(networkFS *networkfsv2.NetworkFilesystem, observed *observedState) networkfsv2.NetworkFSStatus {
+	prev := networkFS.Status
+	status := *prev.DeepCopy()
+	inUse := consumers(networkFS, observed)
+	status.Consumers = append(append([]networkfsv2.NetworkFSConsumer(nil), inUse...), networkFS.Spec.Consumers...)
+	status.Expose = exposeStatus(networkFS, observed.service)
+	status.AccessPolicy = accessPolicyStatus(networkFS, observed.networkPolicy)
+	if observed.unresolved == nil {
+		// the last resolved volume is kept otherwise, so the deletion can still release it
+		status.PersistentVolume = ""
+		if observed.pv != nil {
+			status.PersistentVolume = observed.pv.Name
+		}
+		status.Volume = observed.volumeName
+	}
+	status.NetworkFSConds = updateOrphanedCondition(status.NetworkFSConds, observed)
+
+	desiredState := observed.desiredState
+	status.DesiredState = desiredState
+	status.DesiredStateReason = observed.desiredStateReason
+	status.AutoDisableTime = observed.autoDisableTime
+	status.Lease = leaseStatus(networkFS, observed.now)
+	status.Schedule = observed.schedule
+	status.Idle = observed.idle
+	status.Placement = observed.placement
+	blocked := desiredState == networkfsv2.NetworkFSStateDisabled && isDisableBlocked(networkFS, observed)
+	status.NetworkFSConds = updateBlockedCondition(networkFS, desiredState, observed.desiredStateReason, status.NetworkFSConds, inUse, blocked, observed.now)
+	if blocked {
+		// the export stays up until the consumers go away
+		desiredState = networkfsv2.NetworkFSStateEnabled
+	}
+
+	switch desiredState {
+	case networkfsv2.NetworkFSStateEnabled:
+		export, reason := exportInfo(networkFS, observed)
+		if reason != "" {
+			status.State = networkfsv2.NetworkFSStateEnabling
+			status.Export = nil
+			return status
+		}
+
+		address := export.Addresses[0]
+		status.State = networkfsv2.NetworkFSStateEnabled
+		status.Export = export
+		if prevAddress := endpointAddress(&prev); prevAddress != "" && prevAddress != address {
+			// a new change restarts the period the condition is kept true for
+			status.NetworkFSConds = utils.RemoveNetworkFSCondition(status.NetworkFSConds, networkfsv2.ConditionTypeEndpointChanged)
+			status.NetworkFSConds = utils.SetNetworkFSCondition(status.NetworkFSConds, networkfsv2.ConditionTypeEndpointChanged, corev1.ConditionTrue,
+				"Endpoint is changed", fmt.Sprintf("Endpoint address is changed, previous address is %s", prevAddress), observed.now)
+		}
+	case networkfsv2.NetworkFSStateDisabled:
+		// nothing was exported yet, the running sharemanager (if any) belongs to other workloads
+		alreadyDisabled := prev.State == "" || prev.State == networkfsv2.NetworkFSStateDisabled || prev.State == networkfsv2.NetworkFSStateUnknown
+		if !alreadyDisabled && !isShareManagerStopped(observed.shareManager) {
+			status.State = networkfsv2.NetworkFSStateDisabling
+			return status
+		}
+
+		status.State = networkfsv2.NetworkFSStateDisabled
+		status.Export = nil
+	}
+
+	return status
+}
+
+// exportInfo returns the structured export of the network filesystem, or the reason why it is not ready yet.
+// The address and port come from the Endpoints, cross-checked against the nfs:// URL published by the ShareManager.
+// The exposed network filesystem is served at the stable address of its Service instead.
+func exportInfo(networkFS *networkfsv2.NetworkFilesystem, observed *observedState) (*networkfsv2.NetworkFSExport, string) {
+	sm := observed.shareManager
+	if sm == nil {
+		return nil, "ShareManager is not found"
+	}
+	if sm.Status.State != longhornv2.ShareManagerStateRunning {
+		return nil, fmt.Sprintf("ShareManager is %s", sm.Status.State)
+	}
+	if sm.Status.Endpoint == "" {
+		return nil, "ShareManager did not publish the endpoint"
+	}
+	smURL, err := url.Parse(sm.Status.Endpoint)
+	if err != nil || smURL.Scheme != "nfs" {
+		return nil, fmt.Sprintf("ShareManager endpoint %s is not a valid nfs URL", sm.Status.Endpoint)
+	}
+	exportPath := "/" + observed.volumeName
+	if smURL.Path != exportPath {
+		return nil, fmt.Sprintf("ShareManager endpoint %s does not export %s", sm.Status.Endpoint, exportPath)
+	}
+
+	endpoint := observed.endpoint
+	if endpoint == nil || len(endpoint.Subsets) == 0 || len(endpoint.Subsets[0].Addresses) == 0 {
+		return nil, "Endpoint did not contain the corresponding address"
+	}
+	// LH RWX volume endpoint should only have one subset and one port
+	if len(endpoint.Subsets) > 1 || len(endpoint.Subsets[0].Ports) > 1 {
+		return nil, fmt.Sprintf("Endpoint %s has more than one subSets", endpoint.Name)
+	}
+	if len(endpoint.Subsets[0].Ports) == 0 || endpoint.Subsets[0].Ports[0].Name != "nfs" {
+		return nil, fmt.Sprintf("Endpoint %s has no nfs port", endpoint.Name)
+	}
+
+	port := endpoint.Subsets[0].Ports[0]
+	export := &networkfsv2.NetworkFSExport{
+		Port:         port.Port,
+		Protocol:     port.Protocol,
+		ExportPath:   exportPath,
+		NFSVersions:  nfsVersions(observed.pv),
+		MountOptions: mountOptions(observed.pv),
+	}
+	for _, addr := range endpoint.Subsets[0].Addresses {
+		export.Addresses = append(export.Addresses, addr.IP)
+	}
+	if networkFS.Spec.Expose != nil {
+		addresses, port, reason := exposedAddresses(networkFS, observed.service, observed.nodes)
+		if reason != "" {
+			return nil, reason
+		}
+		export.Addresses = addresses
+		export.Port = port
+		export.Protocol = corev1.ProtocolTCP
+	}
+	export.MountSource = fmt.Sprintf("%s:%s", mountHost(export.Addresses[0]), exportPath)
+	return export, ""
+}
+
+// endpointAddress returns the address serving the export, empty if it is not exported
+func endpointAddress(status *networkfsv2.NetworkFSStatus) string {
+	if status.Export == nil || len(status.Export.Addresses) == 0 {
+		return ""
+	}
+	return status.Export.Addresses[0]
+}
+
+// mountHost brackets the IPv6 address so it can be used in the mount source
+func mountHost(address string) string {
+	if ip := net.ParseIP(address); ip != nil && ip.To4() == nil {
+		return "[" + address + "]"
+	}
+	return address
+}
+
+// nfsVersions returns the NFS version pinned by the volume mount options, or the versions served by the share-manager
+func nfsVersions(pv *corev1.PersistentVolume) []string {
+	for _, opt := range strings.Split(mountOptions(pv), ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(opt), "=")
+		if found && (key == "vers" || key == "nfsvers") {
+			return []string{value}
+		}
+	}
+	return append([]string{}, networkfsv2.DefaultNFSVersions...)
+}
+
+func mountOptions(pv *corev1.PersistentVolume) string {
+	if pv == nil || pv.Spec.CSI == nil {
+		return ""
+	}
+	return pv.Spec.CSI.VolumeAttributes["nfsOptions"]
+}
+
+// updateReadyCondition sets the Ready condition from the state of the export
+func updateReadyCondition(conds []networkfsv2.NetworkFSCondition, status *networkfsv2.NetworkFSStatus, now metav1.Time) []networkfsv2.NetworkFSCondition {
+	switch status.State {
+	case networkfsv2.NetworkFSStateEnabled:
+		return utils.SetNetworkFSCondition(conds, networkfsv2.ConditionTypeReady, corev1.ConditionTrue,
+			"Endpoint is ready", fmt.Sprintf("Export is served at %s", status.Export.MountSource), now)
+	case networkfsv2.NetworkFSStateEnabling:
+		return utils.SetNetworkFSCondition(conds, networkfsv2.ConditionTypeReady, corev1.ConditionFalse, "Endpoint is not ready", "", now)
+	case networkfsv2.NetworkFSStateDisabling:
+		return utils.SetNetworkFSCondition(conds, networkfsv2.ConditionTypeReady, corev1.ConditionFalse, "Export is disabling", "", now)
+	case networkfsv2.NetworkFSStateFailed:
+		return utils.SetNetworkFSCondition(conds, networkfsv2.ConditionTypeReady, corev1.ConditionFalse, "Transition is failed", "", now)
+	}
+	return utils.SetNetworkFSCondition(conds, networkfsv2.ConditionTypeReady, corev1.ConditionFalse, "Export is disabled", "", now)
+}
+
+// updateProgressingCondition sets the Progressing condition while the transition is ongoing, with the reason it is not completed yet
+func updateProgressingCondition(networkFS *networkfsv2.NetworkFilesystem, conds []networkfsv2.NetworkFSCondition, status *networkfsv2.NetworkFSStatus, observed *observedState) []networkfsv2.NetworkFSCondition {
+	switch status.State {
+	case networkfsv2.NetworkFSStateEnabling:
+		return utils.SetNetworkFSCondition(conds, networkfsv2.ConditionTypeProgressing, corev1.ConditionTrue,
+			"Export is enabling", blockingReason(networkFS, observed, status.State), observed.now)
+	case networkfsv2.NetworkFSStateDisabling:
+		return utils.SetNetworkFSCondition(conds, networkfsv2.ConditionTypeProgressing, corev1.ConditionTrue,
+			"Export is disabling", "Attachment tickets are removed, waiting for the ShareManager to stop", observed.now)
+	case networkfsv2.NetworkFSStateFailed:
+		return utils.SetNetworkFSCondition(conds, networkfsv2.ConditionTypeProgressing, corev1.ConditionFalse, "Transition is failed", "", observed.now)
+	}
+	if utils.IsNetworkFSConditionTrue(conds, networkfsv2.ConditionTypeBlocked) {
+		return utils.SetNetworkFSCondition(conds, networkfsv2.ConditionTypeProgressing, corev1.ConditionFalse, "Disable is blocked", "", observed.now)
+	}
+	return utils.SetNetworkFSCondition(conds, networkfsv2.ConditionTypeProgressing, corev1.ConditionFalse, "Desired state is reached", "", observed.now)
+}
+
+// updateEndpointChangedCondition turns the EndpointChanged condition false once it has been true for a while
+func updateEndpointChangedCondition(conds []networkfsv2.NetworkFSCondition, observed *observedState) []networkfsv2.NetworkFSCondition {
+	cond := utils.GetNetworkFSCondition(conds, networkfsv2.ConditionTypeEndpointChanged)
+	if cond == nil || cond.Status != corev1.ConditionTrue || observed.now.Sub(cond.LastTransitionTime.Time) < endpointChangedPeriod {
+		return conds
+	}
+	return utils.SetNetworkFSCondition(conds, networkfsv2.ConditionTypeEndpointChanged, corev1.ConditionFalse, "Endpoint is stable", "", observed.now)
+}
+
+// updateBlockedCondition sets the Blocked condition while the consumers block the disable request, and clears it afterwards
+func updateBlockedCondition(networkFS *networkfsv2.NetworkFilesystem, desiredState networkfsv2.NetworkFSState, desiredStateReason string, conds []networkfsv2.NetworkFSCondition,
+	consumers []networkfsv2.NetworkFSConsumer, blocked bool, now metav1.Time) []networkfsv2.NetworkFSCondition {
+	if blocked {
+		return utils.SetNetworkFSCondition(conds, networkfsv2.ConditionTypeBlocked, corev1.ConditionTrue, "Volume is in use", blockedMessage(desiredStateReason, consumers), now)
+	}
+
+	if !utils.IsNetworkFSConditionTrue(conds, networkfsv2.ConditionTypeBlocked) {
+		return conds
+	}
+	reason := "Volume is not in use"
+	switch {
+	case desiredState != networkfsv2.NetworkFSStateDisabled:
+		reason = "Disable is cancelled"
+	case networkFS.Spec.Force:
+		reason = "Disable is forced"
+	}
+	return utils.SetNetworkFSCondition(conds, networkfsv2.ConditionTypeBlocked, corev1.ConditionFalse, reason, "", now)
+}
+
+// updateOrphanedCondition sets the Orphaned condition while the volume reference is not resolved or the Longhorn
+// volume is gone, and clears it when the volume is back
+func updateOrphanedCondition(conds []networkfsv2.NetworkFSCondition, observed *observedState) []networkfsv2.NetworkFSCondition {
+	if observed.volume == nil {
+		reason := "Volume is not found"
+		message := fmt.Sprintf("The Longhorn volume %s of the network filesystem is gone", observed.volumeName)
+		if observed.unresolved != nil {
+			reason = "Volume is not resolved"
+			message = observed.unresolved.Error()
+		}
+		return utils.SetNetworkFSCondition(conds, networkfsv2.ConditionTypeOrphaned, corev1.ConditionTrue, reason, message, observed.now)
+	}
+
+	if !utils.IsNetworkFSConditionTrue(conds, networkfsv2.ConditionTypeOrphaned) {
+		return conds
+	}
+	return utils.SetNetworkFSCondition(conds, networkfsv2.ConditionTypeOrphaned, corev1.ConditionFalse, "Volume is found", "", observed.now)
+}
+
+func isShareManagerStopped(sm *longhornv2.ShareManager) bool {
+	return sm == nil || sm.Status.State == longhornv2.ShareManagerStateStopped
+}
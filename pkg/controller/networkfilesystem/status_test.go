@@ -0,0 +1,330 @@
+package networkfilesystem
+
+import (
+	"testing"
+	"time"
+
+	longhornv2 "github.com/longhorn/longhorn-manager/k8s/pkg/apis/longhorn/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+const testVolume = "pvc-1"
+
+func shareManager(state longhornv2.ShareManagerState) *longhornv2.ShareManager {
+	sm := &longhornv2.ShareManager{ObjectMeta: metav1.ObjectMeta{Namespace: utils.LHNameSpace, Name: testVolume}}
+	sm.Status.State = state
+	if state == longhornv2.ShareManagerStateRunning {
+		sm.Status.Endpoint = "nfs://10.53.0.20/" + testVolume
+	}
+	return sm
+}
+
+func shareManagerEndpoint(address string) *corev1.Endpoints {
+	return &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: utils.LHNameSpace, Name: testVolume},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: []corev1.EndpointAddress{{IP: address}},
+			Ports:     []corev1.EndpointPort{{Name: "nfs", Port: 2049, Protocol: corev1.ProtocolTCP}},
+		}},
+	}
+}
+
+func exportedAt(address string) *networkfsv2.NetworkFSExport {
+	return &networkfsv2.NetworkFSExport{Addresses: []string{address}, Port: 2049, ExportPath: "/" + testVolume, MountSource: address + ":/" + testVolume}
+}
+
+// cond is the expected status and reason of a condition
+type cond struct {
+	status corev1.ConditionStatus
+	reason string
+}
+
+func TestComputeStatus(t *testing.T) {
+	now := metav1.NewTime(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC))
+	started := metav1.NewTime(now.Add(-time.Minute))
+	running := shareManager(longhornv2.ShareManagerStateRunning)
+	stopped := shareManager(longhornv2.ShareManagerStateStopped)
+	inUse := []*corev1.Pod{{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"}, Spec: corev1.PodSpec{NodeName: "node-1"}}}
+	blockedConds := utils.SetNetworkFSCondition(nil, networkfsv2.ConditionTypeBlocked, corev1.ConditionTrue, "Volume is in use", "", started)
+
+	tests := []struct {
+		name         string
+		spec         networkfsv2.NetworkFSSpec
+		prev         networkfsv2.NetworkFSStatus
+		desiredState networkfsv2.NetworkFSState
+		shareManager *longhornv2.ShareManager
+		endpoint     *corev1.Endpoints
+		pods         []*corev1.Pod
+
+		wantState      networkfsv2.NetworkFSState
+		wantAddress    string
+		wantTransition networkfsv2.NetworkFSState
+		wantConds      map[networkfsv2.ConditionType]cond
+	}{
+		{
+			name:           "enable waits for the ShareManager",
+			prev:           networkfsv2.NetworkFSStatus{State: networkfsv2.NetworkFSStateDisabled},
+			desiredState:   networkfsv2.NetworkFSStateEnabled,
+			wantState:      networkfsv2.NetworkFSStateEnabling,
+			wantTransition: networkfsv2.NetworkFSStateEnabled,
+			wantConds: map[networkfsv2.ConditionType]cond{
+				networkfsv2.ConditionTypeReady:       {corev1.ConditionFalse, "Endpoint is not ready"},
+				networkfsv2.ConditionTypeProgressing: {corev1.ConditionTrue, "Export is enabling"},
+				networkfsv2.ConditionTypeDegraded:    {corev1.ConditionFalse, "Transition is restarted"},
+			},
+		},
+		{
+			name:           "enable waits for the endpoint",
+			prev:           networkfsv2.NetworkFSStatus{State: networkfsv2.NetworkFSStateEnabling, Transition: &networkfsv2.NetworkFSTransition{DesiredState: networkfsv2.NetworkFSStateEnabled, StartTime: started}},
+			desiredState:   networkfsv2.NetworkFSStateEnabled,
+			shareManager:   running,
+			wantState:      networkfsv2.NetworkFSStateEnabling,
+			wantTransition: networkfsv2.NetworkFSStateEnabled,
+			wantConds: map[networkfsv2.ConditionType]cond{
+				networkfsv2.ConditionTypeReady:       {corev1.ConditionFalse, "Endpoint is not ready"},
+				networkfsv2.ConditionTypeProgressing: {corev1.ConditionTrue, "Export is enabling"},
+			},
+		},
+		{
+			name:         "enabled",
+			prev:         networkfsv2.NetworkFSStatus{State: networkfsv2.NetworkFSStateEnabling, Transition: &networkfsv2.NetworkFSTransition{DesiredState: networkfsv2.NetworkFSStateEnabled, StartTime: started}},
+			desiredState: networkfsv2.NetworkFSStateEnabled,
+			shareManager: running,
+			endpoint:     shareManagerEndpoint("10.53.0.20"),
+			wantState:    networkfsv2.NetworkFSStateEnabled,
+			wantAddress:  "10.53.0.20",
+			wantConds: map[networkfsv2.ConditionType]cond{
+				networkfsv2.ConditionTypeReady:       {corev1.ConditionTrue, "Endpoint is ready"},
+				networkfsv2.ConditionTypeProgressing: {corev1.ConditionFalse, "Desired state is reached"},
+				networkfsv2.ConditionTypeDegraded:    {corev1.ConditionFalse, "Desired state is reached"},
+			},
+		},
+		{
+			name:         "endpoint changed",
+			prev:         networkfsv2.NetworkFSStatus{State: networkfsv2.NetworkFSStateEnabled, Export: exportedAt("10.53.0.20")},
+			desiredState: networkfsv2.NetworkFSStateEnabled,
+			shareManager: running,
+			endpoint:     shareManagerEndpoint("10.53.0.21"),
+			wantState:    networkfsv2.NetworkFSStateEnabled,
+			wantAddress:  "10.53.0.21",
+			wantConds: map[networkfsv2.ConditionType]cond{
+				networkfsv2.ConditionTypeReady:           {corev1.ConditionTrue, "Endpoint is ready"},
+				networkfsv2.ConditionTypeEndpointChanged: {corev1.ConditionTrue, "Endpoint is changed"},
+			},
+		},
+		{
+			name: "endpoint stable again",
+			prev: networkfsv2.NetworkFSStatus{
+				State:          networkfsv2.NetworkFSStateEnabled,
+				Export:         exportedAt("10.53.0.21"),
+				NetworkFSConds: utils.SetNetworkFSCondition(nil, networkfsv2.ConditionTypeEndpointChanged, corev1.ConditionTrue, "Endpoint is changed", "", metav1.NewTime(now.Add(-endpointChangedPeriod))),
+			},
+			desiredState: networkfsv2.NetworkFSStateEnabled,
+			shareManager: running,
+			endpoint:     shareManagerEndpoint("10.53.0.21"),
+			wantState:    networkfsv2.NetworkFSStateEnabled,
+			wantAddress:  "10.53.0.21",
+			wantConds: map[networkfsv2.ConditionType]cond{
+				networkfsv2.ConditionTypeEndpointChanged: {corev1.ConditionFalse, "Endpoint is stable"},
+			},
+		},
+		{
+			name:           "disable waits for the ShareManager to stop",
+			prev:           networkfsv2.NetworkFSStatus{State: networkfsv2.NetworkFSStateEnabled, Export: exportedAt("10.53.0.20")},
+			desiredState:   networkfsv2.NetworkFSStateDisabled,
+			shareManager:   running,
+			endpoint:       shareManagerEndpoint("10.53.0.20"),
+			wantState:      networkfsv2.NetworkFSStateDisabling,
+			wantAddress:    "10.53.0.20",
+			wantTransition: networkfsv2.NetworkFSStateDisabled,
+			wantConds: map[networkfsv2.ConditionType]cond{
+				networkfsv2.ConditionTypeReady:       {corev1.ConditionFalse, "Export is disabling"},
+				networkfsv2.ConditionTypeProgressing: {corev1.ConditionTrue, "Export is disabling"},
+			},
+		},
+		{
+			name:         "disabled",
+			prev:         networkfsv2.NetworkFSStatus{State: networkfsv2.NetworkFSStateDisabling, Export: exportedAt("10.53.0.20"), Transition: &networkfsv2.NetworkFSTransition{DesiredState: networkfsv2.NetworkFSStateDisabled, StartTime: started}},
+			desiredState: networkfsv2.NetworkFSStateDisabled,
+			shareManager: stopped,
+			wantState:    networkfsv2.NetworkFSStateDisabled,
+			wantConds: map[networkfsv2.ConditionType]cond{
+				networkfsv2.ConditionTypeReady:       {corev1.ConditionFalse, "Export is disabled"},
+				networkfsv2.ConditionTypeProgressing: {corev1.ConditionFalse, "Desired state is reached"},
+			},
+		},
+		{
+			name:         "new network filesystem of a volume used by other workloads",
+			desiredState: networkfsv2.NetworkFSStateDisabled,
+			shareManager: running,
+			endpoint:     shareManagerEndpoint("10.53.0.20"),
+			wantState:    networkfsv2.NetworkFSStateDisabled,
+			wantConds: map[networkfsv2.ConditionType]cond{
+				networkfsv2.ConditionTypeReady: {corev1.ConditionFalse, "Export is disabled"},
+			},
+		},
+		{
+			name:         "disable blocked by the consumers",
+			prev:         networkfsv2.NetworkFSStatus{State: networkfsv2.NetworkFSStateEnabled, Export: exportedAt("10.53.0.20")},
+			desiredState: networkfsv2.NetworkFSStateDisabled,
+			shareManager: running,
+			endpoint:     shareManagerEndpoint("10.53.0.20"),
+			pods:         inUse,
+			wantState:    networkfsv2.NetworkFSStateEnabled,
+			wantAddress:  "10.53.0.20",
+			wantConds: map[networkfsv2.ConditionType]cond{
+				networkfsv2.ConditionTypeReady:       {corev1.ConditionTrue, "Endpoint is ready"},
+				networkfsv2.ConditionTypeBlocked:     {corev1.ConditionTrue, "Volume is in use"},
+				networkfsv2.ConditionTypeProgressing: {corev1.ConditionFalse, "Disable is blocked"},
+			},
+		},
+		{
+			name:           "forced disable",
+			spec:           networkfsv2.NetworkFSSpec{Force: true},
+			prev:           networkfsv2.NetworkFSStatus{State: networkfsv2.NetworkFSStateEnabled, Export: exportedAt("10.53.0.20"), NetworkFSConds: blockedConds},
+			desiredState:   networkfsv2.NetworkFSStateDisabled,
+			shareManager:   running,
+			endpoint:       shareManagerEndpoint("10.53.0.20"),
+			pods:           inUse,
+			wantState:      networkfsv2.NetworkFSStateDisabling,
+			wantAddress:    "10.53.0.20",
+			wantTransition: networkfsv2.NetworkFSStateDisabled,
+			wantConds: map[networkfsv2.ConditionType]cond{
+				networkfsv2.ConditionTypeBlocked: {corev1.ConditionFalse, "Disable is forced"},
+			},
+		},
+		{
+			name:         "blocked disable cancelled",
+			prev:         networkfsv2.NetworkFSStatus{State: networkfsv2.NetworkFSStateEnabled, Export: exportedAt("10.53.0.20"), NetworkFSConds: blockedConds},
+			desiredState: networkfsv2.NetworkFSStateEnabled,
+			shareManager: running,
+			endpoint:     shareManagerEndpoint("10.53.0.20"),
+			pods:         inUse,
+			wantState:    networkfsv2.NetworkFSStateEnabled,
+			wantAddress:  "10.53.0.20",
+			wantConds: map[networkfsv2.ConditionType]cond{
+				networkfsv2.ConditionTypeBlocked: {corev1.ConditionFalse, "Disable is cancelled"},
+			},
+		},
+		{
+			name: "failed enable completes",
+			prev: networkfsv2.NetworkFSStatus{
+				State:          networkfsv2.NetworkFSStateFailed,
+				Transition:     &networkfsv2.NetworkFSTransition{DesiredState: networkfsv2.NetworkFSStateEnabled, StartTime: metav1.NewTime(now.Add(-time.Hour))},
+				NetworkFSConds: utils.SetNetworkFSCondition(nil, networkfsv2.ConditionTypeDegraded, corev1.ConditionTrue, "Enable is timed out", "", started),
+			},
+			desiredState: networkfsv2.NetworkFSStateEnabled,
+			shareManager: running,
+			endpoint:     shareManagerEndpoint("10.53.0.20"),
+			wantState:    networkfsv2.NetworkFSStateEnabled,
+			wantAddress:  "10.53.0.20",
+			wantConds: map[networkfsv2.ConditionType]cond{
+				networkfsv2.ConditionTypeReady:    {corev1.ConditionTrue, "Endpoint is ready"},
+				networkfsv2.ConditionTypeDegraded: {corev1.ConditionFalse, "Desired state is reached"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			networkFS := &networkfsv2.NetworkFilesystem{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pvc-1", Generation: 3},
+				Spec:       tt.spec,
+				Status:     tt.prev,
+			}
+			observed := &observedState{
+				volumeName:   testVolume,
+				volume:       &longhornv2.Volume{},
+				shareManager: tt.shareManager,
+				endpoint:     tt.endpoint,
+				pods:         tt.pods,
+				now:          now,
+				desiredState: tt.desiredState,
+			}
+
+			status := computeStatus(networkFS, observed)
+			if status.State != tt.wantState {
+				t.Errorf("state = %s, want %s", status.State, tt.wantState)
+			}
+			if status.ObservedGeneration != 3 {
+				t.Errorf("observed generation = %d, want 3", status.ObservedGeneration)
+			}
+			if address := endpointAddress(&status); address != tt.wantAddress {
+				t.Errorf("address = %q, want %q", address, tt.wantAddress)
+			}
+			if tt.wantAddress != "" && status.Export.MountSource != tt.wantAddress+":/"+testVolume {
+				t.Errorf("mount source = %s, want %s:/%s", status.Export.MountSource, tt.wantAddress, testVolume)
+			}
+			switch {
+			case tt.wantTransition == "" && status.Transition != nil:
+				t.Errorf("transition = %+v, want none", status.Transition)
+			case tt.wantTransition != "" && (status.Transition == nil || status.Transition.DesiredState != tt.wantTransition):
+				t.Errorf("transition = %+v, want one to %s", status.Transition, tt.wantTransition)
+			}
+			for condType, want := range tt.wantConds {
+				got := utils.GetNetworkFSCondition(status.NetworkFSConds, condType)
+				if got == nil || got.Status != want.status || got.Reason != want.reason {
+					t.Errorf("condition %s = %+v, want %s (%s)", condType, got, want.status, want.reason)
+				}
+			}
+
+			// the same observed state yields the same status
+			networkFS.Status = status
+			again := computeStatus(networkFS, observed)
+			if again.State != status.State || len(again.NetworkFSConds) != len(status.NetworkFSConds) {
+				t.Fatalf("status changed on the second pass: %s, want %s", again.State, status.State)
+			}
+			for i := range status.NetworkFSConds {
+				if again.NetworkFSConds[i] != status.NetworkFSConds[i] {
+					t.Errorf("condition %s changed on the second pass: %+v, want %+v", status.NetworkFSConds[i].Type, again.NetworkFSConds[i], status.NetworkFSConds[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBlockedDisableReason(t *testing.T) {
+	now := metav1.NewTime(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC))
+	inUse := []*corev1.Pod{{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"}, Spec: corev1.PodSpec{NodeName: "node-1"}}}
+
+	tests := []struct {
+		reason      string
+		wantMessage string
+	}{
+		{reason: networkfsv2.DesiredStateReasonSpec, wantMessage: "Disable is requested, but the volume is still used by Pod default/app, set spec.force to disable anyway"},
+		{reason: networkfsv2.DesiredStateReasonScheduleClosed, wantMessage: "Schedule window is closed, but the volume is still used by Pod default/app, set spec.force to disable anyway"},
+		{reason: networkfsv2.DesiredStateReasonLeaseExpired, wantMessage: "Lease expired, but the volume is still used by Pod default/app, set spec.force to disable anyway"},
+		{reason: networkfsv2.DesiredStateReasonIdle, wantMessage: "Export is idle, but the volume is still used by Pod default/app, set spec.force to disable anyway"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.reason, func(t *testing.T) {
+			networkFS := &networkfsv2.NetworkFilesystem{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: testVolume},
+				Status:     networkfsv2.NetworkFSStatus{State: networkfsv2.NetworkFSStateEnabled, Export: exportedAt("10.53.0.20")},
+			}
+			status := computeStatus(networkFS, &observedState{
+				volumeName:         testVolume,
+				volume:             &longhornv2.Volume{},
+				shareManager:       shareManager(longhornv2.ShareManagerStateRunning),
+				endpoint:           shareManagerEndpoint("10.53.0.20"),
+				pods:               inUse,
+				now:                now,
+				desiredState:       networkfsv2.NetworkFSStateDisabled,
+				desiredStateReason: tt.reason,
+			})
+			// the export stays up, the desired state tells the deferred request
+			if status.State != networkfsv2.NetworkFSStateEnabled || status.DesiredState != networkfsv2.NetworkFSStateDisabled || status.DesiredStateReason != tt.reason {
+				t.Errorf("state = %s, desired state = %s (%s), want enabled and disabled (%s)", status.State, status.DesiredState, status.DesiredStateReason, tt.reason)
+			}
+			blocked := utils.GetNetworkFSCondition(status.NetworkFSConds, networkfsv2.ConditionTypeBlocked)
+			if blocked == nil || blocked.Status != corev1.ConditionTrue || blocked.Message != tt.wantMessage {
+				t.Errorf("Blocked = %+v, want the message %q", blocked, tt.wantMessage)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package networkfilesystem
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+const (
+	// the ongoing transition is checked again after the time it has been running for, within these bounds
+	minRetryInterval = 5 * time.Second
+	maxRetryInterval = 5 * time.Minute
+
+	// the EndpointChanged condition is kept true for this period after the change, so the clients can notice it
+	endpointChangedPeriod = 10 * time.Minute
+)
+
+// transitionTimeout returns the deadline of the transition, the spec overrides the global default
+func transitionTimeout(networkFS *networkfsv2.NetworkFilesystem, defaultTimeout time.Duration) time.Duration {
+	if networkFS.Spec.TransitionTimeout != nil {
+		return networkFS.Spec.TransitionTimeout.Duration
+	}
+	return defaultTimeout
+}
+
+// isExporting returns true if the network filesystem is exported or on its way to it
+func isExporting(status *networkfsv2.NetworkFSStatus) bool {
+	switch status.State {
+	case networkfsv2.NetworkFSStateEnabled, networkfsv2.NetworkFSStateEnabling:
+		return true
+	case networkfsv2.NetworkFSStateFailed:
+		return status.Transition != nil && status.Transition.DesiredState == networkfsv2.NetworkFSStateEnabled
+	}
+	return false
+}
+
+// transitionalState returns the state of the ongoing transition to the desired state
+func transitionalState(desiredState networkfsv2.NetworkFSState) networkfsv2.NetworkFSState {
+	if desiredState == networkfsv2.NetworkFSStateEnabled {
+		return networkfsv2.NetworkFSStateEnabling
+	}
+	return networkfsv2.NetworkFSStateDisabling
+}
+
+// blockingReason returns the last observed reason why the transition is not completed yet
+func blockingReason(networkFS *networkfsv2.NetworkFilesystem, observed *observedState, state networkfsv2.NetworkFSState) string {
+	if state == networkfsv2.NetworkFSStateDisabling {
+		if observed.shareManager == nil {
+			return "ShareManager is not found"
+		}
+		return fmt.Sprintf("ShareManager is %s", observed.shareManager.Status.State)
+	}
+
+	if lhva := observed.volumeAttachment; lhva == nil {
+		return "VolumeAttachment is not found"
+	} else if ticketStatus := lhva.Status.AttachmentTicketStatuses[ticketID(networkFS)]; ticketStatus == nil || !ticketStatus.Satisfied {
+		reason := "VolumeAttachment ticket not satisfied"
+		if ticketStatus != nil {
+			for _, cond := range ticketStatus.Conditions {
+				if cond.Message != "" {
+					reason = fmt.Sprintf("%s: %s", reason, cond.Message)
+					break
+				}
+			}
+		}
+		return reason
+	}
+	_, reason := exportInfo(networkFS, observed)
+	return reason
+}
+
+// updateTransition tracks the ongoing transition, and marks the network filesystem as Failed once it misses the deadline.
+// A transition to the other desired state restarts the attempt.
+func updateTransition(networkFS *networkfsv2.NetworkFilesystem, observed *observedState, status networkfsv2.NetworkFSStatus) networkfsv2.NetworkFSStatus {
+	if status.State != networkfsv2.NetworkFSStateEnabling && status.State != networkfsv2.NetworkFSStateDisabling {
+		status.Transition = nil
+		status.NetworkFSConds = clearDegradedCondition(status.NetworkFSConds, "Desired state is reached", observed.now)
+		return status
+	}
+
+	desiredState := networkfsv2.NetworkFSStateEnabled
+	if status.State == networkfsv2.NetworkFSStateDisabling {
+		desiredState = networkfsv2.NetworkFSStateDisabled
+	}
+	if status.Transition == nil || status.Transition.DesiredState != desiredState {
+		status.Transition = &networkfsv2.NetworkFSTransition{
+			DesiredState: desiredState,
+			StartTime:    observed.now.Rfc3339Copy(),
+		}
+		status.NetworkFSConds = clearDegradedCondition(status.NetworkFSConds, "Transition is restarted", observed.now)
+	}
+
+	timeout := observed.transitionTimeout
+	if timeout <= 0 || observed.now.Sub(status.Transition.StartTime.Time) < timeout {
+		return status
+	}
+
+	status.State = networkfsv2.NetworkFSStateFailed
+	reason := "Enable is timed out"
+	if desiredState == networkfsv2.NetworkFSStateDisabled {
+		reason = "Disable is timed out"
+	}
+	message := fmt.Sprintf("%s, the transition did not complete within %s", blockingReason(networkFS, observed, transitionalState(desiredState)), timeout)
+	status.NetworkFSConds = utils.SetNetworkFSCondition(status.NetworkFSConds, networkfsv2.ConditionTypeDegraded, corev1.ConditionTrue, reason, message, observed.now)
+	return status
+}
+
+func clearDegradedCondition(conds []networkfsv2.NetworkFSCondition, reason string, now metav1.Time) []networkfsv2.NetworkFSCondition {
+	if utils.GetNetworkFSCondition(conds, networkfsv2.ConditionTypeDegraded) == nil {
+		// the condition is set on the first transition of the network filesystem
+		return utils.SetNetworkFSCondition(conds, networkfsv2.ConditionTypeDegraded, corev1.ConditionFalse, reason, "", now)
+	}
+	if !utils.IsNetworkFSConditionTrue(conds, networkfsv2.ConditionTypeDegraded) {
+		return conds
+	}
+	return utils.SetNetworkFSCondition(conds, networkfsv2.ConditionTypeDegraded, corev1.ConditionFalse, reason, "", now)
+}
+
+// retryAfter returns the delay before the network filesystem is checked again. The interval of the ongoing transition
+// doubles as the transition runs longer, and neither its deadline, the expiry of the EndpointChanged condition, the
+// automatic disable, the lease, the schedule, the idle timeout nor the failback is overslept. It returns false if there is nothing to check again.
+func retryAfter(status *networkfsv2.NetworkFSStatus, observed *observedState) (time.Duration, bool) {
+	delay, retry := transitionRetryAfter(status, observed)
+	if leaseDelay, leaseRetry := leaseRetryAfter(status, observed.now); leaseRetry && (!retry || leaseDelay < delay) {
+		delay, retry = leaseDelay, true
+	}
+	if scheduleDelay, scheduleRetry := scheduleRetryAfter(status, observed.now); scheduleRetry && (!retry || scheduleDelay < delay) {
+		delay, retry = scheduleDelay, true
+	}
+	if idleDelay, idleRetry := idleRetryAfter(status, observed.now); idleRetry && (!retry || idleDelay < delay) {
+		delay, retry = idleDelay, true
+	}
+	if failbackDelay, failbackRetry := placementRetryAfter(status, observed.now); failbackRetry && (!retry || failbackDelay < delay) {
+		delay, retry = failbackDelay, true
+	}
+	if status.AutoDisableTime != nil {
+		expiry := status.AutoDisableTime.Sub(observed.now.Time)
+		if expiry < minRetryInterval {
+			expiry = minRetryInterval
+		}
+		if !retry || expiry < delay {
+			delay, retry = expiry, true
+		}
+	}
+	if cond := utils.GetNetworkFSCondition(status.NetworkFSConds, networkfsv2.ConditionTypeEndpointChanged); cond != nil && cond.Status == corev1.ConditionTrue {
+		expiry := endpointChangedPeriod - observed.now.Sub(cond.LastTransitionTime.Time)
+		if expiry < minRetryInterval {
+			expiry = minRetryInterval
+		}
+		if !retry || expiry < delay {
+			delay, retry = expiry, true
+		}
+	}
+	return delay, retry
+}
+
+func transitionRetryAfter(status *networkfsv2.NetworkFSStatus, observed *observedState) (time.Duration, bool) {
+	if status.Transition == nil {
+		return 0, false
+	}
+	elapsed := observed.now.Sub(status.Transition.StartTime.Time)
+	delay := elapsed
+	if delay < minRetryInterval {
+		delay = minRetryInterval
+	}
+	if delay > maxRetryInterval {
+		delay = maxRetryInterval
+	}
+	if timeout := observed.transitionTimeout; timeout > 0 && elapsed < timeout && timeout-elapsed < delay {
+		delay = timeout - elapsed
+	}
+	return delay, true
+}
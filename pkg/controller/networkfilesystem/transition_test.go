@@ -0,0 +1,144 @@
+package networkfilesystem
+
+import (
+	"testing"
+	"time"
+
+	longhornv2 "github.com/longhorn/longhorn-manager/k8s/pkg/apis/longhorn/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+func TestTransitionTimeout(t *testing.T) {
+	timeout := 10 * time.Minute
+	clock := clocktesting.NewFakePassiveClock(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC))
+	networkFS := &networkfsv2.NetworkFilesystem{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pvc-1"},
+		Status:     networkfsv2.NetworkFSStatus{State: networkfsv2.NetworkFSStateDisabled},
+	}
+	// the ticket is satisfied, the ShareManager is the one blocking the transition
+	lhva := attachedOn(networkFS, "node-1")
+	lhva.Status.AttachmentTicketStatuses = map[string]*longhornv2.AttachmentTicketStatus{
+		ticketID(networkFS): {ID: ticketID(networkFS), Satisfied: true},
+	}
+	observe := func() *observedState {
+		return &observedState{
+			volumeAttachment:  lhva,
+			volumeName:        testVolume,
+			volume:            &longhornv2.Volume{},
+			shareManager:      shareManager(longhornv2.ShareManagerStateStarting),
+			now:               metav1.NewTime(clock.Now()),
+			transitionTimeout: timeout,
+			desiredState:      networkfsv2.NetworkFSStateEnabled,
+		}
+	}
+
+	// the ShareManager never starts, the requeues walk the clock up to the deadline
+	steps := []struct {
+		wantState networkfsv2.NetworkFSState
+		wantDelay time.Duration
+	}{
+		{wantState: networkfsv2.NetworkFSStateEnabling, wantDelay: minRetryInterval},
+		{wantState: networkfsv2.NetworkFSStateEnabling, wantDelay: 5 * time.Second},
+		{wantState: networkfsv2.NetworkFSStateEnabling, wantDelay: 10 * time.Second},
+		{wantState: networkfsv2.NetworkFSStateEnabling, wantDelay: 20 * time.Second},
+		{wantState: networkfsv2.NetworkFSStateEnabling, wantDelay: 40 * time.Second},
+		{wantState: networkfsv2.NetworkFSStateEnabling, wantDelay: 80 * time.Second},
+		{wantState: networkfsv2.NetworkFSStateEnabling, wantDelay: 160 * time.Second},
+		// the delay is cut to the deadline
+		{wantState: networkfsv2.NetworkFSStateEnabling, wantDelay: timeout - 320*time.Second},
+		{wantState: networkfsv2.NetworkFSStateFailed, wantDelay: maxRetryInterval},
+	}
+	for i, step := range steps {
+		observed := observe()
+		status := computeStatus(networkFS, observed)
+		if status.State != step.wantState {
+			t.Fatalf("step %d at %s: state = %s, want %s", i, observed.now.UTC(), status.State, step.wantState)
+		}
+		delay, retry := retryAfter(&status, observed)
+		if !retry || delay != step.wantDelay {
+			t.Fatalf("step %d at %s: retry after %s (%t), want %s", i, observed.now.UTC(), delay, retry, step.wantDelay)
+		}
+		networkFS.Status = status
+		clock.SetTime(clock.Now().Add(delay))
+	}
+
+	failed := networkFS.Status
+	degraded := utils.GetNetworkFSCondition(failed.NetworkFSConds, networkfsv2.ConditionTypeDegraded)
+	if degraded == nil || degraded.Status != corev1.ConditionTrue || degraded.Reason != "Enable is timed out" {
+		t.Fatalf("Degraded = %+v, want true with the timed out enable", degraded)
+	}
+	if want := "ShareManager is starting, the transition did not complete within 10m0s"; degraded.Message != want {
+		t.Errorf("Degraded message = %q, want %q", degraded.Message, want)
+	}
+	if ready := utils.GetNetworkFSCondition(failed.NetworkFSConds, networkfsv2.ConditionTypeReady); ready == nil || ready.Reason != "Transition is failed" {
+		t.Errorf("Ready = %+v, want the failed transition", ready)
+	}
+	if failed.Transition == nil || !failed.Transition.StartTime.Equal(&metav1.Time{Time: time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)}) {
+		t.Errorf("transition = %+v, want the one started at the first step", failed.Transition)
+	}
+
+	// the failed transition is still retried and completes once the ShareManager is up
+	observed := observe()
+	observed.shareManager = shareManager(longhornv2.ShareManagerStateRunning)
+	observed.endpoint = shareManagerEndpoint("10.53.0.20")
+	status := computeStatus(networkFS, observed)
+	if status.State != networkfsv2.NetworkFSStateEnabled || status.Transition != nil {
+		t.Fatalf("state = %s, transition = %+v, want enabled", status.State, status.Transition)
+	}
+	if utils.IsNetworkFSConditionTrue(status.NetworkFSConds, networkfsv2.ConditionTypeDegraded) {
+		t.Errorf("Degraded is still true")
+	}
+
+	// the other desired state restarts the transition with a new deadline
+	networkFS.Status = failed
+	observed = observe()
+	observed.desiredState = networkfsv2.NetworkFSStateDisabled
+	status = computeStatus(networkFS, observed)
+	if status.State != networkfsv2.NetworkFSStateDisabling || status.Transition == nil || !status.Transition.StartTime.Equal(&observed.now) {
+		t.Fatalf("state = %s, transition = %+v, want a disable started now", status.State, status.Transition)
+	}
+	if degraded := utils.GetNetworkFSCondition(status.NetworkFSConds, networkfsv2.ConditionTypeDegraded); degraded.Status != corev1.ConditionFalse || degraded.Reason != "Transition is restarted" {
+		t.Errorf("Degraded = %+v, want false with the restarted transition", degraded)
+	}
+}
+
+func TestTransitionRetryAfter(t *testing.T) {
+	now := metav1.NewTime(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name      string
+		elapsed   time.Duration
+		timeout   time.Duration
+		wantDelay time.Duration
+	}{
+		{name: "just started", elapsed: 0, wantDelay: minRetryInterval},
+		{name: "below the minimum", elapsed: 3 * time.Second, wantDelay: minRetryInterval},
+		{name: "doubles the elapsed time", elapsed: 30 * time.Second, wantDelay: 30 * time.Second},
+		{name: "above the maximum", elapsed: time.Hour, wantDelay: maxRetryInterval},
+		{name: "cut to the deadline", elapsed: 2 * time.Minute, timeout: 3 * time.Minute, wantDelay: time.Minute},
+		{name: "deadline passed", elapsed: 4 * time.Minute, timeout: 3 * time.Minute, wantDelay: 4 * time.Minute},
+		{name: "no deadline", elapsed: 2 * time.Minute, wantDelay: 2 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := &networkfsv2.NetworkFSStatus{Transition: &networkfsv2.NetworkFSTransition{
+				DesiredState: networkfsv2.NetworkFSStateEnabled,
+				StartTime:    metav1.NewTime(now.Add(-tt.elapsed)),
+			}}
+			delay, retry := transitionRetryAfter(status, &observedState{now: now, transitionTimeout: tt.timeout})
+			if !retry || delay != tt.wantDelay {
+				t.Errorf("retry after %s (%t), want %s", delay, retry, tt.wantDelay)
+			}
+		})
+	}
+
+	if _, retry := transitionRetryAfter(&networkfsv2.NetworkFSStatus{}, &observedState{now: now}); retry {
+		t.Errorf("retry without a transition")
+	}
+}
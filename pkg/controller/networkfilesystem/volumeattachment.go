@@ -0,0 +1,218 @@
+package networkfilesystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	longhornv2 "github.com/longhorn/longhorn-manager/k8s/pkg/apis/longhorn/v1beta2"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+const (
+	// ticketIDPrefix makes the attachment tickets written by the networkfs-manager recognisable
+	ticketIDPrefix = "networkfs-manager-"
+	// ticketType is the attacher type of our ticket, Longhorn only brings up the share-manager of an RWX volume for CSI
+	// tickets, so the ticket is marked with networkfsv2.AttachmentParameterNetworkFS instead
+	ticketType = longhornv2.AttacherTypeCSIAttacher
+)
+
+// updateLHVolumeAttachment writes the ticket of the network filesystem on the node of the placement, or removes its tickets
+func (c *Controller) updateLHVolumeAttachment(networkFS *networkfsv2.NetworkFilesystem, volumeName string, placement *networkfsv2.NetworkFSPlacementStatus, attach bool) error {
+	logrus.Debugf("Update Longhorn volume attachment %s for network filesystem %s, attach: %v", volumeName, networkFS.Name, attach)
+
+	// get Longhorn volume attachment
+	lhva, err := c.VolumeAttachmentCache.Get(utils.LHNameSpace, volumeName)
+	if err != nil {
+		if errors.IsNotFound(err) && !attach {
+			// no volume attachment, no ticket to remove
+			return nil
+		}
+		logrus.Errorf("Failed to get Longhorn volume attachment %s: %v", volumeName, err)
+		return err
+	}
+
+	if attach {
+		return c.doAttachLHVolumeAttachment(networkFS, lhva, placement)
+	}
+	return c.doDeattachLHVolumeAttachment(networkFS, lhva)
+}
+
+// doDeattachLHVolumeAttachment removes the tickets of the network filesystem, the other tickets are left untouched
+func (c *Controller) doDeattachLHVolumeAttachment(networkFS *networkfsv2.NetworkFilesystem, lhva *longhornv2.VolumeAttachment) error {
+	tickets := detachTickets(networkFS, lhva)
+	if len(tickets) == 0 {
+		return nil
+	}
+
+	logrus.Infof("Remove attachment tickets %v of Longhorn volume attachment %s", sortedTicketIDs(tickets), lhva.Name)
+	if err := c.patchAttachmentTickets(lhva.Name, tickets); err != nil {
+		return err
+	}
+	c.recorder.Eventf(networkFS, corev1.EventTypeNormal, EventReasonTicketRemoved, "Removed attachment tickets %v of Longhorn volume %s", sortedTicketIDs(tickets), lhva.Name)
+	return nil
+}
+
+// detachTickets returns the tickets to merge into the Longhorn volume attachment to detach the network filesystem,
+// the nil tickets remove its entries
+func detachTickets(networkFS *networkfsv2.NetworkFilesystem, lhva *longhornv2.VolumeAttachment) map[string]*longhornv2.AttachmentTicket {
+	tickets := map[string]*longhornv2.AttachmentTicket{}
+	for _, ticketID := range ownedTicketIDs(networkFS) {
+		if _, found := lhva.Spec.AttachmentTickets[ticketID]; found {
+			tickets[ticketID] = nil
+		}
+	}
+	return tickets
+}
+
+// doAttachLHVolumeAttachment adds the ticket of the network filesystem, the other tickets are left untouched.
+// The ticket moved to another node moves the export, the share-manager is restarted there.
+func (c *Controller) doAttachLHVolumeAttachment(networkFS *networkfsv2.NetworkFilesystem, lhva *longhornv2.VolumeAttachment, placement *networkfsv2.NetworkFSPlacementStatus) error {
+	ticket := attachmentTicket(networkFS, placementNode(placement))
+	existing, found := lhva.Spec.AttachmentTickets[ticket.ID]
+	tickets := attachTickets(networkFS, lhva, ticket)
+	if len(tickets) == 0 {
+		return nil
+	}
+
+	logrus.Infof("Add attachment ticket %s to Longhorn volume attachment %s", ticket.ID, lhva.Name)
+	if err := c.patchAttachmentTickets(lhva.Name, tickets); err != nil {
+		return err
+	}
+	if tickets[ticket.ID] != nil {
+		c.recorder.Eventf(networkFS, corev1.EventTypeNormal, EventReasonTicketWritten, "Wrote attachment ticket %s to Longhorn volume %s", ticket.ID, lhva.Name)
+	}
+	if found && existing != nil && existing.NodeID != ticket.NodeID {
+		c.recorder.Eventf(networkFS, corev1.EventTypeNormal, EventReasonExportMoving, "Moving the export from %s to %s, the clients need to remount",
+			describeNode(existing.NodeID), describeNode(ticket.NodeID))
+	}
+	return nil
+}
+
+// attachTickets returns the tickets to merge into the Longhorn volume attachment to attach the network filesystem with
+// the ticket, nothing if it is attached with it already. The ticket written by the previous versions is dropped.
+func attachTickets(networkFS *networkfsv2.NetworkFilesystem, lhva *longhornv2.VolumeAttachment, ticket *longhornv2.AttachmentTicket) map[string]*longhornv2.AttachmentTicket {
+	tickets := map[string]*longhornv2.AttachmentTicket{}
+	if existing, found := lhva.Spec.AttachmentTickets[ticket.ID]; !found || !reflect.DeepEqual(existing, ticket) {
+		tickets[ticket.ID] = ticket
+	}
+	if _, found := lhva.Spec.AttachmentTickets[legacyTicketID(networkFS)]; found {
+		tickets[legacyTicketID(networkFS)] = nil
+	}
+	return tickets
+}
+
+// patchAttachmentTickets merges the tickets into the Longhorn volume attachment, a nil ticket removes the entry.
+// The patch is guarded by the resourceVersion and retried on conflict.
+func (c *Controller) patchAttachmentTickets(volumeName string, tickets map[string]*longhornv2.AttachmentTicket) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		lhva, err := c.VolumeAttachments.Get(utils.LHNameSpace, volumeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		patch, err := attachmentTicketsPatch(lhva.ResourceVersion, tickets)
+		if err != nil {
+			return err
+		}
+		_, err = c.VolumeAttachments.Patch(utils.LHNameSpace, volumeName, types.MergePatchType, patch)
+		return err
+	})
+	if err != nil {
+		logrus.Errorf("Failed to patch Longhorn volume attachment %s: %v", volumeName, err)
+	}
+	return err
+}
+
+// attachmentTicketsPatch returns the merge patch of the tickets guarded by the resourceVersion, the nil tickets are
+// null and remove their entries
+func attachmentTicketsPatch(resourceVersion string, tickets map[string]*longhornv2.AttachmentTicket) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": resourceVersion,
+		},
+		"spec": map[string]interface{}{
+			"attachmentTickets": tickets,
+		},
+	})
+}
+
+// attachmentTicket returns the ticket the network filesystem writes to the Longhorn volume attachment, an empty node
+// lets Longhorn pick one
+func attachmentTicket(networkFS *networkfsv2.NetworkFilesystem, nodeName string) *longhornv2.AttachmentTicket {
+	return &longhornv2.AttachmentTicket{
+		ID:     ticketID(networkFS),
+		Type:   ticketType,
+		NodeID: nodeName,
+		Parameters: map[string]string{
+			longhornv2.AttachmentParameterDisableFrontend: "false",
+			networkfsv2.AttachmentParameterNetworkFS:      fmt.Sprintf("%s/%s", networkFS.Namespace, networkFS.Name),
+		},
+	}
+}
+
+func describeNode(nodeName string) string {
+	if nodeName == "" {
+		return "the node picked by Longhorn"
+	}
+	return "node " + nodeName
+}
+
+func ticketID(networkFS *networkfsv2.NetworkFilesystem) string {
+	return ticketIDPrefix + networkFS.Name
+}
+
+// legacyTicketID is the CSI ticket written by the previous versions, the share-manager ticket
+// they wrote shares its ID with the one of the Longhorn share-manager controller and is left to it
+func legacyTicketID(networkFS *networkfsv2.NetworkFilesystem) string {
+	return fmt.Sprintf("csi-%s", networkFS.Name)
+}
+
+// ownedTicketIDs returns the IDs of the attachment tickets written by the network filesystem
+func ownedTicketIDs(networkFS *networkfsv2.NetworkFilesystem) []string {
+	return []string{ticketID(networkFS), legacyTicketID(networkFS)}
+}
+
+// isForeignTicket returns true if the attachment ticket keeps the volume attached for another attacher, including
+// another network filesystem of the volume. The ticket of the Longhorn share-manager controller only follows the
+// others, so it is not foreign.
+func isForeignTicket(networkFS *networkfsv2.NetworkFilesystem, id string, ticket *longhornv2.AttachmentTicket) bool {
+	if ticket == nil || ticket.Type == longhornv2.AttacherTypeShareManagerController {
+		return false
+	}
+	for _, ownedID := range ownedTicketIDs(networkFS) {
+		if id == ownedID {
+			return false
+		}
+	}
+	return true
+}
+
+// foreignTicketIDs returns the IDs of the foreign attachment tickets, see isForeignTicket
+func foreignTicketIDs(networkFS *networkfsv2.NetworkFilesystem, lhva *longhornv2.VolumeAttachment) []string {
+	var ticketIDs []string
+	for id, ticket := range lhva.Spec.AttachmentTickets {
+		if isForeignTicket(networkFS, id, ticket) {
+			ticketIDs = append(ticketIDs, id)
+		}
+	}
+	sort.Strings(ticketIDs)
+	return ticketIDs
+}
+
+func sortedTicketIDs(tickets map[string]*longhornv2.AttachmentTicket) []string {
+	ticketIDs := make([]string, 0, len(tickets))
+	for id := range tickets {
+		ticketIDs = append(ticketIDs, id)
+	}
+	sort.Strings(ticketIDs)
+	return ticketIDs
+}
@@ -0,0 +1,189 @@
+package networkfilesystem
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+
+	longhornv2 "github.com/longhorn/longhorn-manager/k8s/pkg/apis/longhorn/v1beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+)
+
+// mergePatch applies the JSON merge patch (RFC 7386) to the document, as the API server does
+func mergePatch(doc, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	docObj, ok := doc.(map[string]interface{})
+	if !ok {
+		docObj = map[string]interface{}{}
+	}
+	for key, value := range patchObj {
+		if value == nil {
+			delete(docObj, key)
+			continue
+		}
+		docObj[key] = mergePatch(docObj[key], value)
+	}
+	return docObj
+}
+
+// applyTickets merges the tickets into the volume attachment through the patch sent to the API server
+func applyTickets(t *testing.T, lhva *longhornv2.VolumeAttachment, tickets map[string]*longhornv2.AttachmentTicket) *longhornv2.VolumeAttachment {
+	t.Helper()
+	patch, err := attachmentTicketsPatch(lhva.ResourceVersion, tickets)
+	if err != nil {
+		t.Fatalf("failed to build the patch: %v", err)
+	}
+	var doc, patchDoc interface{}
+	raw, _ := json.Marshal(lhva)
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(patch, &patchDoc); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ = json.Marshal(mergePatch(doc, patchDoc))
+	patched := &longhornv2.VolumeAttachment{}
+	if err := json.Unmarshal(raw, patched); err != nil {
+		t.Fatal(err)
+	}
+	return patched
+}
+
+func ticketIDsOf(lhva *longhornv2.VolumeAttachment) []string {
+	ids := make([]string, 0, len(lhva.Spec.AttachmentTickets))
+	for id := range lhva.Spec.AttachmentTickets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func volumeAttachment(tickets ...*longhornv2.AttachmentTicket) *longhornv2.VolumeAttachment {
+	lhva := &longhornv2.VolumeAttachment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "longhorn-system", Name: "pvc-1", ResourceVersion: "42"},
+		Spec:       longhornv2.VolumeAttachmentSpec{AttachmentTickets: map[string]*longhornv2.AttachmentTicket{}},
+	}
+	for _, ticket := range tickets {
+		lhva.Spec.AttachmentTickets[ticket.ID] = ticket
+	}
+	return lhva
+}
+
+func TestAttachmentTickets(t *testing.T) {
+	networkFS := &networkfsv2.NetworkFilesystem{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pvc-1"}}
+	other := &networkfsv2.NetworkFilesystem{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pvc-1-copy"}}
+	csi := &longhornv2.AttachmentTicket{ID: "csi-b75d93d2", Type: longhornv2.AttacherTypeCSIAttacher, NodeID: "node-3"}
+	backup := &longhornv2.AttachmentTicket{ID: "backup-1", Type: longhornv2.AttacherTypeBackupController, NodeID: "node-3"}
+	shareManager := &longhornv2.AttachmentTicket{ID: "share-manager-controller-pvc-1", Type: longhornv2.AttacherTypeShareManagerController, NodeID: "node-3"}
+	legacy := &longhornv2.AttachmentTicket{ID: legacyTicketID(networkFS), Type: longhornv2.AttacherTypeCSIAttacher, NodeID: "node-1"}
+	otherTicket := attachmentTicket(other, "node-3")
+
+	tests := []struct {
+		name string
+		lhva *longhornv2.VolumeAttachment
+		// node is the node to attach the network filesystem on, nil detaches it
+		node        *string
+		wantTickets []string
+		wantNode    string
+	}{
+		{
+			name:        "attach next to the foreign tickets",
+			lhva:        volumeAttachment(csi, backup, shareManager, otherTicket),
+			node:        onNode("node-1"),
+			wantTickets: []string{"backup-1", "csi-b75d93d2", ticketID(networkFS), ticketID(other), "share-manager-controller-pvc-1"},
+			wantNode:    "node-1",
+		},
+		{
+			name:        "attach drops the legacy ticket",
+			lhva:        volumeAttachment(legacy, csi),
+			node:        onNode(""),
+			wantTickets: []string{"csi-b75d93d2", ticketID(networkFS)},
+		},
+		{
+			name:        "attach moves the ticket",
+			lhva:        volumeAttachment(attachmentTicket(networkFS, "node-1"), shareManager),
+			node:        onNode("node-2"),
+			wantTickets: []string{ticketID(networkFS), "share-manager-controller-pvc-1"},
+			wantNode:    "node-2",
+		},
+		{
+			name:        "detach leaves the foreign tickets",
+			lhva:        volumeAttachment(attachmentTicket(networkFS, "node-1"), csi, backup, shareManager, otherTicket),
+			wantTickets: []string{"backup-1", "csi-b75d93d2", ticketID(other), "share-manager-controller-pvc-1"},
+		},
+		{
+			name:        "detach drops the legacy ticket",
+			lhva:        volumeAttachment(attachmentTicket(networkFS, "node-1"), legacy, csi),
+			wantTickets: []string{"csi-b75d93d2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patched *longhornv2.VolumeAttachment
+			if tt.node != nil {
+				ticket := attachmentTicket(networkFS, *tt.node)
+				patched = applyTickets(t, tt.lhva, attachTickets(networkFS, tt.lhva, ticket))
+				// the attachment is idempotent
+				if again := attachTickets(networkFS, patched, ticket); len(again) != 0 {
+					t.Errorf("attaching again patches %v", sortedTicketIDs(again))
+				}
+				if got := patched.Spec.AttachmentTickets[ticketID(networkFS)]; !reflect.DeepEqual(got, ticket) || got.NodeID != tt.wantNode {
+					t.Errorf("ticket = %+v, want %+v", got, ticket)
+				}
+			} else {
+				patched = applyTickets(t, tt.lhva, detachTickets(networkFS, tt.lhva))
+				if again := detachTickets(networkFS, patched); len(again) != 0 {
+					t.Errorf("detaching again patches %v", sortedTicketIDs(again))
+				}
+			}
+			if got := ticketIDsOf(patched); !reflect.DeepEqual(got, tt.wantTickets) {
+				t.Errorf("tickets = %v, want %v", got, tt.wantTickets)
+			}
+			// the tickets of the others are untouched
+			for id, ticket := range tt.lhva.Spec.AttachmentTickets {
+				if isForeignTicket(networkFS, id, ticket) && !reflect.DeepEqual(patched.Spec.AttachmentTickets[id], ticket) {
+					t.Errorf("foreign ticket %s = %+v, want %+v", id, patched.Spec.AttachmentTickets[id], ticket)
+				}
+			}
+		})
+	}
+}
+
+func TestForeignTicketIDs(t *testing.T) {
+	networkFS := &networkfsv2.NetworkFilesystem{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pvc-1"}}
+	other := &networkfsv2.NetworkFilesystem{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pvc-1-copy"}}
+	lhva := volumeAttachment(
+		attachmentTicket(networkFS, "node-1"),
+		&longhornv2.AttachmentTicket{ID: legacyTicketID(networkFS), Type: longhornv2.AttacherTypeCSIAttacher},
+		&longhornv2.AttachmentTicket{ID: "share-manager-controller-pvc-1", Type: longhornv2.AttacherTypeShareManagerController},
+		&longhornv2.AttachmentTicket{ID: "csi-b75d93d2", Type: longhornv2.AttacherTypeCSIAttacher, NodeID: "node-3"},
+		&longhornv2.AttachmentTicket{ID: "backup-1", Type: longhornv2.AttacherTypeBackupController, NodeID: "node-3"},
+		attachmentTicket(other, "node-2"),
+	)
+
+	want := []string{"backup-1", "csi-b75d93d2", ticketID(other)}
+	if got := foreignTicketIDs(networkFS, lhva); !reflect.DeepEqual(got, want) {
+		t.Errorf("foreign tickets = %v, want %v", got, want)
+	}
+
+	// the consumers are the foreign CSI tickets, so the release and the disable agree on them
+	var got []string
+	for _, consumer := range consumers(networkFS, &observedState{volumeAttachment: lhva}) {
+		got = append(got, consumer.Name)
+	}
+	wantConsumers := []string{"csi-b75d93d2", ticketID(other)}
+	if !reflect.DeepEqual(got, wantConsumers) {
+		t.Errorf("consumers = %v, want %v", got, wantConsumers)
+	}
+}
+
+func onNode(name string) *string {
+	return &name
+}
@@ -0,0 +1,124 @@
+package networkfilesystem
+
+import (
+	"fmt"
+
+	"github.com/rancher/wrangler/v3/pkg/relatedresource"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+const (
+	// NetworkFSByVolumeIndex indexes the network filesystems by the name of the Longhorn volume they export
+	NetworkFSByVolumeIndex = "networkfs.harvesterhci.io/networkfs-by-volume"
+	networkFSByClaimIndex  = "networkfs.harvesterhci.io/networkfs-by-claim"
+	pvByVolumeHandleIndex  = "networkfs.harvesterhci.io/pv-by-volume-handle"
+)
+
+// indexNetworkFSByVolume indexes the network filesystem by the Longhorn volume of the reference,
+// or by the one resolved in the status if it refers to a PVC
+func indexNetworkFSByVolume(networkFS *networkfsv2.NetworkFilesystem) ([]string, error) {
+	if name := staticVolumeName(networkFS); name != "" {
+		return []string{name}, nil
+	}
+	if networkFS.Status.Volume != "" {
+		return []string{networkFS.Status.Volume}, nil
+	}
+	return nil, nil
+}
+
+// indexNetworkFSByClaim indexes the network filesystem by the namespace/name of the PVC it refers to
+func indexNetworkFSByClaim(networkFS *networkfsv2.NetworkFilesystem) ([]string, error) {
+	if ref := claimRef(networkFS); ref != nil {
+		return []string{claimKey(ref.Namespace, ref.Name)}, nil
+	}
+	return nil, nil
+}
+
+// indexPVByVolumeHandle indexes the Longhorn persistent volume by the name of its Longhorn volume
+func indexPVByVolumeHandle(pv *corev1.PersistentVolume) ([]string, error) {
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != utils.LHCSIDriverName {
+		return nil, nil
+	}
+	return []string{pv.Spec.CSI.VolumeHandle}, nil
+}
+
+// resolvePersistentVolumeClaim maps the PVC to the network filesystems referring to it
+func (c *Controller) resolvePersistentVolumeClaim(namespace, name string, _ runtime.Object) ([]relatedresource.Key, error) {
+	networkFSs, err := c.NetworkFSCache.GetByIndex(networkFSByClaimIndex, claimKey(namespace, name))
+	if err != nil {
+		return nil, err
+	}
+	return networkFSKeys(networkFSs), nil
+}
+
+// staticVolumeName returns the Longhorn volume named by the network filesystem, empty if it refers to a PVC
+func staticVolumeName(networkFS *networkfsv2.NetworkFilesystem) string {
+	return networkFS.Spec.VolumeRef.VolumeName
+}
+
+func claimRef(networkFS *networkfsv2.NetworkFilesystem) *networkfsv2.NetworkFSClaimRef {
+	return networkFS.Spec.VolumeRef.PersistentVolumeClaim
+}
+
+// resolveVolume returns the persistent volume (nil if there is none) and the name of the Longhorn volume
+// the network filesystem refers to. It returns an error with the reason if the reference cannot be resolved.
+func (c *Controller) resolveVolume(networkFS *networkfsv2.NetworkFilesystem) (*corev1.PersistentVolume, string, error) {
+	if volumeName := staticVolumeName(networkFS); volumeName != "" {
+		pvs, err := c.PersistentVolumeCache.GetByIndex(pvByVolumeHandleIndex, volumeName)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(pvs) == 0 {
+			return nil, volumeName, nil
+		}
+		return pvs[0], volumeName, nil
+	}
+
+	ref := claimRef(networkFS)
+	if ref == nil {
+		return nil, "", &unresolvedError{reason: "spec.volumeRef is empty"}
+	}
+	pvc, err := c.PersistentVolumeClaimCache.Get(ref.Namespace, ref.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, "", &unresolvedError{reason: fmt.Sprintf("PVC %s/%s is not found", ref.Namespace, ref.Name)}
+		}
+		return nil, "", err
+	}
+	if pvc.Spec.VolumeName == "" {
+		return nil, "", &unresolvedError{reason: fmt.Sprintf("PVC %s/%s is not bound", ref.Namespace, ref.Name)}
+	}
+	pv, err := c.PersistentVolumeCache.Get(pvc.Spec.VolumeName)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, "", &unresolvedError{reason: fmt.Sprintf("persistent volume %s of PVC %s/%s is not found", pvc.Spec.VolumeName, ref.Namespace, ref.Name)}
+		}
+		return nil, "", err
+	}
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != utils.LHCSIDriverName {
+		return nil, "", &unresolvedError{reason: fmt.Sprintf("persistent volume %s of PVC %s/%s is not a Longhorn volume", pv.Name, ref.Namespace, ref.Name)}
+	}
+	return pv, pv.Spec.CSI.VolumeHandle, nil
+}
+
+// releaseVolumeName returns the Longhorn volume to release on deletion, the resolved one wins over the reference
+func releaseVolumeName(networkFS *networkfsv2.NetworkFilesystem) string {
+	if networkFS.Status.Volume != "" {
+		return networkFS.Status.Volume
+	}
+	return staticVolumeName(networkFS)
+}
+
+// unresolvedError is returned when the volume reference cannot be resolved (yet), the PVC change enqueues the network filesystem again
+type unresolvedError struct {
+	reason string
+}
+
+func (e *unresolvedError) Error() string {
+	return e.reason
+}
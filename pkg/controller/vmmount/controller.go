@@ -0,0 +1,240 @@
+package vmmount
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/rancher/lasso/pkg/controller"
+	ctlv1 "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/v3/pkg/generic"
+	"github.com/rancher/wrangler/v3/pkg/relatedresource"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	ctlntefsv2 "github.com/harvester/networkfs-manager/pkg/generated/controllers/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/metrics"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+const (
+	vmMountHandlerName        = "harvester-network-filesystem-vm-mount"
+	vmMountRelatedHandlerName = "harvester-network-filesystem-vm-mount-related"
+
+	vmByNetworkFSIndex = "networkfs.harvesterhci.io/vm-by-networkfs"
+
+	// VirtualMachineCRDName is the CRD of the KubeVirt VirtualMachine, the controller is only registered if it exists
+	VirtualMachineCRDName = "virtualmachines.kubevirt.io"
+
+	eventReasonMountsRendered = "MountsRendered"
+	eventReasonMountsInvalid  = "MountsInvalid"
+)
+
+// vmGVK is the KubeVirt VirtualMachine, it is handled as unstructured so the manager does not depend on KubeVirt
+var vmGVK = schema.GroupVersionKind{Group: "kubevirt.io", Version: "v1", Kind: "VirtualMachine"}
+
+type vmController = generic.ControllerInterface[*unstructured.Unstructured, *unstructured.UnstructuredList]
+
+// Controller renders the cloud-init mounts of the network filesystems listed in the annotation of the KubeVirt
+// VirtualMachine into its cloud-init Secret, and keeps them up to date with the exports
+type Controller struct {
+	VMs            vmController
+	VMCache        generic.CacheInterface[*unstructured.Unstructured]
+	Secrets        ctlv1.SecretClient
+	NetworkFSCache ctlntefsv2.NetworkFilesystemCache
+
+	recorder record.EventRecorder
+}
+
+// Register registers the VM mount controller on the shared controller factory
+func Register(ctx context.Context, factory controller.SharedControllerFactory, coreClient ctlv1.Interface, netfilesystems ctlntefsv2.NetworkFilesystemController, recorder record.EventRecorder) error {
+	vms := generic.NewController[*unstructured.Unstructured, *unstructured.UnstructuredList](vmGVK, "virtualmachines", true, factory)
+	c := &Controller{
+		VMs:            vms,
+		VMCache:        vms.Cache(),
+		Secrets:        coreClient.Secret(),
+		NetworkFSCache: netfilesystems.Cache(),
+		recorder:       recorder,
+	}
+
+	c.VMCache.AddIndexer(vmByNetworkFSIndex, indexVMByNetworkFS)
+
+	vms.OnChange(ctx, vmMountHandlerName, metrics.Instrument(vmMountHandlerName, c.OnVMChange))
+	relatedresource.Watch(ctx, vmMountRelatedHandlerName, c.resolveNetworkFS, vms, netfilesystems)
+	return nil
+}
+
+// indexVMByNetworkFS indexes the VM by the network filesystems it mounts, in the namespace/name format
+func indexVMByNetworkFS(vm *unstructured.Unstructured) ([]string, error) {
+	mounts, err := parseMounts(vm.GetAnnotations()[networkfsv2.AnnotationVMMounts], vm.GetNamespace())
+	if err != nil {
+		return nil, nil
+	}
+	keys := make([]string, 0, len(mounts))
+	for _, mount := range mounts {
+		keys = append(keys, fmt.Sprintf("%s/%s", mount.namespace, mount.networkFS))
+	}
+	return keys, nil
+}
+
+// resolveNetworkFS maps the NetworkFilesystem to the VMs mounting it
+func (c *Controller) resolveNetworkFS(namespace, name string, _ runtime.Object) ([]relatedresource.Key, error) {
+	vms, err := c.VMCache.GetByIndex(vmByNetworkFSIndex, fmt.Sprintf("%s/%s", namespace, name))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]relatedresource.Key, 0, len(vms))
+	for _, vm := range vms {
+		keys = append(keys, relatedresource.NewKey(vm.GetNamespace(), vm.GetName()))
+	}
+	return keys, nil
+}
+
+// OnVMChange renders the mounts of the VM into its cloud-init Secret, the Secret is recorded in the annotation of
+// the VM so the mounts can be removed from it once the annotation is removed or the VM uses another Secret
+func (c *Controller) OnVMChange(_ string, vm *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if vm == nil || vm.GetDeletionTimestamp() != nil {
+		return vm, nil
+	}
+	annotations := vm.GetAnnotations()
+	value, requested := annotations[networkfsv2.AnnotationVMMounts]
+	applied := annotations[networkfsv2.AnnotationVMMountsSecret]
+	if !requested && applied == "" {
+		return vm, nil
+	}
+	logrus.Debugf("Handling VM %s/%s mounts %q", vm.GetNamespace(), vm.GetName(), value)
+
+	mounts, err := parseMounts(value, vm.GetNamespace())
+	if err != nil {
+		// nothing to retry until the annotation is fixed
+		c.recorder.Eventf(vm, corev1.EventTypeWarning, eventReasonMountsInvalid, "Invalid annotation %s: %v", networkfsv2.AnnotationVMMounts, err)
+		return vm, nil
+	}
+
+	secretName := ""
+	if requested {
+		secretName = cloudInitSecretName(vm)
+		if secretName == "" {
+			c.recorder.Eventf(vm, corev1.EventTypeWarning, eventReasonMountsInvalid, "VM has no cloud-init Secret to render the mounts into")
+		}
+	}
+	if applied != "" && applied != secretName {
+		if err := c.renderSecret(vm.GetNamespace(), applied, nil); err != nil {
+			return nil, err
+		}
+	}
+	if secretName != "" {
+		entries := c.mountEntries(mounts)
+		if err := c.renderSecret(vm.GetNamespace(), secretName, entries); err != nil {
+			return nil, err
+		}
+	}
+
+	if applied == secretName {
+		return vm, nil
+	}
+	vmCpy := vm.DeepCopy()
+	annotations = vmCpy.GetAnnotations()
+	if secretName == "" {
+		delete(annotations, networkfsv2.AnnotationVMMountsSecret)
+	} else {
+		annotations[networkfsv2.AnnotationVMMountsSecret] = secretName
+	}
+	vmCpy.SetAnnotations(annotations)
+	return c.VMs.Update(vmCpy)
+}
+
+// mountEntries returns the mounts of the exported network filesystems, the others are left out until they are exported
+func (c *Controller) mountEntries(mounts []vmMount) []mountEntry {
+	var entries []mountEntry
+	for _, mount := range mounts {
+		networkFS, err := c.NetworkFSCache.Get(mount.namespace, mount.networkFS)
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				logrus.Errorf("Failed to get network filesystem %s/%s: %v", mount.namespace, mount.networkFS, err)
+			}
+			continue
+		}
+		export := networkFS.Status.Export
+		if networkFS.Status.State != networkfsv2.NetworkFSStateEnabled || export == nil || export.MountSource == "" {
+			continue
+		}
+		entries = append(entries, mountEntry{
+			source:     export.MountSource,
+			mountPoint: mount.mountPoint,
+			options:    utils.ExportMountOptions(export),
+		})
+	}
+	return entries
+}
+
+// renderSecret renders the mounts into the user data of the cloud-init Secret, the previously rendered ones are replaced
+func (c *Controller) renderSecret(namespace, name string, entries []mountEntry) error {
+	secret, err := c.Secrets.Get(namespace, name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// the Secret change does not enqueue the VM, the VM is expected to be updated along with its Secret
+			logrus.Infof("Cloud-init secret %s/%s is not found, skip rendering the mounts", namespace, name)
+			return nil
+		}
+		return err
+	}
+
+	key := userDataKey(secret)
+	userData, err := renderUserData(string(secret.Data[key]), entries)
+	if err != nil {
+		return fmt.Errorf("failed to render the mounts into cloud-init secret %s/%s: %w", namespace, name, err)
+	}
+	if userData == string(secret.Data[key]) {
+		return nil
+	}
+
+	secretCpy := secret.DeepCopy()
+	if secretCpy.Data == nil {
+		secretCpy.Data = map[string][]byte{}
+	}
+	secretCpy.Data[key] = []byte(userData)
+	if _, err := c.Secrets.Update(secretCpy); err != nil {
+		return err
+	}
+	mountPoints := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		mountPoints = append(mountPoints, entry.mountPoint)
+	}
+	sort.Strings(mountPoints)
+	logrus.Infof("Rendered mounts %v into cloud-init secret %s/%s", mountPoints, namespace, name)
+	c.recorder.Eventf(secret, corev1.EventTypeNormal, eventReasonMountsRendered, "Rendered mounts %v", mountPoints)
+	return nil
+}
+
+// cloudInitSecretName returns the user data Secret of the NoCloud or ConfigDrive cloud-init volume of the VM
+func cloudInitSecretName(vm *unstructured.Unstructured) string {
+	volumes, _, _ := unstructured.NestedSlice(vm.Object, "spec", "template", "spec", "volumes")
+	for _, volume := range volumes {
+		volumeMap, ok := volume.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, source := range []string{"cloudInitNoCloud", "cloudInitConfigDrive"} {
+			if name, found, _ := unstructured.NestedString(volumeMap, source, "secretRef", "name"); found && name != "" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// userDataKey returns the key of the user data in the cloud-init Secret, KubeVirt accepts both
+func userDataKey(secret *corev1.Secret) string {
+	if _, found := secret.Data["userData"]; found {
+		return "userData"
+	}
+	return "userdata"
+}
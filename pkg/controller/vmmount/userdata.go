@@ -0,0 +1,186 @@
+package vmmount
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	cloudConfigHeader = "#cloud-config"
+	// managedComment marks the items rendered by the manager, the other items of the user data are left untouched
+	managedComment = "# managed by networkfs-manager"
+)
+
+// vmMount is an item of the mounts annotation of the VM, [<namespace>/]<name>:<mount point>
+type vmMount struct {
+	namespace  string
+	networkFS  string
+	mountPoint string
+}
+
+// mountEntry is the cloud-init mount of the export
+type mountEntry struct {
+	source     string
+	mountPoint string
+	options    string
+}
+
+// parseMounts parses the mounts annotation, [<namespace>/]<name>:<mount point>[,...], the network filesystems without
+// a namespace are in the namespace of the VM
+func parseMounts(value, namespace string) ([]vmMount, error) {
+	var mounts []vmMount
+	mountPoints := map[string]bool{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		ref, mountPoint, found := strings.Cut(item, ":")
+		if !found {
+			return nil, fmt.Errorf("mount %q is not in the [<namespace>/]<name>:<mount point> format", item)
+		}
+		mountNamespace := namespace
+		name := ref
+		if before, after, found := strings.Cut(ref, "/"); found {
+			if errs := validation.IsDNS1123Label(before); len(errs) > 0 {
+				return nil, fmt.Errorf("network filesystem namespace %q is invalid: %s", before, strings.Join(errs, ", "))
+			}
+			mountNamespace, name = before, after
+		}
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			return nil, fmt.Errorf("network filesystem name %q is invalid: %s", name, strings.Join(errs, ", "))
+		}
+		if !path.IsAbs(mountPoint) || path.Clean(mountPoint) != mountPoint || mountPoint == "/" {
+			return nil, fmt.Errorf("mount point %q must be a clean absolute path other than /", mountPoint)
+		}
+		if strings.ContainsAny(mountPoint, " \t\"'") {
+			return nil, fmt.Errorf("mount point %q must not contain whitespaces or quotes", mountPoint)
+		}
+		if mountPoints[mountPoint] {
+			return nil, fmt.Errorf("mount point %q is used more than once", mountPoint)
+		}
+		mountPoints[mountPoint] = true
+		mounts = append(mounts, vmMount{namespace: mountNamespace, networkFS: name, mountPoint: mountPoint})
+	}
+	return mounts, nil
+}
+
+// renderUserData replaces the managed items of the bootcmd of the cloud-config with the entries. The bootcmd runs on
+// every boot with the current user data, so the VM mounts the export where it is served at boot time, while the
+// mounts and runcmd only run at the first boot of the instance. The items rendered into them by the previous versions
+// are removed, the fstab entry written at the first boot is not.
+func renderUserData(userData string, entries []mountEntry) (string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(userData), &doc); err != nil {
+		return "", err
+	}
+	if doc.Kind == 0 {
+		if len(entries) == 0 {
+			return userData, nil
+		}
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return "", fmt.Errorf("user data is not a cloud-config mapping")
+	}
+	root := doc.Content[0]
+
+	var commands []*yaml.Node
+	for _, entry := range entries {
+		commands = append(commands, managedSequence("sh", "-c", mountCommand(entry)))
+	}
+	for _, key := range []string{"mounts", "runcmd"} {
+		if err := replaceManaged(root, key, nil); err != nil {
+			return "", err
+		}
+	}
+	if err := replaceManaged(root, "bootcmd", commands); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	rendered := buf.String()
+	if !strings.HasPrefix(rendered, cloudConfigHeader+"\n") {
+		// cloud-init only takes the user data with the header as the cloud-config
+		rendered = cloudConfigHeader + "\n" + rendered
+	}
+	return rendered, nil
+}
+
+// mountCommand returns the shell command mounting the export at the mount point, unless it is mounted already. It runs
+// in the background so the boot does not wait for the unreachable export.
+func mountCommand(entry mountEntry) string {
+	mount := "mount -t nfs"
+	if entry.options != "" {
+		mount += " -o " + shellQuote(entry.options)
+	}
+	mountPoint := shellQuote(entry.mountPoint)
+	mount += fmt.Sprintf(" %s %s", shellQuote(entry.source), mountPoint)
+	return fmt.Sprintf("(mkdir -p %[1]s && (mountpoint -q %[1]s || %[2]s)) >/dev/null 2>&1 &", mountPoint, mount)
+}
+
+// shellQuote quotes the value as a single word of the shell
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// replaceManaged replaces the managed items of the sequence of the key with the items, the key is removed once the
+// sequence is left empty
+func replaceManaged(root *yaml.Node, key string, items []*yaml.Node) error {
+	index := -1
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == key {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		if len(items) == 0 {
+			return nil
+		}
+		root.Content = append(root.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+			&yaml.Node{Kind: yaml.SequenceNode, Content: items})
+		return nil
+	}
+
+	seq := root.Content[index+1]
+	if seq.Kind == yaml.ScalarNode && seq.Tag == "!!null" {
+		seq.Kind, seq.Tag, seq.Value = yaml.SequenceNode, "", ""
+	}
+	if seq.Kind != yaml.SequenceNode {
+		return fmt.Errorf("%s of the cloud-config is not a sequence", key)
+	}
+	var kept []*yaml.Node
+	for _, item := range seq.Content {
+		if item.LineComment != managedComment {
+			kept = append(kept, item)
+		}
+	}
+	seq.Content = append(kept, items...)
+	if len(seq.Content) == 0 {
+		root.Content = append(root.Content[:index], root.Content[index+2:]...)
+	}
+	return nil
+}
+
+func managedSequence(values ...string) *yaml.Node {
+	seq := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle, LineComment: managedComment}
+	for _, value := range values {
+		seq.Content = append(seq.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Style: yaml.DoubleQuotedStyle})
+	}
+	return seq
+}
@@ -0,0 +1,169 @@
+package vmmount
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMounts(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []vmMount
+		wantErr string
+	}{
+		{name: "empty"},
+		{
+			name:  "namespace of the VM",
+			value: "data:/mnt/data",
+			want:  []vmMount{{namespace: "vm-ns", networkFS: "data", mountPoint: "/mnt/data"}},
+		},
+		{
+			name:  "namespaced and spaced",
+			value: " harvester-system/pvc-1:/mnt/pvc-1 , data:/srv/data,",
+			want: []vmMount{
+				{namespace: "harvester-system", networkFS: "pvc-1", mountPoint: "/mnt/pvc-1"},
+				{namespace: "vm-ns", networkFS: "data", mountPoint: "/srv/data"},
+			},
+		},
+		{
+			name:  "same network filesystem twice",
+			value: "data:/mnt/a,data:/mnt/b",
+			want: []vmMount{
+				{namespace: "vm-ns", networkFS: "data", mountPoint: "/mnt/a"},
+				{namespace: "vm-ns", networkFS: "data", mountPoint: "/mnt/b"},
+			},
+		},
+		{name: "no mount point", value: "data", wantErr: "is not in the [<namespace>/]<name>:<mount point> format"},
+		{name: "invalid namespace", value: "Harvester/data:/mnt/data", wantErr: `namespace "Harvester" is invalid`},
+		{name: "invalid name", value: "ns/a/b:/mnt/data", wantErr: `name "a/b" is invalid`},
+		{name: "empty name", value: ":/mnt/data", wantErr: `name "" is invalid`},
+		{name: "relative mount point", value: "data:mnt/data", wantErr: `mount point "mnt/data" must be a clean absolute path`},
+		{name: "unclean mount point", value: "data:/mnt/../data", wantErr: `mount point "/mnt/../data" must be a clean absolute path`},
+		{name: "trailing slash", value: "data:/mnt/data/", wantErr: "must be a clean absolute path"},
+		{name: "root", value: "data:/", wantErr: "other than /"},
+		{name: "quote", value: "data:/mnt/it's", wantErr: "must not contain whitespaces or quotes"},
+		{name: "tab", value: "data:/mnt/a\tb", wantErr: "must not contain whitespaces or quotes"},
+		{name: "duplicated mount point", value: "data:/mnt/data,ns/other:/mnt/data", wantErr: `mount point "/mnt/data" is used more than once`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMounts(tt.value, "vm-ns")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mounts = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderUserData(t *testing.T) {
+	entries := []mountEntry{
+		{source: "10.53.0.20:/pvc-1", mountPoint: "/mnt/pvc-1", options: "vers=4.1,noresvport"},
+		{source: "pvc-2.networkfs.internal:/pvc-2", mountPoint: "/mnt/pvc-2"},
+	}
+	userData := `#cloud-config
+password: harvester
+bootcmd:
+  - echo booting
+packages:
+  - nfs-common
+`
+	want := `#cloud-config
+password: harvester
+bootcmd:
+  - echo booting
+  - ["sh", "-c", "(mkdir -p '/mnt/pvc-1' && (mountpoint -q '/mnt/pvc-1' || mount -t nfs -o 'vers=4.1,noresvport' '10.53.0.20:/pvc-1' '/mnt/pvc-1')) >/dev/null 2>&1 &"] # managed by networkfs-manager
+  - ["sh", "-c", "(mkdir -p '/mnt/pvc-2' && (mountpoint -q '/mnt/pvc-2' || mount -t nfs 'pvc-2.networkfs.internal:/pvc-2' '/mnt/pvc-2')) >/dev/null 2>&1 &"] # managed by networkfs-manager
+packages:
+  - nfs-common
+`
+	rendered, err := renderUserData(userData, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered != want {
+		t.Fatalf("rendered =\n%s\nwant\n%s", rendered, want)
+	}
+
+	// rendering the rendered user data again is a no-op, so the VM is not updated on every reconcile
+	again, err := renderUserData(rendered, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != rendered {
+		t.Errorf("rendering again =\n%s\nwant\n%s", again, rendered)
+	}
+
+	// the moved export replaces the managed items only
+	moved, err := renderUserData(rendered, entries[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(moved, "/mnt/pvc-1") || !strings.Contains(moved, "/mnt/pvc-2") || !strings.Contains(moved, "- echo booting") {
+		t.Errorf("moved =\n%s", moved)
+	}
+
+	// the emptied annotation removes the managed items, the items of the user are kept
+	removed, err := renderUserData(rendered, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != userData {
+		t.Errorf("removed =\n%s\nwant\n%s", removed, userData)
+	}
+}
+
+func TestRenderUserDataKeys(t *testing.T) {
+	entry := mountEntry{source: "10.53.0.20:/pvc-1", mountPoint: "/mnt/pvc-1"}
+	command := `  - ["sh", "-c", "(mkdir -p '/mnt/pvc-1' && (mountpoint -q '/mnt/pvc-1' || mount -t nfs '10.53.0.20:/pvc-1' '/mnt/pvc-1')) >/dev/null 2>&1 &"] # managed by networkfs-manager` + "\n"
+
+	tests := []struct {
+		name     string
+		userData string
+		entries  []mountEntry
+		want     string
+		wantErr  string
+	}{
+		{name: "empty user data without mounts", entries: nil, want: ""},
+		{name: "empty user data", entries: []mountEntry{entry}, want: "#cloud-config\nbootcmd:\n" + command},
+		{name: "no header", userData: "hostname: vm-1\n", entries: []mountEntry{entry}, want: "#cloud-config\nhostname: vm-1\nbootcmd:\n" + command},
+		{name: "null bootcmd", userData: "#cloud-config\nbootcmd:\n", entries: []mountEntry{entry}, want: "#cloud-config\nbootcmd:\n" + command},
+		{
+			name:     "items of the previous versions",
+			userData: "#cloud-config\nmounts:\n  - [\"10.53.0.10:/pvc-1\", \"/mnt/pvc-1\", \"nfs\"] # managed by networkfs-manager\nruncmd:\n  - [\"mount\", \"-a\"] # managed by networkfs-manager\n  - echo done\n",
+			entries:  []mountEntry{entry},
+			want:     "#cloud-config\nruncmd:\n  - echo done\nbootcmd:\n" + command,
+		},
+		{name: "bootcmd is not a sequence", userData: "#cloud-config\nbootcmd: echo booting\n", entries: []mountEntry{entry}, wantErr: "bootcmd of the cloud-config is not a sequence"},
+		{name: "not a mapping", userData: "- echo booting\n", entries: []mountEntry{entry}, wantErr: "user data is not a cloud-config mapping"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderUserData(tt.userData, tt.entries)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("rendered =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"net/http"
 
 	harvesterhciv1beta1 "github.com/harvester/networkfs-manager/pkg/generated/clientset/versioned/typed/harvesterhci.io/v1beta1"
+	harvesterhciv1beta2 "github.com/harvester/networkfs-manager/pkg/generated/clientset/versioned/typed/harvesterhci.io/v1beta2"
 	longhornv1beta2 "github.com/harvester/networkfs-manager/pkg/generated/clientset/versioned/typed/longhorn.io/v1beta2"
 	discovery "k8s.io/client-go/discovery"
 	rest "k8s.io/client-go/rest"
@@ -32,6 +33,7 @@ import (
 type Interface interface {
 	Discovery() discovery.DiscoveryInterface
 	HarvesterhciV1beta1() harvesterhciv1beta1.HarvesterhciV1beta1Interface
+	HarvesterhciV1beta2() harvesterhciv1beta2.HarvesterhciV1beta2Interface
 	LonghornV1beta2() longhornv1beta2.LonghornV1beta2Interface
 }
 
@@ -39,6 +41,7 @@ type Interface interface {
 type Clientset struct {
 	*discovery.DiscoveryClient
 	harvesterhciV1beta1 *harvesterhciv1beta1.HarvesterhciV1beta1Client
+	harvesterhciV1beta2 *harvesterhciv1beta2.HarvesterhciV1beta2Client
 	longhornV1beta2     *longhornv1beta2.LonghornV1beta2Client
 }
 
@@ -47,6 +50,11 @@ func (c *Clientset) HarvesterhciV1beta1() harvesterhciv1beta1.HarvesterhciV1beta
 	return c.harvesterhciV1beta1
 }
 
+// HarvesterhciV1beta2 retrieves the HarvesterhciV1beta2Client
+func (c *Clientset) HarvesterhciV1beta2() harvesterhciv1beta2.HarvesterhciV1beta2Interface {
+	return c.harvesterhciV1beta2
+}
+
 // LonghornV1beta2 retrieves the LonghornV1beta2Client
 func (c *Clientset) LonghornV1beta2() longhornv1beta2.LonghornV1beta2Interface {
 	return c.longhornV1beta2
@@ -100,6 +108,10 @@ func NewForConfigAndClient(c *rest.Config, httpClient *http.Client) (*Clientset,
 	if err != nil {
 		return nil, err
 	}
+	cs.harvesterhciV1beta2, err = harvesterhciv1beta2.NewForConfigAndClient(&configShallowCopy, httpClient)
+	if err != nil {
+		return nil, err
+	}
 	cs.longhornV1beta2, err = longhornv1beta2.NewForConfigAndClient(&configShallowCopy, httpClient)
 	if err != nil {
 		return nil, err
@@ -126,6 +138,7 @@ func NewForConfigOrDie(c *rest.Config) *Clientset {
 func New(c rest.Interface) *Clientset {
 	var cs Clientset
 	cs.harvesterhciV1beta1 = harvesterhciv1beta1.New(c)
+	cs.harvesterhciV1beta2 = harvesterhciv1beta2.New(c)
 	cs.longhornV1beta2 = longhornv1beta2.New(c)
 
 	cs.DiscoveryClient = discovery.NewDiscoveryClient(c)
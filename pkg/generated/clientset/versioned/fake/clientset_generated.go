@@ -22,6 +22,8 @@ import (
 	clientset "github.com/harvester/networkfs-manager/pkg/generated/clientset/versioned"
 	harvesterhciv1beta1 "github.com/harvester/networkfs-manager/pkg/generated/clientset/versioned/typed/harvesterhci.io/v1beta1"
 	fakeharvesterhciv1beta1 "github.com/harvester/networkfs-manager/pkg/generated/clientset/versioned/typed/harvesterhci.io/v1beta1/fake"
+	harvesterhciv1beta2 "github.com/harvester/networkfs-manager/pkg/generated/clientset/versioned/typed/harvesterhci.io/v1beta2"
+	fakeharvesterhciv1beta2 "github.com/harvester/networkfs-manager/pkg/generated/clientset/versioned/typed/harvesterhci.io/v1beta2/fake"
 	longhornv1beta2 "github.com/harvester/networkfs-manager/pkg/generated/clientset/versioned/typed/longhorn.io/v1beta2"
 	fakelonghornv1beta2 "github.com/harvester/networkfs-manager/pkg/generated/clientset/versioned/typed/longhorn.io/v1beta2/fake"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -86,6 +88,11 @@ func (c *Clientset) HarvesterhciV1beta1() harvesterhciv1beta1.HarvesterhciV1beta
 	return &fakeharvesterhciv1beta1.FakeHarvesterhciV1beta1{Fake: &c.Fake}
 }
 
+// HarvesterhciV1beta2 retrieves the HarvesterhciV1beta2Client
+func (c *Clientset) HarvesterhciV1beta2() harvesterhciv1beta2.HarvesterhciV1beta2Interface {
+	return &fakeharvesterhciv1beta2.FakeHarvesterhciV1beta2{Fake: &c.Fake}
+}
+
 // LonghornV1beta2 retrieves the LonghornV1beta2Client
 func (c *Clientset) LonghornV1beta2() longhornv1beta2.LonghornV1beta2Interface {
 	return &fakelonghornv1beta2.FakeLonghornV1beta2{Fake: &c.Fake}
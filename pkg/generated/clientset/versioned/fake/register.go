@@ -20,6 +20,7 @@ package fake
 
 import (
 	harvesterhciv1beta1 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta1"
+	harvesterhciv1beta2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
 	longhornv1beta2 "github.com/longhorn/longhorn-manager/k8s/pkg/apis/longhorn/v1beta2"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
@@ -33,6 +34,7 @@ var codecs = serializer.NewCodecFactory(scheme)
 
 var localSchemeBuilder = runtime.SchemeBuilder{
 	harvesterhciv1beta1.AddToScheme,
+	harvesterhciv1beta2.AddToScheme,
 	longhornv1beta2.AddToScheme,
 }
 
@@ -0,0 +1,195 @@
+/*
+Copyright 2024 Rancher Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by main. DO NOT EDIT.
+
+package v1beta2
+
+import (
+	"context"
+	"time"
+
+	v1beta2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	scheme "github.com/harvester/networkfs-manager/pkg/generated/clientset/versioned/scheme"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// NetworkFilesystemsGetter has a method to return a NetworkFilesystemInterface.
+// A group's client should implement this interface.
+type NetworkFilesystemsGetter interface {
+	NetworkFilesystems(namespace string) NetworkFilesystemInterface
+}
+
+// NetworkFilesystemInterface has methods to work with NetworkFilesystem resources.
+type NetworkFilesystemInterface interface {
+	Create(ctx context.Context, networkFilesystem *v1beta2.NetworkFilesystem, opts v1.CreateOptions) (*v1beta2.NetworkFilesystem, error)
+	Update(ctx context.Context, networkFilesystem *v1beta2.NetworkFilesystem, opts v1.UpdateOptions) (*v1beta2.NetworkFilesystem, error)
+	UpdateStatus(ctx context.Context, networkFilesystem *v1beta2.NetworkFilesystem, opts v1.UpdateOptions) (*v1beta2.NetworkFilesystem, error)
+	Delete(ctx context.Context, name string, opts v1.DeleteOptions) error
+	DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error
+	Get(ctx context.Context, name string, opts v1.GetOptions) (*v1beta2.NetworkFilesystem, error)
+	List(ctx context.Context, opts v1.ListOptions) (*v1beta2.NetworkFilesystemList, error)
+	Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1beta2.NetworkFilesystem, err error)
+	NetworkFilesystemExpansion
+}
+
+// networkFilesystems implements NetworkFilesystemInterface
+type networkFilesystems struct {
+	client rest.Interface
+	ns     string
+}
+
+// newNetworkFilesystems returns a NetworkFilesystems
+func newNetworkFilesystems(c *HarvesterhciV1beta2Client, namespace string) *networkFilesystems {
+	return &networkFilesystems{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the networkFilesystem, and returns the corresponding networkFilesystem object, and an error if there is any.
+func (c *networkFilesystems) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1beta2.NetworkFilesystem, err error) {
+	result = &v1beta2.NetworkFilesystem{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("networkfilesystems").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of NetworkFilesystems that match those selectors.
+func (c *networkFilesystems) List(ctx context.Context, opts v1.ListOptions) (result *v1beta2.NetworkFilesystemList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1beta2.NetworkFilesystemList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("networkfilesystems").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested networkFilesystems.
+func (c *networkFilesystems) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("networkfilesystems").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch(ctx)
+}
+
+// Create takes the representation of a networkFilesystem and creates it.  Returns the server's representation of the networkFilesystem, and an error, if there is any.
+func (c *networkFilesystems) Create(ctx context.Context, networkFilesystem *v1beta2.NetworkFilesystem, opts v1.CreateOptions) (result *v1beta2.NetworkFilesystem, err error) {
+	result = &v1beta2.NetworkFilesystem{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("networkfilesystems").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(networkFilesystem).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Update takes the representation of a networkFilesystem and updates it. Returns the server's representation of the networkFilesystem, and an error, if there is any.
+func (c *networkFilesystems) Update(ctx context.Context, networkFilesystem *v1beta2.NetworkFilesystem, opts v1.UpdateOptions) (result *v1beta2.NetworkFilesystem, err error) {
+	result = &v1beta2.NetworkFilesystem{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("networkfilesystems").
+		Name(networkFilesystem.Name).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(networkFilesystem).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *networkFilesystems) UpdateStatus(ctx context.Context, networkFilesystem *v1beta2.NetworkFilesystem, opts v1.UpdateOptions) (result *v1beta2.NetworkFilesystem, err error) {
+	result = &v1beta2.NetworkFilesystem{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("networkfilesystems").
+		Name(networkFilesystem.Name).
+		SubResource("status").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(networkFilesystem).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Delete takes name of the networkFilesystem and deletes it. Returns an error if one occurs.
+func (c *networkFilesystems) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("networkfilesystems").
+		Name(name).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *networkFilesystems) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	var timeout time.Duration
+	if listOpts.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOpts.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("networkfilesystems").
+		VersionedParams(&listOpts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// Patch applies the patch and returns the patched networkFilesystem.
+func (c *networkFilesystems) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1beta2.NetworkFilesystem, err error) {
+	result = &v1beta2.NetworkFilesystem{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("networkfilesystems").
+		Name(name).
+		SubResource(subresources...).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(data).
+		Do(ctx).
+		Into(result)
+	return
+}
@@ -20,11 +20,13 @@ package harvesterhci
 
 import (
 	v1beta1 "github.com/harvester/networkfs-manager/pkg/generated/controllers/harvesterhci.io/v1beta1"
+	v1beta2 "github.com/harvester/networkfs-manager/pkg/generated/controllers/harvesterhci.io/v1beta2"
 	"github.com/rancher/lasso/pkg/controller"
 )
 
 type Interface interface {
 	V1beta1() v1beta1.Interface
+	V1beta2() v1beta2.Interface
 }
 
 type group struct {
@@ -41,3 +43,7 @@ func New(controllerFactory controller.SharedControllerFactory) Interface {
 func (g *group) V1beta1() v1beta1.Interface {
 	return v1beta1.New(g.controllerFactory)
 }
+
+func (g *group) V1beta2() v1beta2.Interface {
+	return v1beta2.New(g.controllerFactory)
+}
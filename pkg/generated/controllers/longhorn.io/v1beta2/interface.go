@@ -31,7 +31,10 @@ func init() {
 }
 
 type Interface interface {
+	Node() NodeController
 	ShareManager() ShareManagerController
+	Volume() VolumeController
+	VolumeAttachment() VolumeAttachmentController
 }
 
 func New(controllerFactory controller.SharedControllerFactory) Interface {
@@ -44,6 +47,18 @@ type version struct {
 	controllerFactory controller.SharedControllerFactory
 }
 
+func (v *version) Node() NodeController {
+	return generic.NewController[*v1beta2.Node, *v1beta2.NodeList](schema.GroupVersionKind{Group: "longhorn.io", Version: "v1beta2", Kind: "Node"}, "nodes", true, v.controllerFactory)
+}
+
 func (v *version) ShareManager() ShareManagerController {
 	return generic.NewController[*v1beta2.ShareManager, *v1beta2.ShareManagerList](schema.GroupVersionKind{Group: "longhorn.io", Version: "v1beta2", Kind: "ShareManager"}, "sharemanagers", true, v.controllerFactory)
 }
+
+func (v *version) Volume() VolumeController {
+	return generic.NewController[*v1beta2.Volume, *v1beta2.VolumeList](schema.GroupVersionKind{Group: "longhorn.io", Version: "v1beta2", Kind: "Volume"}, "volumes", true, v.controllerFactory)
+}
+
+func (v *version) VolumeAttachment() VolumeAttachmentController {
+	return generic.NewController[*v1beta2.VolumeAttachment, *v1beta2.VolumeAttachmentList](schema.GroupVersionKind{Group: "longhorn.io", Version: "v1beta2", Kind: "VolumeAttachment"}, "volumeattachments", true, v.controllerFactory)
+}
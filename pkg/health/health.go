@@ -0,0 +1,117 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	healthzPath      = "/healthz"
+	readyzPath       = "/readyz"
+	readyzLeaderPath = "/readyz/leader"
+)
+
+// Checker tracks the leader status and the cache sync of the manager for the probes
+type Checker struct {
+	leader atomic.Bool
+	synced atomic.Bool
+}
+
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// SetLeader marks the replica as the leader, the controllers are being started
+func (c *Checker) SetLeader() {
+	c.leader.Store(true)
+}
+
+// SetSynced marks the caches of the leader as synced, the controllers are running
+func (c *Checker) SetSynced() {
+	c.synced.Store(true)
+}
+
+// ready returns whether the replica is ready and its role: a standby replica is ready,
+// the leader is only ready once its caches are synced
+func (c *Checker) ready() (bool, string) {
+	if !c.leader.Load() {
+		return true, "standby"
+	}
+	if !c.synced.Load() {
+		return false, "leader, caches are not synced"
+	}
+	return true, "leader"
+}
+
+func (c *Checker) healthz(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprintln(w, "ok")
+}
+
+func (c *Checker) readyz(w http.ResponseWriter, _ *http.Request) {
+	ready, role := c.ready()
+	writeReady(w, ready, role)
+}
+
+// readyzLeader only succeeds on the synced leader, it tells the replicas apart
+func (c *Checker) readyzLeader(w http.ResponseWriter, _ *http.Request) {
+	ready, role := c.ready()
+	writeReady(w, ready && c.leader.Load(), role)
+}
+
+func writeReady(w http.ResponseWriter, ready bool, role string) {
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	_, _ = fmt.Fprintln(w, role)
+}
+
+// Run serves the probes on the port until the context is done
+func (c *Checker) Run(ctx context.Context, port int) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(healthzPath, c.healthz)
+	mux.HandleFunc(readyzPath, c.readyz)
+	mux.HandleFunc(readyzLeaderPath, c.readyzLeader)
+	logrus.Infof("Health server is listening on :%d", port)
+	return serve(ctx, fmt.Sprintf(":%d", port), mux)
+}
+
+// RunPprof serves the pprof handlers on the loopback address until the context is done
+func RunPprof(ctx context.Context, port int) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	logrus.Infof("Pprof server is listening on 127.0.0.1:%d", port)
+	return serve(ctx, fmt.Sprintf("127.0.0.1:%d", port), mux)
+}
+
+func serve(ctx context.Context, addr string, handler http.Handler) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/labels"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	ctlntefsv2 "github.com/harvester/networkfs-manager/pkg/generated/controllers/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+const (
+	namespace   = "networkfs"
+	metricsPath = "/metrics"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	enableDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "enable_duration_seconds",
+		Help:      "Time from desiredState=Enabled to the export being Enabled",
+		Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800},
+	})
+
+	endpointChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "endpoint_changes_total",
+		Help:      "Total count of endpoint address changes per export",
+	}, []string{"namespace", "name"})
+
+	reconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_errors_total",
+		Help:      "Total count of reconcile errors per controller",
+	}, []string{"controller"})
+
+	probeLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "probe_duration_seconds",
+		Help:      "Latency of the completed stages of the NFS data path probe",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 8),
+	}, []string{"stage"})
+
+	probeFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "probe_failures_total",
+		Help:      "Total count of failed NFS data path probes per export and stage",
+	}, []string{"namespace", "name", "stage"})
+
+	exportReachable = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "export_reachable",
+		Help:      "Whether the last NFS data path probe of the export succeeded",
+	}, []string{"namespace", "name"})
+
+	networkFSDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "networkfilesystems"),
+		"Number of NetworkFilesystems by state, readiness and protocol",
+		[]string{"state", "ready", "protocol"}, nil,
+	)
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		enableDuration,
+		endpointChanges,
+		reconcileErrors,
+		probeLatency,
+		probeFailures,
+		exportReachable,
+		workqueueDepth,
+	)
+}
+
+// ObserveEnableDuration records the time the export took to be Enabled
+func ObserveEnableDuration(d time.Duration) {
+	enableDuration.Observe(d.Seconds())
+}
+
+// IncEndpointChanges counts the endpoint address change of the export
+func IncEndpointChanges(namespace, name string) {
+	endpointChanges.WithLabelValues(namespace, name).Inc()
+}
+
+// DeleteEndpointChanges drops the counter of the deleted export
+func DeleteEndpointChanges(namespace, name string) {
+	endpointChanges.DeleteLabelValues(namespace, name)
+}
+
+// ObserveProbeLatency records the latency of the completed probe stage
+func ObserveProbeLatency(stage string, d time.Duration) {
+	probeLatency.WithLabelValues(stage).Observe(d.Seconds())
+}
+
+// IncProbeFailures counts the failed probe of the export at the stage
+func IncProbeFailures(namespace, name, stage string) {
+	probeFailures.WithLabelValues(namespace, name, stage).Inc()
+}
+
+// SetExportReachable records the result of the last probe of the export
+func SetExportReachable(namespace, name string, reachable bool) {
+	value := 0.0
+	if reachable {
+		value = 1
+	}
+	exportReachable.WithLabelValues(namespace, name).Set(value)
+}
+
+// DeleteExportProbe drops the probe series of the export which is not probed anymore
+func DeleteExportProbe(namespace, name string) {
+	exportReachable.DeleteLabelValues(namespace, name)
+	probeFailures.DeletePartialMatch(prometheus.Labels{"namespace": namespace, "name": name})
+}
+
+// Instrument counts the errors returned by the handler of the controller
+func Instrument[T any](controller string, handler func(string, T) (T, error)) func(string, T) (T, error) {
+	return func(key string, obj T) (T, error) {
+		result, err := handler(key, obj)
+		if err != nil {
+			reconcileErrors.WithLabelValues(controller).Inc()
+		}
+		return result, err
+	}
+}
+
+// RegisterNetworkFSCollector exposes the gauge of the NetworkFilesystems in the cache, it is only
+// registered by the leader, so the other replicas do not report the empty cache.
+func RegisterNetworkFSCollector(cache ctlntefsv2.NetworkFilesystemCache) error {
+	return registry.Register(&networkFSCollector{cache: cache})
+}
+
+type networkFSCollector struct {
+	cache ctlntefsv2.NetworkFilesystemCache
+}
+
+func (c *networkFSCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- networkFSDesc
+}
+
+func (c *networkFSCollector) Collect(ch chan<- prometheus.Metric) {
+	networkFSs, err := c.cache.List("", labels.Everything())
+	if err != nil {
+		logrus.Errorf("Failed to list network filesystems for metrics: %v", err)
+		return
+	}
+	type key struct {
+		state, ready, protocol string
+	}
+	counts := map[key]int{}
+	for _, networkFS := range networkFSs {
+		ready := strconv.FormatBool(utils.IsNetworkFSConditionTrue(networkFS.Status.NetworkFSConds, networkfsv2.ConditionTypeReady))
+		counts[key{string(networkFS.Status.State), ready, string(networkFS.Spec.Protocol)}]++
+	}
+	for k, count := range counts {
+		ch <- prometheus.MustNewConstMetric(networkFSDesc, prometheus.GaugeValue, float64(count), k.state, k.ready, k.protocol)
+	}
+}
+
+// Run serves the metrics until the context is done
+func Run(ctx context.Context, port int) error {
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	logrus.Infof("Metrics server is listening on %s", server.Addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
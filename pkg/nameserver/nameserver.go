@@ -0,0 +1,180 @@
+package nameserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+)
+
+const (
+	// DefaultZone is the zone the network filesystems are named in, <name>.<namespace>.<zone>
+	DefaultZone = "netfs.local"
+	// DefaultTTL is short, so the clients pick up the endpoint change soon after it happens
+	DefaultTTL = 5 * time.Second
+)
+
+// Lookup gets the network filesystem by namespace and name, e.g. the NetworkFilesystem cache
+type Lookup interface {
+	Get(namespace, name string) (*networkfsv2.NetworkFilesystem, error)
+}
+
+// Server is the authoritative DNS server of the zone of the network filesystems. It answers the A/AAAA queries of
+// <name>.<namespace>.<zone> with the addresses of the export, the network filesystem without an export does not exist.
+type Server struct {
+	zone   string
+	ttl    uint32
+	lookup Lookup
+}
+
+// NewServer returns the DNS server of the zone, it implements dns.Handler so it can be served on any listener
+func NewServer(zone string, ttl time.Duration, lookup Lookup) *Server {
+	return &Server{
+		zone:   dns.CanonicalName(zone),
+		ttl:    uint32(ttl.Seconds()),
+		lookup: lookup,
+	}
+}
+
+// Run serves the zone over UDP and TCP on the port until the context is done
+func (s *Server) Run(ctx context.Context, port int) error {
+	addr := fmt.Sprintf(":%d", port)
+	servers := []*dns.Server{
+		{Addr: addr, Net: "udp", Handler: s},
+		{Addr: addr, Net: "tcp", Handler: s},
+	}
+	errCh := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *dns.Server) {
+			errCh <- server.ListenAndServe()
+		}(server)
+	}
+
+	logrus.Infof("DNS server of zone %s is listening on %s", s.zone, addr)
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errCh:
+	}
+	for _, server := range servers {
+		_ = server.Shutdown()
+	}
+	return err
+}
+
+// ServeDNS answers the query of the zone, the queries out of the zone are refused
+func (s *Server) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	resp := s.answer(req)
+	if err := w.WriteMsg(resp); err != nil {
+		logrus.Debugf("Failed to write the DNS response to %s: %v", w.RemoteAddr(), err)
+	}
+}
+
+func (s *Server) answer(req *dns.Msg) *dns.Msg {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	if req.Opcode != dns.OpcodeQuery || len(req.Question) != 1 {
+		resp.SetRcode(req, dns.RcodeNotImplemented)
+		return resp
+	}
+
+	question := req.Question[0]
+	qname := dns.CanonicalName(question.Name)
+	if !dns.IsSubDomain(s.zone, qname) {
+		resp.SetRcode(req, dns.RcodeRefused)
+		return resp
+	}
+	resp.Authoritative = true
+
+	if qname == s.zone {
+		if question.Qtype == dns.TypeSOA || question.Qtype == dns.TypeANY {
+			resp.Answer = append(resp.Answer, s.soa())
+		} else {
+			resp.Ns = append(resp.Ns, s.soa())
+		}
+		return resp
+	}
+
+	addresses, err := s.addresses(qname)
+	if err != nil {
+		if !errors.Is(err, errNoSuchName) {
+			logrus.Errorf("Failed to resolve %s: %v", qname, err)
+			resp.SetRcode(req, dns.RcodeServerFailure)
+			return resp
+		}
+		resp.SetRcode(req, dns.RcodeNameError)
+		resp.Ns = append(resp.Ns, s.soa())
+		return resp
+	}
+
+	for _, address := range addresses {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			continue
+		}
+		header := dns.RR_Header{Name: question.Name, Class: dns.ClassINET, Ttl: s.ttl}
+		if ip4 := ip.To4(); ip4 != nil {
+			if question.Qtype == dns.TypeA || question.Qtype == dns.TypeANY {
+				header.Rrtype = dns.TypeA
+				resp.Answer = append(resp.Answer, &dns.A{Hdr: header, A: ip4})
+			}
+			continue
+		}
+		if question.Qtype == dns.TypeAAAA || question.Qtype == dns.TypeANY {
+			header.Rrtype = dns.TypeAAAA
+			resp.Answer = append(resp.Answer, &dns.AAAA{Hdr: header, AAAA: ip})
+		}
+	}
+	if len(resp.Answer) == 0 {
+		// the name exists without the requested record, e.g. the AAAA record of the IPv4 export
+		resp.Ns = append(resp.Ns, s.soa())
+	}
+	return resp
+}
+
+var errNoSuchName = errors.New("no such name")
+
+// addresses returns the addresses of the export of the network filesystem named by <name>.<namespace>.<zone>,
+// the name of the network filesystem may contain dots while the namespace may not
+func (s *Server) addresses(qname string) ([]string, error) {
+	labels := dns.SplitDomainName(strings.TrimSuffix(qname, "."+s.zone))
+	if len(labels) < 2 {
+		return nil, errNoSuchName
+	}
+	namespace := labels[len(labels)-1]
+	name := strings.Join(labels[:len(labels)-1], ".")
+	networkFS, err := s.lookup.Get(namespace, name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, errNoSuchName
+		}
+		return nil, err
+	}
+	// the disabled export has no address, its name is gone until it is enabled again
+	if networkFS.Status.Export == nil || len(networkFS.Status.Export.Addresses) == 0 {
+		return nil, errNoSuchName
+	}
+	return networkFS.Status.Export.Addresses, nil
+}
+
+// soa is the start of authority of the zone, its minimum TTL bounds the negative caching of the resolvers
+func (s *Server) soa() dns.RR {
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: s.zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: s.ttl},
+		Ns:      "ns." + s.zone,
+		Mbox:    "hostmaster." + s.zone,
+		Serial:  1,
+		Refresh: s.ttl,
+		Retry:   s.ttl,
+		Expire:  s.ttl,
+		Minttl:  s.ttl,
+	}
+}
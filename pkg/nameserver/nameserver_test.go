@@ -0,0 +1,250 @@
+package nameserver
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+)
+
+type fakeLookup map[string]*networkfsv2.NetworkFilesystem
+
+func (l fakeLookup) Get(namespace, name string) (*networkfsv2.NetworkFilesystem, error) {
+	networkFS, ok := l[namespace+"/"+name]
+	if !ok {
+		return nil, apierrors.NewNotFound(networkfsv2.Resource("networkfilesystem"), name)
+	}
+	return networkFS, nil
+}
+
+func networkFS(namespace, name string, addresses ...string) *networkfsv2.NetworkFilesystem {
+	networkFS := &networkfsv2.NetworkFilesystem{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	if len(addresses) > 0 {
+		networkFS.Status.State = networkfsv2.NetworkFSStateEnabled
+		networkFS.Status.Export = &networkfsv2.NetworkFSExport{Addresses: addresses}
+	} else {
+		networkFS.Status.State = networkfsv2.NetworkFSStateDisabled
+	}
+	return networkFS
+}
+
+// startServer serves the zone on a local UDP port and returns its address
+func startServer(t *testing.T, lookup Lookup) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{
+		PacketConn:        conn,
+		Handler:           NewServer(DefaultZone, DefaultTTL, lookup),
+		NotifyStartedFunc: func() { close(started) },
+	}
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("DNS server did not start")
+	}
+	return conn.LocalAddr().String()
+}
+
+func TestServeDNS(t *testing.T) {
+	lookup := fakeLookup{
+		"default/pvc-1":          networkFS("default", "pvc-1", "10.52.0.10"),
+		"default/pvc.with.dots":  networkFS("default", "pvc.with.dots", "10.52.0.11"),
+		"default/pvc-dual":       networkFS("default", "pvc-dual", "10.52.0.12", "fd00::12"),
+		"default/pvc-disabled":   networkFS("default", "pvc-disabled"),
+		"harvester-system/pvc-1": networkFS("harvester-system", "pvc-1", "10.52.0.13"),
+	}
+	addr := startServer(t, lookup)
+	client := &dns.Client{Net: "udp", Timeout: 5 * time.Second}
+
+	tests := []struct {
+		name        string
+		qname       string
+		qtype       uint16
+		wantRcode   int
+		wantAnswers []string
+		// wantSOA expects the SOA of the zone in the authority section
+		wantSOA bool
+	}{
+		{
+			name:        "enabled export",
+			qname:       "pvc-1.default.netfs.local.",
+			qtype:       dns.TypeA,
+			wantRcode:   dns.RcodeSuccess,
+			wantAnswers: []string{"10.52.0.10"},
+		},
+		{
+			name:        "case-insensitive name",
+			qname:       "PVC-1.Default.NETFS.local.",
+			qtype:       dns.TypeA,
+			wantRcode:   dns.RcodeSuccess,
+			wantAnswers: []string{"10.52.0.10"},
+		},
+		{
+			name:        "same name in another namespace",
+			qname:       "pvc-1.harvester-system.netfs.local.",
+			qtype:       dns.TypeA,
+			wantRcode:   dns.RcodeSuccess,
+			wantAnswers: []string{"10.52.0.13"},
+		},
+		{
+			name:        "name with dots",
+			qname:       "pvc.with.dots.default.netfs.local.",
+			qtype:       dns.TypeA,
+			wantRcode:   dns.RcodeSuccess,
+			wantAnswers: []string{"10.52.0.11"},
+		},
+		{
+			name:        "AAAA of the dual-stack export",
+			qname:       "pvc-dual.default.netfs.local.",
+			qtype:       dns.TypeAAAA,
+			wantRcode:   dns.RcodeSuccess,
+			wantAnswers: []string{"fd00::12"},
+		},
+		{
+			name:      "AAAA of the IPv4 export",
+			qname:     "pvc-1.default.netfs.local.",
+			qtype:     dns.TypeAAAA,
+			wantRcode: dns.RcodeSuccess,
+			wantSOA:   true,
+		},
+		{
+			name:      "disabled export",
+			qname:     "pvc-disabled.default.netfs.local.",
+			qtype:     dns.TypeA,
+			wantRcode: dns.RcodeNameError,
+			wantSOA:   true,
+		},
+		{
+			name:      "unknown network filesystem",
+			qname:     "pvc-unknown.default.netfs.local.",
+			qtype:     dns.TypeA,
+			wantRcode: dns.RcodeNameError,
+			wantSOA:   true,
+		},
+		{
+			name:      "namespace only",
+			qname:     "default.netfs.local.",
+			qtype:     dns.TypeA,
+			wantRcode: dns.RcodeNameError,
+			wantSOA:   true,
+		},
+		{
+			name:      "A of the zone apex",
+			qname:     "netfs.local.",
+			qtype:     dns.TypeA,
+			wantRcode: dns.RcodeSuccess,
+			wantSOA:   true,
+		},
+		{
+			name:      "out of the zone",
+			qname:     "example.com.",
+			qtype:     dns.TypeA,
+			wantRcode: dns.RcodeRefused,
+		},
+		{
+			name:      "suffix of the zone name",
+			qname:     "pvc-1.default.othernetfs.local.",
+			qtype:     dns.TypeA,
+			wantRcode: dns.RcodeRefused,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := new(dns.Msg)
+			req.SetQuestion(tt.qname, tt.qtype)
+			resp, _, err := client.Exchange(req, addr)
+			if err != nil {
+				t.Fatalf("failed to query %s: %v", tt.qname, err)
+			}
+			if resp.Rcode != tt.wantRcode {
+				t.Errorf("rcode = %s, want %s", dns.RcodeToString[resp.Rcode], dns.RcodeToString[tt.wantRcode])
+			}
+			if tt.wantRcode != dns.RcodeRefused && !resp.Authoritative {
+				t.Errorf("response is not authoritative")
+			}
+
+			var answers []string
+			for _, rr := range resp.Answer {
+				if rr.Header().Ttl != uint32(DefaultTTL.Seconds()) {
+					t.Errorf("TTL of %s = %d, want %d", rr, rr.Header().Ttl, uint32(DefaultTTL.Seconds()))
+				}
+				if rr.Header().Name != tt.qname {
+					t.Errorf("name of %s = %s, want %s", rr, rr.Header().Name, tt.qname)
+				}
+				switch rr := rr.(type) {
+				case *dns.A:
+					answers = append(answers, rr.A.String())
+				case *dns.AAAA:
+					answers = append(answers, rr.AAAA.String())
+				default:
+					t.Errorf("unexpected answer %s", rr)
+				}
+			}
+			if len(answers) != len(tt.wantAnswers) {
+				t.Fatalf("answers = %v, want %v", answers, tt.wantAnswers)
+			}
+			for i := range answers {
+				if answers[i] != tt.wantAnswers[i] {
+					t.Errorf("answers = %v, want %v", answers, tt.wantAnswers)
+				}
+			}
+
+			if !tt.wantSOA {
+				if len(resp.Ns) != 0 {
+					t.Errorf("unexpected authority section %v", resp.Ns)
+				}
+				return
+			}
+			if len(resp.Ns) != 1 {
+				t.Fatalf("authority section = %v, want the SOA of the zone", resp.Ns)
+			}
+			checkSOA(t, resp.Ns[0])
+		})
+	}
+}
+
+func TestServeDNSSOA(t *testing.T) {
+	addr := startServer(t, fakeLookup{})
+	client := &dns.Client{Net: "udp", Timeout: 5 * time.Second}
+
+	req := new(dns.Msg)
+	req.SetQuestion("netfs.local.", dns.TypeSOA)
+	resp, _, err := client.Exchange(req, addr)
+	if err != nil {
+		t.Fatalf("failed to query the SOA: %v", err)
+	}
+	if resp.Rcode != dns.RcodeSuccess || !resp.Authoritative {
+		t.Errorf("rcode = %s, authoritative = %t, want an authoritative %s", dns.RcodeToString[resp.Rcode], resp.Authoritative, dns.RcodeToString[dns.RcodeSuccess])
+	}
+	if len(resp.Answer) != 1 {
+		t.Fatalf("answers = %v, want the SOA of the zone", resp.Answer)
+	}
+	checkSOA(t, resp.Answer[0])
+}
+
+func checkSOA(t *testing.T, rr dns.RR) {
+	t.Helper()
+	soa, ok := rr.(*dns.SOA)
+	if !ok {
+		t.Fatalf("%s is not a SOA", rr)
+	}
+	ttl := uint32(DefaultTTL.Seconds())
+	if soa.Hdr.Name != "netfs.local." || soa.Ns != "ns.netfs.local." || soa.Mbox != "hostmaster.netfs.local." {
+		t.Errorf("SOA = %s, want the SOA of netfs.local.", soa)
+	}
+	if soa.Hdr.Ttl != ttl || soa.Minttl != ttl {
+		t.Errorf("SOA TTL = %d, minimum TTL = %d, want %d", soa.Hdr.Ttl, soa.Minttl, ttl)
+	}
+}
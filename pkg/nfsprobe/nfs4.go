@@ -0,0 +1,215 @@
+package nfsprobe
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+)
+
+// NFSv4.1 (RFC 8881) constants
+const (
+	nfsProgram  = 100003
+	nfsVersion4 = 4
+	nfsMinor1   = 1
+
+	procNull     = 0
+	procCompound = 1
+
+	opLookup          = 15
+	opPutRootFH       = 24
+	opExchangeID      = 42
+	opCreateSession   = 43
+	opDestroySession  = 44
+	opSequence        = 53
+	opDestroyClientID = 57
+
+	exchangeIDFlagUseNonPNFS = 0x00010000
+	stateProtectNone         = 0
+
+	sessionIDSize = 16
+
+	nfs4OK = 0
+)
+
+// the names of the NFSv4 errors the probe likely runs into
+var nfs4Errors = map[uint32]string{
+	2:     "NFS4ERR_NOENT",
+	13:    "NFS4ERR_ACCES",
+	20:    "NFS4ERR_NOTDIR",
+	10008: "NFS4ERR_DELAY",
+	10013: "NFS4ERR_GRACE",
+	10021: "NFS4ERR_MINOR_VERS_MISMATCH",
+	10022: "NFS4ERR_STALE_CLIENTID",
+	10052: "NFS4ERR_BADSESSION",
+	10071: "NFS4ERR_OP_NOT_IN_SESSION",
+}
+
+// NFS4Error is returned when the COMPOUND fails with an NFSv4 status
+type NFS4Error struct {
+	Op     string
+	Status uint32
+}
+
+func (e *NFS4Error) Error() string {
+	name, ok := nfs4Errors[e.Status]
+	if !ok {
+		name = fmt.Sprintf("NFS4ERR(%d)", e.Status)
+	}
+	return fmt.Sprintf("nfs4: %s failed with %s", e.Op, name)
+}
+
+// nfs4Client issues the NFSv4.1 COMPOUND procedures within a session
+type nfs4Client struct {
+	rpc *rpcClient
+
+	clientID   uint64
+	sequenceID uint32
+	sessionID  []byte
+}
+
+func (c *nfs4Client) null() error {
+	_, err := c.rpc.call(nfsProgram, nfsVersion4, procNull, nil)
+	return err
+}
+
+// compound sends the operations and returns the reader of the results, positioned at the first result
+func (c *nfs4Client) compound(name string, ops ...func(w *xdrWriter)) (*xdrReader, error) {
+	w := &xdrWriter{}
+	w.string("") // tag
+	w.uint32(nfsMinor1)
+	w.uint32(uint32(len(ops)))
+	for _, op := range ops {
+		op(w)
+	}
+
+	r, err := c.rpc.call(nfsProgram, nfsVersion4, procCompound, w.bytes())
+	if err != nil {
+		return nil, err
+	}
+	status, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if status != nfs4OK {
+		return nil, &NFS4Error{Op: name, Status: status}
+	}
+	if _, err := r.opaque(); err != nil { // tag
+		return nil, err
+	}
+	if _, err := r.uint32(); err != nil { // number of results
+		return nil, err
+	}
+	return r, nil
+}
+
+// skipResultHeader reads the opcode and the status of the operation result
+func skipResultHeader(r *xdrReader) error {
+	if _, err := r.uint32(); err != nil {
+		return err
+	}
+	_, err := r.uint32()
+	return err
+}
+
+// exchangeID registers the probe as a client of the server
+func (c *nfs4Client) exchangeID(owner string) error {
+	verifier := make([]byte, 8)
+	if _, err := rand.Read(verifier); err != nil {
+		return err
+	}
+	r, err := c.compound("EXCHANGE_ID", func(w *xdrWriter) {
+		w.uint32(opExchangeID)
+		w.fixed(verifier)
+		w.string(owner)
+		w.uint32(exchangeIDFlagUseNonPNFS)
+		w.uint32(stateProtectNone)
+		w.uint32(0) // no implementation id
+	})
+	if err != nil {
+		return err
+	}
+	if err := skipResultHeader(r); err != nil {
+		return err
+	}
+	if c.clientID, err = r.uint64(); err != nil {
+		return err
+	}
+	c.sequenceID, err = r.uint32()
+	return err
+}
+
+// createSession creates the session with a single slot on the fore channel
+func (c *nfs4Client) createSession() error {
+	channelAttrs := func(w *xdrWriter) {
+		w.uint32(0)       // header pad size
+		w.uint32(1 << 16) // max request size
+		w.uint32(1 << 16) // max response size
+		w.uint32(4096)    // max response size cached
+		w.uint32(8)       // max operations
+		w.uint32(1)       // max requests
+		w.uint32(0)       // no rdma ird
+	}
+	r, err := c.compound("CREATE_SESSION", func(w *xdrWriter) {
+		w.uint32(opCreateSession)
+		w.uint64(c.clientID)
+		w.uint32(c.sequenceID)
+		w.uint32(0) // flags
+		channelAttrs(w)
+		channelAttrs(w)
+		w.uint32(0) // callback program
+		w.uint32(1) // one callback security parameter
+		w.uint32(authNone)
+	})
+	if err != nil {
+		return err
+	}
+	if err := skipResultHeader(r); err != nil {
+		return err
+	}
+	c.sessionID, err = r.fixed(sessionIDSize)
+	return err
+}
+
+// lookup walks the export path from the root file handle in the first slot of the session
+func (c *nfs4Client) lookup(exportPath string) error {
+	ops := []func(w *xdrWriter){
+		func(w *xdrWriter) {
+			w.uint32(opSequence)
+			w.fixed(c.sessionID)
+			w.uint32(1) // sequence id of the slot
+			w.uint32(0) // slot id
+			w.uint32(0) // highest slot id
+			w.uint32(0) // do not cache this
+		},
+		func(w *xdrWriter) {
+			w.uint32(opPutRootFH)
+		},
+	}
+	for _, component := range strings.Split(strings.Trim(exportPath, "/"), "/") {
+		if component == "" {
+			continue
+		}
+		ops = append(ops, func(w *xdrWriter) {
+			w.uint32(opLookup)
+			w.string(component)
+		})
+	}
+	_, err := c.compound("PUTROOTFH/LOOKUP", ops...)
+	return err
+}
+
+// destroy releases the session and the client on the server, errors are ignored
+func (c *nfs4Client) destroy() {
+	if c.sessionID != nil {
+		_, _ = c.compound("DESTROY_SESSION", func(w *xdrWriter) {
+			w.uint32(opDestroySession)
+			w.fixed(c.sessionID)
+		})
+	}
+	if c.clientID != 0 {
+		_, _ = c.compound("DESTROY_CLIENTID", func(w *xdrWriter) {
+			w.uint32(opDestroyClientID)
+			w.uint64(c.clientID)
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package nfsprobe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// Stage is a step of the probe, the later stages go deeper into the NFS server
+type Stage string
+
+const (
+	// StageConnect opens the TCP connection to the export port
+	StageConnect Stage = "connect"
+	// StageNull calls the NULL procedure of the NFSv4 program
+	StageNull Stage = "null"
+	// StageLookup looks up the export path from the root file handle in an NFSv4.1 session
+	StageLookup Stage = "lookup"
+)
+
+// Stages are all the stages in order
+var Stages = []Stage{StageConnect, StageNull, StageLookup}
+
+// Result is the outcome of a probe
+type Result struct {
+	// Stage is the last stage attempted, the failed one if Err is not nil
+	Stage Stage
+	// Latency of the completed stages
+	Latency map[Stage]time.Duration
+	Err     error
+}
+
+// Prober probes the data path of the NFS exports
+type Prober struct {
+	// Timeout of the whole probe
+	Timeout time.Duration
+	// DialContext opens the connection, it is replaced to reach a stub server
+	DialContext func(ctx context.Context, network, address string) (net.Conn, error)
+	// Owner identifies the probe as an NFSv4 client
+	Owner string
+}
+
+func NewProber(timeout time.Duration) *Prober {
+	hostname, _ := os.Hostname()
+	dialer := &net.Dialer{}
+	return &Prober{
+		Timeout:     timeout,
+		DialContext: dialer.DialContext,
+		Owner:       fmt.Sprintf("networkfs-manager-probe-%s", hostname),
+	}
+}
+
+// Probe connects to the address (host:port) and walks the stages, it stops at the first failed stage
+func (p *Prober) Probe(ctx context.Context, address, exportPath string) Result {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	result := Result{Latency: map[Stage]time.Duration{}}
+	run := func(stage Stage, fn func() error) bool {
+		result.Stage = stage
+		start := time.Now()
+		if err := fn(); err != nil {
+			result.Err = err
+			return false
+		}
+		result.Latency[stage] = time.Since(start)
+		return true
+	}
+
+	var conn net.Conn
+	if !run(StageConnect, func() (err error) {
+		conn, err = p.DialContext(ctx, "tcp", address)
+		return err
+	}) {
+		return result
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client := &nfs4Client{rpc: newRPCClient(conn, p.Owner, uint32(time.Now().UnixNano()))}
+	if !run(StageNull, client.null) {
+		return result
+	}
+	defer client.destroy()
+	run(StageLookup, func() error {
+		if err := client.exchangeID(p.Owner); err != nil {
+			return err
+		}
+		if err := client.createSession(); err != nil {
+			return err
+		}
+		return client.lookup(exportPath)
+	})
+	return result
+}
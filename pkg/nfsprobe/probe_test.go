@@ -0,0 +1,327 @@
+package nfsprobe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubCall is the call received by the stub server, op is the first operation of the COMPOUND
+type stubCall struct {
+	xid  uint32
+	proc uint32
+	op   uint32
+}
+
+// stubServer is a local ONC RPC server answering the calls with the replies of the handler,
+// a nil reply leaves the call unanswered
+type stubServer struct {
+	listener net.Listener
+	handler  func(call stubCall) []byte
+}
+
+func newStubServer(t *testing.T, handler func(call stubCall) []byte) *stubServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := &stubServer{listener: listener, handler: handler}
+	t.Cleanup(func() { _ = listener.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *stubServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *stubServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	for {
+		record, err := readRecord(conn)
+		if err != nil {
+			return
+		}
+		call, err := parseCall(record)
+		if err != nil {
+			return
+		}
+		if reply := s.handler(call); reply != nil {
+			if err := writeRecord(conn, reply); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func parseCall(record []byte) (stubCall, error) {
+	r := &xdrReader{buf: record}
+	var call stubCall
+	var err error
+	if call.xid, err = r.uint32(); err != nil {
+		return call, err
+	}
+	// message type, RPC version, program, version
+	for i := 0; i < 4; i++ {
+		if _, err := r.uint32(); err != nil {
+			return call, err
+		}
+	}
+	if call.proc, err = r.uint32(); err != nil {
+		return call, err
+	}
+	// credential and verifier
+	for i := 0; i < 2; i++ {
+		if _, err := r.uint32(); err != nil {
+			return call, err
+		}
+		if _, err := r.opaque(); err != nil {
+			return call, err
+		}
+	}
+	if call.proc != procCompound {
+		return call, nil
+	}
+	// tag, minor version, number of operations
+	if _, err := r.opaque(); err != nil {
+		return call, err
+	}
+	if _, err := r.uint32(); err != nil {
+		return call, err
+	}
+	if _, err := r.uint32(); err != nil {
+		return call, err
+	}
+	call.op, err = r.uint32()
+	return call, err
+}
+
+// acceptedReply returns the successful reply of the call followed by the results
+func acceptedReply(xid uint32, results []byte) []byte {
+	w := &xdrWriter{}
+	w.uint32(xid)
+	w.uint32(msgTypeReply)
+	w.uint32(replyAccepted)
+	w.uint32(authNone)
+	w.opaque(nil)
+	w.uint32(acceptSuccess)
+	w.fixed(results)
+	return w.bytes()
+}
+
+// deniedReply returns the reply rejecting the call with an authentication error
+func deniedReply(xid uint32) []byte {
+	w := &xdrWriter{}
+	w.uint32(xid)
+	w.uint32(msgTypeReply)
+	w.uint32(replyDenied)
+	w.uint32(rejectAuthError)
+	w.uint32(1) // AUTH_BADCRED
+	return w.bytes()
+}
+
+// compoundResults returns the COMPOUND results of the operation with the status
+func compoundResults(op, status uint32, result func(w *xdrWriter)) []byte {
+	w := &xdrWriter{}
+	w.uint32(status)
+	w.string("")
+	w.uint32(1)
+	w.uint32(op)
+	w.uint32(status)
+	if result != nil {
+		result(w)
+	}
+	return w.bytes()
+}
+
+// goodReply answers every call the probe makes successfully
+func goodReply(call stubCall) []byte {
+	if call.proc == procNull {
+		return acceptedReply(call.xid, nil)
+	}
+	switch call.op {
+	case opExchangeID:
+		return acceptedReply(call.xid, compoundResults(opExchangeID, nfs4OK, func(w *xdrWriter) {
+			w.uint64(42) // client id
+			w.uint32(1)  // sequence id
+		}))
+	case opCreateSession:
+		return acceptedReply(call.xid, compoundResults(opCreateSession, nfs4OK, func(w *xdrWriter) {
+			w.fixed(make([]byte, sessionIDSize))
+		}))
+	}
+	return acceptedReply(call.xid, compoundResults(call.op, nfs4OK, nil))
+}
+
+// misbehave answers the calls with the reply of the handler, the other calls are answered successfully
+func misbehave(match func(call stubCall) bool, reply func(call stubCall) []byte) func(call stubCall) []byte {
+	return func(call stubCall) []byte {
+		if match(call) {
+			return reply(call)
+		}
+		return goodReply(call)
+	}
+}
+
+func isNull(call stubCall) bool {
+	return call.proc == procNull
+}
+
+func isExchangeID(call stubCall) bool {
+	return call.proc == procCompound && call.op == opExchangeID
+}
+
+func garbled(call stubCall) []byte {
+	w := &xdrWriter{}
+	w.uint32(call.xid)
+	w.uint32(msgTypeReply)
+	return w.bytes()
+}
+
+func wrongXID(call stubCall) []byte {
+	return acceptedReply(call.xid+100, nil)
+}
+
+func denied(call stubCall) []byte {
+	return deniedReply(call.xid)
+}
+
+func noReply(stubCall) []byte {
+	return nil
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func TestProbe(t *testing.T) {
+	tests := []struct {
+		name      string
+		handler   func(call stubCall) []byte
+		wantStage Stage
+		// checkErr asserts the error of the probe, nil expects the probe to succeed
+		checkErr func(err error) bool
+	}{
+		{
+			name:      "good replies",
+			handler:   goodReply,
+			wantStage: StageLookup,
+		},
+		{
+			name:      "garbled NULL reply",
+			handler:   misbehave(isNull, garbled),
+			wantStage: StageNull,
+			checkErr:  func(err error) bool { return errors.Is(err, errShortBuffer) },
+		},
+		{
+			name:      "wrong XID of NULL",
+			handler:   misbehave(isNull, wrongXID),
+			wantStage: StageNull,
+			checkErr:  func(err error) bool { return strings.Contains(err.Error(), "unexpected xid") },
+		},
+		{
+			name:      "denied NULL",
+			handler:   misbehave(isNull, denied),
+			wantStage: StageNull,
+			checkErr:  func(err error) bool { return err.Error() == "rpc: authentication error 1" },
+		},
+		{
+			name:      "NULL timeout",
+			handler:   misbehave(isNull, noReply),
+			wantStage: StageNull,
+			checkErr:  isTimeout,
+		},
+		{
+			name:      "garbled EXCHANGE_ID reply",
+			handler:   misbehave(isExchangeID, garbled),
+			wantStage: StageLookup,
+			checkErr:  func(err error) bool { return errors.Is(err, errShortBuffer) },
+		},
+		{
+			name:      "wrong XID of EXCHANGE_ID",
+			handler:   misbehave(isExchangeID, wrongXID),
+			wantStage: StageLookup,
+			checkErr:  func(err error) bool { return strings.Contains(err.Error(), "unexpected xid") },
+		},
+		{
+			name:      "denied EXCHANGE_ID",
+			handler:   misbehave(isExchangeID, denied),
+			wantStage: StageLookup,
+			checkErr:  func(err error) bool { return err.Error() == "rpc: authentication error 1" },
+		},
+		{
+			name: "EXCHANGE_ID fails with an NFSv4 status",
+			handler: misbehave(isExchangeID, func(call stubCall) []byte {
+				return acceptedReply(call.xid, compoundResults(opExchangeID, 10021, nil))
+			}),
+			wantStage: StageLookup,
+			checkErr: func(err error) bool {
+				var nfsErr *NFS4Error
+				return errors.As(err, &nfsErr) && nfsErr.Op == "EXCHANGE_ID" && nfsErr.Status == 10021
+			},
+		},
+		{
+			name:      "EXCHANGE_ID timeout",
+			handler:   misbehave(isExchangeID, noReply),
+			wantStage: StageLookup,
+			checkErr:  isTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newStubServer(t, tt.handler)
+			prober := NewProber(500 * time.Millisecond)
+
+			result := prober.Probe(context.Background(), server.listener.Addr().String(), "/pvc-test")
+			if result.Stage != tt.wantStage {
+				t.Errorf("stage = %s, want %s", result.Stage, tt.wantStage)
+			}
+			if tt.checkErr == nil {
+				if result.Err != nil {
+					t.Fatalf("unexpected error: %v", result.Err)
+				}
+				for _, stage := range Stages {
+					if _, ok := result.Latency[stage]; !ok {
+						t.Errorf("latency of stage %s is not recorded", stage)
+					}
+				}
+				return
+			}
+			if result.Err == nil {
+				t.Fatalf("expected an error at stage %s", tt.wantStage)
+			}
+			if !tt.checkErr(result.Err) {
+				t.Errorf("unexpected error: %v", result.Err)
+			}
+			if _, ok := result.Latency[tt.wantStage]; ok {
+				t.Errorf("latency of the failed stage %s is recorded", tt.wantStage)
+			}
+		})
+	}
+}
+
+func TestProbeConnectionRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	result := NewProber(500*time.Millisecond).Probe(context.Background(), address, "/pvc-test")
+	if result.Stage != StageConnect || result.Err == nil {
+		t.Errorf("stage = %s, err = %v, want a %s error", result.Stage, result.Err, StageConnect)
+	}
+}
@@ -0,0 +1,198 @@
+package nfsprobe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+)
+
+// ONC RPC (RFC 5531) constants
+const (
+	rpcVersion = 2
+
+	msgTypeCall  = 0
+	msgTypeReply = 1
+
+	replyAccepted = 0
+	replyDenied   = 1
+
+	acceptSuccess      = 0
+	acceptProgUnavail  = 1
+	acceptProgMismatch = 2
+	acceptProcUnavail  = 3
+	acceptGarbageArgs  = 4
+	acceptSystemErr    = 5
+
+	rejectRPCMismatch = 0
+	rejectAuthError   = 1
+
+	authNone = 0
+	authSys  = 1
+
+	// the record marking (RFC 5531 section 11) of the last fragment
+	lastFragment = 0x80000000
+	// the largest reply the probe accepts, the probe replies are tiny
+	maxReplySize = 1 << 20
+)
+
+// RPCError is returned when the server rejects the call or does not accept it
+type RPCError struct {
+	Msg string
+}
+
+func (e *RPCError) Error() string {
+	return "rpc: " + e.Msg
+}
+
+// rpcClient issues the ONC RPC calls over a stream connection, one call at a time
+type rpcClient struct {
+	conn    net.Conn
+	xid     uint32
+	machine string
+}
+
+func newRPCClient(conn net.Conn, machine string, xid uint32) *rpcClient {
+	return &rpcClient{
+		conn:    conn,
+		xid:     xid,
+		machine: machine,
+	}
+}
+
+// call sends the call with the AUTH_SYS root credential, and returns the reader of the procedure results
+func (c *rpcClient) call(prog, vers, proc uint32, args []byte) (*xdrReader, error) {
+	c.xid++
+	xid := c.xid
+
+	w := &xdrWriter{}
+	w.uint32(xid)
+	w.uint32(msgTypeCall)
+	w.uint32(rpcVersion)
+	w.uint32(prog)
+	w.uint32(vers)
+	w.uint32(proc)
+	// credential
+	cred := &xdrWriter{}
+	cred.uint32(0) // stamp
+	cred.string(c.machine)
+	cred.uint32(0) // uid
+	cred.uint32(0) // gid
+	cred.uint32(0) // no auxiliary gids
+	w.uint32(authSys)
+	w.opaque(cred.bytes())
+	// verifier
+	w.uint32(authNone)
+	w.opaque(nil)
+	w.fixed(args)
+
+	if err := writeRecord(c.conn, w.bytes()); err != nil {
+		return nil, err
+	}
+	reply, err := readRecord(c.conn)
+	if err != nil {
+		return nil, err
+	}
+	return parseReply(reply, xid)
+}
+
+func parseReply(reply []byte, xid uint32) (*xdrReader, error) {
+	r := &xdrReader{buf: reply}
+	replyXID, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if replyXID != xid {
+		return nil, &RPCError{Msg: fmt.Sprintf("unexpected xid %d, expected %d", replyXID, xid)}
+	}
+	msgType, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if msgType != msgTypeReply {
+		return nil, &RPCError{Msg: fmt.Sprintf("unexpected message type %d", msgType)}
+	}
+	replyStat, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+
+	switch replyStat {
+	case replyAccepted:
+		// verifier
+		if _, err := r.uint32(); err != nil {
+			return nil, err
+		}
+		if _, err := r.opaque(); err != nil {
+			return nil, err
+		}
+		acceptStat, err := r.uint32()
+		if err != nil {
+			return nil, err
+		}
+		switch acceptStat {
+		case acceptSuccess:
+			return r, nil
+		case acceptProgUnavail:
+			return nil, &RPCError{Msg: "program unavailable"}
+		case acceptProgMismatch:
+			low, _ := r.uint32()
+			high, _ := r.uint32()
+			return nil, &RPCError{Msg: fmt.Sprintf("program version mismatch, supported versions are %d-%d", low, high)}
+		case acceptProcUnavail:
+			return nil, &RPCError{Msg: "procedure unavailable"}
+		case acceptGarbageArgs:
+			return nil, &RPCError{Msg: "garbage arguments"}
+		case acceptSystemErr:
+			return nil, &RPCError{Msg: "system error"}
+		}
+		return nil, &RPCError{Msg: fmt.Sprintf("unknown accept status %d", acceptStat)}
+	case replyDenied:
+		rejectStat, err := r.uint32()
+		if err != nil {
+			return nil, err
+		}
+		if rejectStat == rejectRPCMismatch {
+			return nil, &RPCError{Msg: "RPC version mismatch"}
+		}
+		if rejectStat == rejectAuthError {
+			authStat, _ := r.uint32()
+			return nil, &RPCError{Msg: fmt.Sprintf("authentication error %d", authStat)}
+		}
+		return nil, &RPCError{Msg: fmt.Sprintf("unknown reject status %d", rejectStat)}
+	}
+	return nil, &RPCError{Msg: fmt.Sprintf("unknown reply status %d", replyStat)}
+}
+
+// writeRecord sends the message as a single record fragment
+func writeRecord(w io.Writer, msg []byte) error {
+	record := make([]byte, 4+len(msg))
+	binary.BigEndian.PutUint32(record, lastFragment|uint32(len(msg)))
+	copy(record[4:], msg)
+	_, err := w.Write(record)
+	return err
+}
+
+// readRecord reads the fragments of the record until the last one
+func readRecord(r io.Reader) ([]byte, error) {
+	var record []byte
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, err
+		}
+		marker := binary.BigEndian.Uint32(header[:])
+		size := int(marker &^ lastFragment)
+		if len(record)+size > maxReplySize {
+			return nil, &RPCError{Msg: fmt.Sprintf("reply is larger than %d bytes", maxReplySize)}
+		}
+		fragment := make([]byte, size)
+		if _, err := io.ReadFull(r, fragment); err != nil {
+			return nil, err
+		}
+		record = append(record, fragment...)
+		if marker&lastFragment != 0 {
+			return record, nil
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package nfsprobe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var errShortBuffer = errors.New("xdr: short buffer")
+
+// xdrWriter encodes the XDR (RFC 4506) items used by the probe
+type xdrWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *xdrWriter) uint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	w.buf.Write(b[:])
+}
+
+func (w *xdrWriter) uint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	w.buf.Write(b[:])
+}
+
+// fixed writes the fixed-length opaque data, padded to a multiple of four bytes
+func (w *xdrWriter) fixed(b []byte) {
+	w.buf.Write(b)
+	if pad := (4 - len(b)%4) % 4; pad > 0 {
+		w.buf.Write(make([]byte, pad))
+	}
+}
+
+// opaque writes the variable-length opaque data, the length goes first
+func (w *xdrWriter) opaque(b []byte) {
+	w.uint32(uint32(len(b)))
+	w.fixed(b)
+}
+
+func (w *xdrWriter) string(s string) {
+	w.opaque([]byte(s))
+}
+
+func (w *xdrWriter) bytes() []byte {
+	return w.buf.Bytes()
+}
+
+// xdrReader decodes the XDR items used by the probe
+type xdrReader struct {
+	buf []byte
+	off int
+}
+
+func (r *xdrReader) uint32() (uint32, error) {
+	if len(r.buf)-r.off < 4 {
+		return 0, errShortBuffer
+	}
+	v := binary.BigEndian.Uint32(r.buf[r.off:])
+	r.off += 4
+	return v, nil
+}
+
+func (r *xdrReader) uint64() (uint64, error) {
+	if len(r.buf)-r.off < 8 {
+		return 0, errShortBuffer
+	}
+	v := binary.BigEndian.Uint64(r.buf[r.off:])
+	r.off += 8
+	return v, nil
+}
+
+// fixed reads the fixed-length opaque data of n bytes and skips its padding
+func (r *xdrReader) fixed(n int) ([]byte, error) {
+	padded := n + (4-n%4)%4
+	if n < 0 || len(r.buf)-r.off < padded {
+		return nil, errShortBuffer
+	}
+	b := r.buf[r.off : r.off+n]
+	r.off += padded
+	return b, nil
+}
+
+func (r *xdrReader) opaque() ([]byte, error) {
+	n, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if int(n) > len(r.buf)-r.off {
+		return nil, errShortBuffer
+	}
+	return r.fixed(int(n))
+}
@@ -0,0 +1,104 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+	// the time zones of the schedules do not depend on the tzdata of the image
+	_ "time/tzdata"
+
+	"github.com/robfig/cron/v3"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+)
+
+// maxWindowsChained bounds the windows chained to find the close time, e.g. the windows opening every minute for an hour
+const maxWindowsChained = 10000
+
+// Schedule is the parsed schedule of the network filesystem, the union of its windows
+type Schedule struct {
+	windows  []window
+	location *time.Location
+}
+
+type window struct {
+	start    cron.Schedule
+	duration time.Duration
+}
+
+// Parse parses the cron expressions of the windows in the standard 5-field format, or the descriptors such as "@daily".
+// The expressions are evaluated in the time zone of the schedule, UTC if it is not set. On the daylight saving time
+// change, the start in the skipped hour does not open the window that day and the start in the repeated hour opens it
+// twice, while the durations are elapsed time.
+func Parse(spec *networkfsv2.NetworkFSSchedule) (*Schedule, error) {
+	location := time.UTC
+	if spec.TimeZone != "" {
+		var err error
+		if location, err = time.LoadLocation(spec.TimeZone); err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %w", spec.TimeZone, err)
+		}
+	}
+	if len(spec.Windows) == 0 {
+		return nil, fmt.Errorf("no window is scheduled")
+	}
+
+	s := &Schedule{location: location}
+	for i, w := range spec.Windows {
+		start, err := cron.ParseStandard(w.Start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start %q of window %d: %w", w.Start, i, err)
+		}
+		if w.Duration.Duration <= 0 {
+			return nil, fmt.Errorf("invalid duration %s of window %d, it must be positive", w.Duration.Duration, i)
+		}
+		s.windows = append(s.windows, window{start: start, duration: w.Duration.Duration})
+	}
+	return s, nil
+}
+
+// At returns whether any window is open at the time, and the next time a window opens or the open windows close.
+// The zero time is returned if the windows never open again.
+func (s *Schedule) At(now time.Time) (bool, time.Time) {
+	now = now.In(s.location)
+	end, open := s.openUntil(now)
+	if !open {
+		return false, s.nextOpen(now)
+	}
+	// the window opened before the previous one closes extends it
+	for i := 0; i < maxWindowsChained; i++ {
+		extended, open := s.openUntil(end)
+		if !open || !extended.After(end) {
+			break
+		}
+		end = extended
+	}
+	return true, end
+}
+
+// openUntil returns the time the windows open at the time close, the longest one if they overlap
+func (s *Schedule) openUntil(now time.Time) (time.Time, bool) {
+	var end time.Time
+	open := false
+	for _, w := range s.windows {
+		// the windows opened after now-duration are still open, the first of them tells if any opened by now
+		start := w.start.Next(now.Add(-w.duration))
+		if start.IsZero() || start.After(now) {
+			continue
+		}
+		if closeTime := start.Add(w.duration); closeTime.After(now) && closeTime.After(end) {
+			end, open = closeTime, true
+		}
+	}
+	return end, open
+}
+
+// nextOpen returns the first time a window opens after the time, the zero time if none does
+func (s *Schedule) nextOpen(now time.Time) time.Time {
+	var next time.Time
+	for _, w := range s.windows {
+		start := w.start.Next(now)
+		if !start.IsZero() && (next.IsZero() || start.Before(next)) {
+			next = start
+		}
+	}
+	return next
+}
@@ -0,0 +1,264 @@
+package schedule
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+)
+
+func parse(t *testing.T, timeZone string, windows ...networkfsv2.NetworkFSScheduleWindow) *Schedule {
+	t.Helper()
+	s, err := Parse(&networkfsv2.NetworkFSSchedule{TimeZone: timeZone, Windows: windows})
+	if err != nil {
+		t.Fatalf("failed to parse the schedule: %v", err)
+	}
+	return s
+}
+
+func specWindow(start string, duration time.Duration) networkfsv2.NetworkFSScheduleWindow {
+	return networkfsv2.NetworkFSScheduleWindow{Start: start, Duration: metav1.Duration{Duration: duration}}
+}
+
+func mustTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatalf("invalid time %q: %v", value, err)
+	}
+	return parsed
+}
+
+// transition is the state of the schedule from the time on, until the next transition
+type transition struct {
+	at   string
+	open bool
+}
+
+// checkTransitions walks the clock from the first transition to the next one the schedule returns, and asserts
+// the schedule goes through the transitions in order
+func checkTransitions(t *testing.T, s *Schedule, transitions []transition) {
+	t.Helper()
+	now := mustTime(t, transitions[0].at)
+	for i, want := range transitions {
+		if !now.Equal(mustTime(t, want.at)) {
+			t.Fatalf("transition %d is at %s, want %s", i, now.UTC().Format(time.RFC3339), want.at)
+		}
+		open, next := s.At(now)
+		if open != want.open {
+			t.Fatalf("open at %s = %t, want %t", want.at, open, want.open)
+		}
+		if next.IsZero() {
+			if i != len(transitions)-1 {
+				t.Fatalf("no transition after %s, want %s", want.at, transitions[i+1].at)
+			}
+			return
+		}
+		// the state holds until the next transition
+		if before, _ := s.At(next.Add(-time.Second)); before != want.open {
+			t.Fatalf("open at %s = %t, want %t", next.Add(-time.Second).UTC().Format(time.RFC3339), before, want.open)
+		}
+		now = next
+	}
+}
+
+func TestScheduleWindow(t *testing.T) {
+	s := parse(t, "", specWindow("0 22 * * *", 2*time.Hour))
+	checkTransitions(t, s, []transition{
+		{at: "2026-01-15T12:00:00Z", open: false},
+		{at: "2026-01-15T22:00:00Z", open: true},
+		{at: "2026-01-16T00:00:00Z", open: false},
+		{at: "2026-01-16T22:00:00Z", open: true},
+	})
+
+	// the window opened before the time is still open
+	open, next := s.At(mustTime(t, "2026-01-15T23:30:00Z"))
+	if !open || !next.Equal(mustTime(t, "2026-01-16T00:00:00Z")) {
+		t.Errorf("at 23:30, open = %t, next = %s, want open until 00:00", open, next)
+	}
+}
+
+func TestScheduleTimeZone(t *testing.T) {
+	// 22:00 in Tokyo is 13:00 UTC
+	s := parse(t, "Asia/Tokyo", specWindow("0 22 * * *", 2*time.Hour))
+	checkTransitions(t, s, []transition{
+		{at: "2026-01-15T00:00:00Z", open: false},
+		{at: "2026-01-15T13:00:00Z", open: true},
+		{at: "2026-01-15T15:00:00Z", open: false},
+	})
+}
+
+func TestScheduleDaylightSavingTime(t *testing.T) {
+	tests := []struct {
+		name        string
+		window      networkfsv2.NetworkFSScheduleWindow
+		transitions []transition
+	}{
+		{
+			// Berlin moves from 02:00 CET to 03:00 CEST on 2026-03-29, 02:30 does not exist that day
+			name:   "start in the skipped hour",
+			window: specWindow("30 2 * * *", 30*time.Minute),
+			transitions: []transition{
+				{at: "2026-03-28T01:30:00Z", open: true},
+				{at: "2026-03-28T02:00:00Z", open: false},
+				{at: "2026-03-30T00:30:00Z", open: true},
+				{at: "2026-03-30T01:00:00Z", open: false},
+			},
+		},
+		{
+			// Berlin moves from 03:00 CEST back to 02:00 CET on 2026-10-25, 02:30 happens twice that day
+			name:   "start in the repeated hour",
+			window: specWindow("30 2 * * *", 30*time.Minute),
+			transitions: []transition{
+				{at: "2026-10-24T00:30:00Z", open: true},
+				{at: "2026-10-24T01:00:00Z", open: false},
+				{at: "2026-10-25T00:30:00Z", open: true},
+				{at: "2026-10-25T01:00:00Z", open: false},
+				{at: "2026-10-25T01:30:00Z", open: true},
+				{at: "2026-10-25T02:00:00Z", open: false},
+				{at: "2026-10-26T01:30:00Z", open: true},
+			},
+		},
+		{
+			// the duration is elapsed time, the window opened at 01:00 CET closes at 06:00 CEST
+			name:   "window across the change",
+			window: specWindow("0 1 * * *", 4*time.Hour),
+			transitions: []transition{
+				{at: "2026-03-29T00:00:00Z", open: true},
+				{at: "2026-03-29T04:00:00Z", open: false},
+				{at: "2026-03-29T23:00:00Z", open: true},
+				{at: "2026-03-30T03:00:00Z", open: false},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkTransitions(t, parse(t, "Europe/Berlin", tt.window), tt.transitions)
+		})
+	}
+}
+
+func TestScheduleOverlappingWindows(t *testing.T) {
+	tests := []struct {
+		name        string
+		windows     []networkfsv2.NetworkFSScheduleWindow
+		transitions []transition
+	}{
+		{
+			name:    "overlapping windows are merged",
+			windows: []networkfsv2.NetworkFSScheduleWindow{specWindow("0 8 * * *", 3*time.Hour), specWindow("0 10 * * *", 3*time.Hour)},
+			transitions: []transition{
+				{at: "2026-01-15T00:00:00Z", open: false},
+				{at: "2026-01-15T08:00:00Z", open: true},
+				{at: "2026-01-15T13:00:00Z", open: false},
+			},
+		},
+		{
+			name:    "contiguous windows are chained",
+			windows: []networkfsv2.NetworkFSScheduleWindow{specWindow("0 8 * * *", 2*time.Hour), specWindow("0 10 * * *", 2*time.Hour)},
+			transitions: []transition{
+				{at: "2026-01-15T08:00:00Z", open: true},
+				{at: "2026-01-15T12:00:00Z", open: false},
+			},
+		},
+		{
+			name:    "window within another one",
+			windows: []networkfsv2.NetworkFSScheduleWindow{specWindow("0 8 * * *", 8*time.Hour), specWindow("0 10 * * *", time.Hour)},
+			transitions: []transition{
+				{at: "2026-01-15T08:00:00Z", open: true},
+				{at: "2026-01-15T16:00:00Z", open: false},
+			},
+		},
+		{
+			name:    "windows opening every minute for an hour",
+			windows: []networkfsv2.NetworkFSScheduleWindow{specWindow("* 8 * * *", 2*time.Minute)},
+			transitions: []transition{
+				{at: "2026-01-15T08:00:00Z", open: true},
+				{at: "2026-01-15T09:01:00Z", open: false},
+				{at: "2026-01-16T08:00:00Z", open: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkTransitions(t, parse(t, "", tt.windows...), tt.transitions)
+		})
+	}
+}
+
+func TestScheduleAlwaysOpen(t *testing.T) {
+	// the windows never close, the close time is bounded by the windows chained
+	s := parse(t, "", specWindow("@hourly", time.Hour))
+	now := mustTime(t, "2026-01-15T10:30:00Z")
+	open, next := s.At(now)
+	want := mustTime(t, "2026-01-15T11:00:00Z").Add(maxWindowsChained * time.Hour)
+	if !open || !next.Equal(want) {
+		t.Errorf("open = %t, next = %s, want open until %s", open, next, want)
+	}
+}
+
+func TestScheduleNeverOpens(t *testing.T) {
+	s := parse(t, "", specWindow("0 0 30 2 *", time.Hour))
+	open, next := s.At(mustTime(t, "2026-01-15T00:00:00Z"))
+	if open || !next.IsZero() {
+		t.Errorf("open = %t, next = %s, want closed for good", open, next)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    networkfsv2.NetworkFSSchedule
+		wantErr string
+	}{
+		{
+			name: "descriptor",
+			spec: networkfsv2.NetworkFSSchedule{Windows: []networkfsv2.NetworkFSScheduleWindow{specWindow("@daily", time.Hour)}},
+		},
+		{
+			name:    "invalid time zone",
+			spec:    networkfsv2.NetworkFSSchedule{TimeZone: "Mars/Olympus", Windows: []networkfsv2.NetworkFSScheduleWindow{specWindow("@daily", time.Hour)}},
+			wantErr: "invalid time zone",
+		},
+		{
+			name:    "no window",
+			spec:    networkfsv2.NetworkFSSchedule{TimeZone: "UTC"},
+			wantErr: "no window",
+		},
+		{
+			name:    "invalid start",
+			spec:    networkfsv2.NetworkFSSchedule{Windows: []networkfsv2.NetworkFSScheduleWindow{specWindow("0 25 * * *", time.Hour)}},
+			wantErr: "invalid start",
+		},
+		{
+			name:    "start with seconds",
+			spec:    networkfsv2.NetworkFSSchedule{Windows: []networkfsv2.NetworkFSScheduleWindow{specWindow("0 0 22 * * *", time.Hour)}},
+			wantErr: "invalid start",
+		},
+		{
+			name:    "non-positive duration",
+			spec:    networkfsv2.NetworkFSSchedule{Windows: []networkfsv2.NetworkFSScheduleWindow{specWindow("@daily", 0)}},
+			wantErr: "invalid duration",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(&tt.spec)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,18 +2,31 @@ package utils
 
 import (
 	"fmt"
-
-	"github.com/sirupsen/logrus"
-
-	networkfsv1 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"time"
 )
 
 type Option struct {
-	KubeConfig  string
-	Namespace   string
-	NodeName    string
-	Debug       bool
-	Threadiness int
+	KubeConfig          string
+	Namespace           string
+	NodeName            string
+	Debug               bool
+	Threadiness         int
+	WebhookPort         int
+	WebhookServiceName  string
+	AutoDiscovery       bool
+	GCOrphaned          bool
+	TransitionTimeout   time.Duration
+	ConsumerGracePeriod time.Duration
+	MetricsPort         int
+	HealthPort          int
+	PprofPort           int
+	ProbeInterval       time.Duration
+	ProbeTimeout        time.Duration
+	DNSPort             int
+	DNSZone             string
+	DNSTTL              time.Duration
+	ActivityInterval    time.Duration
+	FailbackDelay       time.Duration
 }
 
 // These values are set via linker flags in scripts/build
@@ -23,27 +36,19 @@ var (
 	LHNameSpace = "longhorn-system"
 )
 
-func FriendlyVersion() string {
-	return fmt.Sprintf("%s (%s)", Version, GitCommit)
-}
-
-func UpdateNetworkFSConds(curConds []networkfsv1.NetworkFSCondition, c networkfsv1.NetworkFSCondition) []networkfsv1.NetworkFSCondition {
-	found := false
-	var pod = 0
-	logrus.Infof("Prepare to check the coming Type: %s, Status: %s", c.Type, c.Status)
-	for id, cond := range curConds {
-		if cond.Type == c.Type {
-			found = true
-			pod = id
-			break
-		}
-	}
+const (
+	// LHCSIDriverName is the name of the Longhorn CSI driver
+	LHCSIDriverName = "driver.longhorn.io"
+	// NetworkFSCRDName is the name of the NetworkFilesystem CRD
+	NetworkFSCRDName = "networkfilesystems.harvesterhci.io"
+)
 
-	if found {
-		curConds[pod] = c
-	} else {
-		curConds = append(curConds, c)
-	}
-	return curConds
+// NetworkFSObjectName returns the name of the objects owned by the network filesystem in its namespace,
+// e.g. the Service exposing it and the binding Secret
+func NetworkFSObjectName(name string) string {
+	return "networkfs-" + name
+}
 
+func FriendlyVersion() string {
+	return fmt.Sprintf("%s (%s)", Version, GitCommit)
 }
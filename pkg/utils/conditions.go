@@ -0,0 +1,69 @@
+package utils
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+)
+
+// GetNetworkFSCondition returns the condition of the type, nil if it is not set
+func GetNetworkFSCondition(conds []networkfsv2.NetworkFSCondition, condType networkfsv2.ConditionType) *networkfsv2.NetworkFSCondition {
+	for i := range conds {
+		if conds[i].Type == condType {
+			return &conds[i]
+		}
+	}
+	return nil
+}
+
+// IsNetworkFSConditionTrue returns true if the condition of the type is set and true
+func IsNetworkFSConditionTrue(conds []networkfsv2.NetworkFSCondition, condType networkfsv2.ConditionType) bool {
+	cond := GetNetworkFSCondition(conds, condType)
+	return cond != nil && cond.Status == corev1.ConditionTrue
+}
+
+// SetNetworkFSCondition sets the condition of the type and returns the updated conditions, the input is left untouched.
+// The transition time is now and only moves when the status changes, so setting the same condition again is a no-op.
+func SetNetworkFSCondition(conds []networkfsv2.NetworkFSCondition, condType networkfsv2.ConditionType, status corev1.ConditionStatus, reason, message string, now metav1.Time) []networkfsv2.NetworkFSCondition {
+	cond := networkfsv2.NetworkFSCondition{
+		Type:               condType,
+		Status:             status,
+		LastTransitionTime: now.Rfc3339Copy(),
+		Reason:             reason,
+		Message:            message,
+	}
+	existing := GetNetworkFSCondition(conds, condType)
+	if existing == nil {
+		return append(append([]networkfsv2.NetworkFSCondition{}, conds...), cond)
+	}
+	if existing.Status == status && existing.Reason == reason && existing.Message == message {
+		return conds
+	}
+	if existing.Status == status {
+		cond.LastTransitionTime = existing.LastTransitionTime
+	}
+
+	updated := make([]networkfsv2.NetworkFSCondition, 0, len(conds))
+	for _, c := range conds {
+		if c.Type == condType {
+			c = cond
+		}
+		updated = append(updated, c)
+	}
+	return updated
+}
+
+// RemoveNetworkFSCondition returns the conditions without the ones of the type
+func RemoveNetworkFSCondition(conds []networkfsv2.NetworkFSCondition, condType networkfsv2.ConditionType) []networkfsv2.NetworkFSCondition {
+	if GetNetworkFSCondition(conds, condType) == nil {
+		return conds
+	}
+	updated := make([]networkfsv2.NetworkFSCondition, 0, len(conds))
+	for _, c := range conds {
+		if c.Type != condType {
+			updated = append(updated, c)
+		}
+	}
+	return updated
+}
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+)
+
+// EventComponent is the source component of the events recorded by the manager
+const EventComponent = "harvester-network-fs-manager"
+
+// NewEventRecorder returns the recorder of the events on the NetworkFilesystems and the core objects
+func NewEventRecorder(client kubernetes.Interface) (record.EventRecorder, error) {
+	eventScheme := runtime.NewScheme()
+	if err := scheme.AddToScheme(eventScheme); err != nil {
+		return nil, err
+	}
+	if err := networkfsv2.AddToScheme(eventScheme); err != nil {
+		return nil, err
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartLogging(logrus.Debugf)
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	return broadcaster.NewRecorder(eventScheme, corev1.EventSource{Component: EventComponent}), nil
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+)
+
+// NFSPort is the port the NFS export is served at unless it is exposed otherwise
+const NFSPort = 2049
+
+// ExportMountOptions returns the mount options of the export, pinned to the first NFS version served if the
+// options do not pin one, with the port if the export is not served at the NFS port
+func ExportMountOptions(export *networkfsv2.NetworkFSExport) string {
+	var opts []string
+	pinned := false
+	for _, opt := range strings.Split(export.MountOptions, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+		key, _, _ := strings.Cut(opt, "=")
+		pinned = pinned || key == "vers" || key == "nfsvers"
+		opts = append(opts, opt)
+	}
+	if !pinned && len(export.NFSVersions) > 0 {
+		opts = append(opts, "vers="+export.NFSVersions[0])
+	}
+	if export.Port != 0 && export.Port != NFSPort {
+		opts = append(opts, fmt.Sprintf("port=%d", export.Port))
+	}
+	return strings.Join(opts, ",")
+}
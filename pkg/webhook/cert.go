@@ -0,0 +1,204 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	ctlcorev1 "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	caCertKey = "ca.crt"
+
+	certValidity = 10 * 365 * 24 * time.Hour
+	// regenerate the certificate when it expires within this period
+	certRenewBefore = 30 * 24 * time.Hour
+	// how often the serving certificate is checked again, well within certRenewBefore
+	certCheckInterval = 12 * time.Hour
+)
+
+// certificate is the serving certificate of the webhook, along with the CA signing it
+type certificate struct {
+	caPEM   []byte
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// ensureCertificate returns the serving certificate stored in the secret, it generates a new one
+// if the secret is missing, the certificate is about to expire at now or does not cover the DNS names.
+// Every replica converges on the content of the secret, so the first writer wins.
+func ensureCertificate(secrets ctlcorev1.SecretClient, namespace, name string, dnsNames []string, now time.Time) (*certificate, error) {
+	secret, err := secrets.Get(namespace, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		secret = nil
+	case err != nil:
+		return nil, err
+	default:
+		cert := certificateFromSecret(secret)
+		verifyErr := cert.verify(dnsNames, now)
+		if verifyErr == nil {
+			return cert, nil
+		}
+		logrus.Infof("Regenerate webhook certificate in secret %s/%s: %v", namespace, name, verifyErr)
+	}
+
+	cert, err := generateCertificate(dnsNames, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret == nil {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: cert.data(),
+		}
+		if _, err := secrets.Create(secret); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				// another replica won the race, use its certificate
+				return ensureCertificate(secrets, namespace, name, dnsNames, now)
+			}
+			return nil, err
+		}
+		return cert, nil
+	}
+
+	secretCpy := secret.DeepCopy()
+	secretCpy.Data = cert.data()
+	if _, err := secrets.Update(secretCpy); err != nil {
+		if apierrors.IsConflict(err) {
+			return ensureCertificate(secrets, namespace, name, dnsNames, now)
+		}
+		return nil, err
+	}
+	return cert, nil
+}
+
+func certificateFromSecret(secret *corev1.Secret) *certificate {
+	return &certificate{
+		caPEM:   secret.Data[caCertKey],
+		certPEM: secret.Data[corev1.TLSCertKey],
+		keyPEM:  secret.Data[corev1.TLSPrivateKeyKey],
+	}
+}
+
+func (c *certificate) data() map[string][]byte {
+	return map[string][]byte{
+		caCertKey:               c.caPEM,
+		corev1.TLSCertKey:       c.certPEM,
+		corev1.TLSPrivateKeyKey: c.keyPEM,
+	}
+}
+
+// verify checks the serving certificate is signed by the CA, covers the DNS names and is not about to expire at now
+func (c *certificate) verify(dnsNames []string, now time.Time) error {
+	block, _ := pem.Decode(c.certPEM)
+	if block == nil {
+		return errors.New("no serving certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(c.caPEM) {
+		return errors.New("no CA certificate")
+	}
+	if now.Add(certRenewBefore).After(cert.NotAfter) {
+		return fmt.Errorf("certificate expires at %s", cert.NotAfter)
+	}
+	for _, dnsName := range dnsNames {
+		if _, err := cert.Verify(x509.VerifyOptions{DNSName: dnsName, Roots: roots, CurrentTime: now}); err != nil {
+			return err
+		}
+	}
+	if block, _ := pem.Decode(c.keyPEM); block == nil {
+		return errors.New("no private key")
+	}
+	return nil
+}
+
+// generateCertificate generates a self-signed CA and a serving certificate for the DNS names, valid from now
+func generateCertificate(dnsNames []string, now time.Time) (*certificate, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          newSerialNumber(),
+		Subject:               pkix.Name{CommonName: "networkfs-manager-webhook-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: newSerialNumber(),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &certificate{
+		caPEM:   encodePEM("CERTIFICATE", caDER),
+		certPEM: encodePEM("CERTIFICATE", certDER),
+		keyPEM:  encodePEM("EC PRIVATE KEY", keyDER),
+	}, nil
+}
+
+func encodePEM(blockType string, der []byte) []byte {
+	var buf bytes.Buffer
+	_ = pem.Encode(&buf, &pem.Block{Type: blockType, Bytes: der})
+	return buf.Bytes()
+}
+
+func newSerialNumber() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
@@ -0,0 +1,195 @@
+package webhook
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rancher/wrangler/v3/pkg/generic"
+	admissionregv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+var testDNSNames = []string{"networkfs-manager-webhook.harvester-system.svc", "networkfs-manager-webhook.harvester-system.svc.cluster.local"}
+
+// fakeObjects stores the objects keyed by namespace/name, the server only gets, creates and updates them
+type fakeObjects[T generic.RuntimeMetaObject] map[string]T
+
+func (o fakeObjects[T]) get(namespace, name string) (T, error) {
+	if obj, ok := o[namespace+"/"+name]; ok {
+		return obj.DeepCopyObject().(T), nil
+	}
+	var none T
+	return none, apierrors.NewNotFound(schema.GroupResource{}, name)
+}
+
+func (o fakeObjects[T]) create(obj T) (T, error) {
+	key := obj.GetNamespace() + "/" + obj.GetName()
+	if _, ok := o[key]; ok {
+		var none T
+		return none, apierrors.NewAlreadyExists(schema.GroupResource{}, obj.GetName())
+	}
+	o[key] = obj.DeepCopyObject().(T)
+	return obj, nil
+}
+
+func (o fakeObjects[T]) update(obj T) (T, error) {
+	o[obj.GetNamespace()+"/"+obj.GetName()] = obj.DeepCopyObject().(T)
+	return obj, nil
+}
+
+type fakeClient[T generic.RuntimeMetaObject, TList runtime.Object] struct {
+	generic.ClientInterface[T, TList]
+	objects fakeObjects[T]
+}
+
+func (c *fakeClient[T, TList]) Get(namespace, name string, _ metav1.GetOptions) (T, error) {
+	return c.objects.get(namespace, name)
+}
+
+func (c *fakeClient[T, TList]) Create(obj T) (T, error) { return c.objects.create(obj) }
+
+func (c *fakeClient[T, TList]) Update(obj T) (T, error) { return c.objects.update(obj) }
+
+type fakeNonNamespacedClient[T generic.RuntimeMetaObject, TList runtime.Object] struct {
+	generic.NonNamespacedClientInterface[T, TList]
+	objects fakeObjects[T]
+}
+
+func (c *fakeNonNamespacedClient[T, TList]) Get(name string, _ metav1.GetOptions) (T, error) {
+	return c.objects.get("", name)
+}
+
+func (c *fakeNonNamespacedClient[T, TList]) Create(obj T) (T, error) { return c.objects.create(obj) }
+
+func (c *fakeNonNamespacedClient[T, TList]) Update(obj T) (T, error) { return c.objects.update(obj) }
+
+func TestCertificateVerify(t *testing.T) {
+	issued := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	cert, err := generateCertificate(testDNSNames, issued)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := generateCertificate(testDNSNames, issued)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		cert     *certificate
+		dnsNames []string
+		now      time.Time
+		wantErr  string
+	}{
+		{name: "issued", cert: cert, dnsNames: testDNSNames, now: issued},
+		{name: "before the renewal", cert: cert, dnsNames: testDNSNames, now: issued.Add(certValidity - certRenewBefore - time.Hour)},
+		{name: "within the renewal", cert: cert, dnsNames: testDNSNames, now: issued.Add(certValidity - certRenewBefore + time.Hour), wantErr: "certificate expires at"},
+		{name: "expired", cert: cert, dnsNames: testDNSNames, now: issued.Add(certValidity + time.Hour), wantErr: "certificate expires at"},
+		{name: "other service", cert: cert, dnsNames: []string{"other.harvester-system.svc"}, now: issued, wantErr: "other.harvester-system.svc"},
+		{
+			name:     "other CA",
+			cert:     &certificate{caPEM: other.caPEM, certPEM: cert.certPEM, keyPEM: cert.keyPEM},
+			dnsNames: testDNSNames,
+			now:      issued,
+			wantErr:  "unknown authority",
+		},
+		{name: "no certificate", cert: &certificate{caPEM: cert.caPEM}, dnsNames: testDNSNames, now: issued, wantErr: "no serving certificate"},
+		{name: "no private key", cert: &certificate{caPEM: cert.caPEM, certPEM: cert.certPEM}, dnsNames: testDNSNames, now: issued, wantErr: "no private key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cert.verify(tt.dnsNames, tt.now)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRefreshCertificate(t *testing.T) {
+	secrets := &fakeClient[*corev1.Secret, *corev1.SecretList]{objects: fakeObjects[*corev1.Secret]{}}
+	webhookConfigs := &fakeNonNamespacedClient[*admissionregv1.ValidatingWebhookConfiguration, *admissionregv1.ValidatingWebhookConfigurationList]{
+		objects: fakeObjects[*admissionregv1.ValidatingWebhookConfiguration]{},
+	}
+	crds := &fakeNonNamespacedClient[*apiextensionsv1.CustomResourceDefinition, *apiextensionsv1.CustomResourceDefinitionList]{
+		objects: fakeObjects[*apiextensionsv1.CustomResourceDefinition]{
+			"/" + utils.NetworkFSCRDName: {ObjectMeta: metav1.ObjectMeta{Name: utils.NetworkFSCRDName}},
+		},
+	}
+	newServer := func() *Server {
+		return &Server{
+			namespace:      "harvester-system",
+			serviceName:    "networkfs-manager-webhook",
+			secrets:        secrets,
+			webhookConfigs: webhookConfigs,
+			crds:           crds,
+		}
+	}
+	caBundles := func() ([]byte, []byte) {
+		vwc := webhookConfigs.objects["/"+validatingWebhookName]
+		crd := crds.objects["/"+utils.NetworkFSCRDName]
+		return vwc.Webhooks[0].ClientConfig.CABundle, crd.Spec.Conversion.Webhook.ClientConfig.CABundle
+	}
+	const secretKey = "harvester-system/networkfs-manager-webhook-tls"
+
+	// the first start generates the certificate and points the webhooks to its CA
+	issued := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	server := newServer()
+	if err := server.refreshCertificate(testDNSNames, issued); err != nil {
+		t.Fatal(err)
+	}
+	first := server.serving.Load()
+	if first == nil || !bytes.Equal(secrets.objects[secretKey].Data[corev1.TLSCertKey], first.cert.certPEM) {
+		t.Fatalf("serving certificate is not the one stored in the secret")
+	}
+	if validating, conversion := caBundles(); !bytes.Equal(validating, first.cert.caPEM) || !bytes.Equal(conversion, first.cert.caPEM) {
+		t.Errorf("CA bundles are not the CA of the certificate")
+	}
+
+	// the periodic check keeps the valid certificate
+	if err := server.refreshCertificate(testDNSNames, issued.Add(certValidity-certRenewBefore-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if server.serving.Load() != first {
+		t.Errorf("valid certificate is replaced")
+	}
+
+	// the periodic check renews the certificate about to expire, the webhooks trust both CAs meanwhile
+	renewal := issued.Add(certValidity - certRenewBefore + time.Hour)
+	if err := server.refreshCertificate(testDNSNames, renewal); err != nil {
+		t.Fatal(err)
+	}
+	renewed := server.serving.Load()
+	if bytes.Equal(renewed.cert.certPEM, first.cert.certPEM) || !bytes.Equal(secrets.objects[secretKey].Data[corev1.TLSCertKey], renewed.cert.certPEM) {
+		t.Fatalf("certificate is not renewed in the secret")
+	}
+	if !renewed.keyPair.Leaf.NotAfter.After(renewal.Add(certRenewBefore)) {
+		t.Errorf("renewed certificate expires at %s", renewed.keyPair.Leaf.NotAfter)
+	}
+	wantBundle := append(bytes.Clone(renewed.cert.caPEM), first.cert.caPEM...)
+	if validating, conversion := caBundles(); !bytes.Equal(validating, wantBundle) || !bytes.Equal(conversion, wantBundle) {
+		t.Errorf("CA bundles do not hold the renewed and the replaced CA")
+	}
+
+	// another replica serves the renewed certificate of the secret
+	replica := newServer()
+	if err := replica.refreshCertificate(testDNSNames, renewal); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(replica.serving.Load().cert.certPEM, renewed.cert.certPEM) {
+		t.Errorf("replica does not serve the renewed certificate")
+	}
+}
@@ -0,0 +1,282 @@
+package networkfilesystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networkfsv1 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta1"
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+)
+
+// v1beta2Saved is the part of the v1beta2 NetworkFilesystem saved in the conversion annotation of the v1beta1 one.
+// The spec fields are inlined, so the annotations written before the status was saved still decode.
+type v1beta2Saved struct {
+	*networkfsv2.NetworkFSSpec
+	// the status fields v1beta1 cannot represent, e.g. the timers of the effective desired state the controller reads
+	// back, so the status written through v1beta1 does not reset them
+	Status *networkfsv2.NetworkFSStatus `json:"status,omitempty"`
+}
+
+// convertToV1beta2 converts the v1beta1 NetworkFilesystem to v1beta2, the storage version. The v1beta2 spec and
+// status saved in the conversion annotation by convertFromV1beta2 fill the fields v1beta1 cannot represent, and the
+// v1beta1 spec is saved in turn if v1beta2 cannot represent it, so the conversion round-trips both ways.
+func convertToV1beta2(in *networkfsv1.NetworkFilesystem, out *networkfsv2.NetworkFilesystem) error {
+	var saved v1beta2Saved
+	if err := unmarshalConversion(in.Annotations, &saved); err != nil {
+		return err
+	}
+
+	out.TypeMeta = metav1.TypeMeta{APIVersion: networkfsv2.SchemeGroupVersion.String(), Kind: "NetworkFilesystem"}
+	out.ObjectMeta = *in.ObjectMeta.DeepCopy()
+	out.Spec = convertSpecTo(&in.Spec, saved.NetworkFSSpec)
+	out.Status = convertStatusTo(&in.Status, saved.Status)
+
+	delete(out.Annotations, networkfsv2.AnnotationConversion)
+	if back := convertSpecFrom(&out.Spec, nil); !reflect.DeepEqual(back, in.Spec) {
+		return marshalConversion(&out.ObjectMeta, &in.Spec)
+	}
+	return nil
+}
+
+// convertFromV1beta2 converts the v1beta2 NetworkFilesystem to v1beta1, see convertToV1beta2
+func convertFromV1beta2(in *networkfsv2.NetworkFilesystem, out *networkfsv1.NetworkFilesystem) error {
+	var savedV1beta1 *networkfsv1.NetworkFSSpec
+	if err := unmarshalConversion(in.Annotations, &savedV1beta1); err != nil {
+		return err
+	}
+
+	out.TypeMeta = metav1.TypeMeta{APIVersion: networkfsv1.SchemeGroupVersion.String(), Kind: "NetworkFilesystem"}
+	out.ObjectMeta = *in.ObjectMeta.DeepCopy()
+	out.Spec = convertSpecFrom(&in.Spec, savedV1beta1)
+	out.Status = convertStatusFrom(&in.Status, in.Spec.Protocol)
+
+	delete(out.Annotations, networkfsv2.AnnotationConversion)
+	saved := v1beta2Saved{Status: v1beta2OnlyStatus(&in.Status)}
+	if back := convertSpecTo(&out.Spec, nil); !reflect.DeepEqual(back, in.Spec) {
+		saved.NetworkFSSpec = &in.Spec
+	}
+	if saved.NetworkFSSpec != nil || saved.Status != nil {
+		return marshalConversion(&out.ObjectMeta, &saved)
+	}
+	return nil
+}
+
+func unmarshalConversion(annotations map[string]string, saved interface{}) error {
+	value, ok := annotations[networkfsv2.AnnotationConversion]
+	if !ok {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(value), saved); err != nil {
+		return fmt.Errorf("invalid annotation %s: %w", networkfsv2.AnnotationConversion, err)
+	}
+	return nil
+}
+
+func marshalConversion(meta *metav1.ObjectMeta, saved interface{}) error {
+	value, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[networkfsv2.AnnotationConversion] = string(value)
+	return nil
+}
+
+// convertSpecTo converts the spec to v1beta2, the fields v1beta1 cannot represent are taken from the saved spec,
+// which is decoded from the annotation and owned by the caller
+func convertSpecTo(in *networkfsv1.NetworkFSSpec, saved *networkfsv2.NetworkFSSpec) networkfsv2.NetworkFSSpec {
+	out := networkfsv2.NetworkFSSpec{}
+	if saved != nil {
+		out = *saved
+	}
+
+	out.VolumeRef = networkfsv2.NetworkFSVolumeRef{VolumeName: in.NetworkFSName}
+	if ref := in.VolumeRef; ref != nil {
+		out.VolumeRef = networkfsv2.NetworkFSVolumeRef{VolumeName: ref.VolumeName}
+		if claim := ref.PersistentVolumeClaim; claim != nil {
+			out.VolumeRef.PersistentVolumeClaim = &networkfsv2.NetworkFSClaimRef{Namespace: claim.Namespace, Name: claim.Name}
+		}
+	}
+	out.DesiredState = networkfsv2.NetworkFSState(in.DesiredState)
+	// v1beta1 only holds the most preferred node, the others are kept unless it is changed
+	if in.PreferredNode == "" {
+		out.PreferredNodes = nil
+	} else if len(out.PreferredNodes) == 0 || out.PreferredNodes[0] != in.PreferredNode {
+		out.PreferredNodes = []string{in.PreferredNode}
+	}
+	if out.Protocol == "" {
+		out.Protocol = networkfsv2.NetworkFSProtocolNFS
+	}
+	out.Force = in.Force
+	out.TransitionTimeout = nil
+	if in.TransitionTimeout != nil {
+		out.TransitionTimeout = in.TransitionTimeout.DeepCopy()
+	}
+	return out
+}
+
+// convertSpecFrom converts the spec from v1beta2, the deprecated networkFSName is restored from the saved spec
+func convertSpecFrom(in *networkfsv2.NetworkFSSpec, saved *networkfsv1.NetworkFSSpec) networkfsv1.NetworkFSSpec {
+	out := networkfsv1.NetworkFSSpec{
+		DesiredState: networkfsv1.NetworkFSState(in.DesiredState),
+		Force:        in.Force,
+	}
+	ref := in.VolumeRef
+	switch {
+	case saved != nil && saved.VolumeRef == nil && saved.NetworkFSName != "" && ref.PersistentVolumeClaim == nil && ref.VolumeName == saved.NetworkFSName:
+		out.NetworkFSName = saved.NetworkFSName
+	case ref.PersistentVolumeClaim != nil || ref.VolumeName != "":
+		out.VolumeRef = &networkfsv1.NetworkFSVolumeRef{VolumeName: ref.VolumeName}
+		if claim := ref.PersistentVolumeClaim; claim != nil {
+			out.VolumeRef.PersistentVolumeClaim = &networkfsv1.NetworkFSClaimRef{Namespace: claim.Namespace, Name: claim.Name}
+		}
+	}
+	if len(in.PreferredNodes) > 0 {
+		out.PreferredNode = in.PreferredNodes[0]
+	}
+	if in.TransitionTimeout != nil {
+		out.TransitionTimeout = in.TransitionTimeout.DeepCopy()
+	}
+	return out
+}
+
+// convertStatusTo converts the status to v1beta2, the fields v1beta1 cannot represent are taken from the saved status
+func convertStatusTo(in *networkfsv1.NetworkFSStatus, saved *networkfsv2.NetworkFSStatus) networkfsv2.NetworkFSStatus {
+	out := networkfsv2.NetworkFSStatus{
+		ObservedGeneration: in.ObservedGeneration,
+		State:              networkfsv2.NetworkFSState(in.State),
+		PersistentVolume:   in.PersistentVolume,
+		Volume:             in.Volume,
+	}
+	if saved != nil {
+		copyV1beta2OnlyStatus(&out, saved)
+	}
+	for _, cond := range in.NetworkFSConds {
+		out.NetworkFSConds = append(out.NetworkFSConds, networkfsv2.NetworkFSCondition{
+			Type:               networkfsv2.ConditionType(cond.Type),
+			Status:             cond.Status,
+			LastTransitionTime: cond.LastTransitionTime,
+			Reason:             cond.Reason,
+			Message:            cond.Message,
+		})
+	}
+	switch {
+	case in.Export != nil:
+		out.Export = &networkfsv2.NetworkFSExport{
+			Addresses:    append([]string(nil), in.Export.Addresses...),
+			Port:         in.Export.Port,
+			Protocol:     in.Export.Protocol,
+			ExportPath:   in.Export.ExportPath,
+			NFSVersions:  append([]string(nil), in.Export.NFSVersions...),
+			MountSource:  in.Export.MountSource,
+			MountOptions: in.MountOpts,
+		}
+	case in.Endpoint != "":
+		// written by the versions before the structured export
+		out.Export = &networkfsv2.NetworkFSExport{
+			Addresses:    []string{in.Endpoint},
+			MountOptions: in.MountOpts,
+		}
+	}
+	if in.Transition != nil {
+		out.Transition = &networkfsv2.NetworkFSTransition{
+			DesiredState: networkfsv2.NetworkFSState(in.Transition.DesiredState),
+			StartTime:    in.Transition.StartTime,
+		}
+	}
+	for _, consumer := range in.Consumers {
+		out.Consumers = append(out.Consumers, networkfsv2.NetworkFSConsumer(consumer))
+	}
+	return out
+}
+
+func convertStatusFrom(in *networkfsv2.NetworkFSStatus, protocol networkfsv2.NetworkFSProtocol) networkfsv1.NetworkFSStatus {
+	out := networkfsv1.NetworkFSStatus{
+		ObservedGeneration: in.ObservedGeneration,
+		State:              networkfsv1.NetworkFSState(in.State),
+		Type:               networkfsv1.NetworkFSTypeNFS,
+		Status:             endpointStatus(in.State),
+		PersistentVolume:   in.PersistentVolume,
+		Volume:             in.Volume,
+	}
+	if protocol != "" {
+		out.Type = string(protocol)
+	}
+	for _, cond := range in.NetworkFSConds {
+		out.NetworkFSConds = append(out.NetworkFSConds, networkfsv1.NetworkFSCondition{
+			Type:               networkfsv1.ConditionType(cond.Type),
+			Status:             cond.Status,
+			LastTransitionTime: cond.LastTransitionTime,
+			Reason:             cond.Reason,
+			Message:            cond.Message,
+		})
+	}
+	if export := in.Export; export != nil {
+		if len(export.Addresses) > 0 {
+			out.Endpoint = export.Addresses[0]
+		}
+		out.MountOpts = export.MountOptions
+		if export.Port != 0 || export.ExportPath != "" {
+			out.Export = &networkfsv1.NetworkFSExport{
+				Addresses:   append([]string(nil), export.Addresses...),
+				Port:        export.Port,
+				Protocol:    export.Protocol,
+				ExportPath:  export.ExportPath,
+				NFSVersions: append([]string(nil), export.NFSVersions...),
+				MountSource: export.MountSource,
+			}
+		}
+	}
+	if in.Transition != nil {
+		out.Transition = &networkfsv1.NetworkFSTransition{
+			DesiredState: networkfsv1.NetworkFSState(in.Transition.DesiredState),
+			StartTime:    in.Transition.StartTime,
+		}
+	}
+	for _, consumer := range in.Consumers {
+		out.Consumers = append(out.Consumers, networkfsv1.NetworkFSConsumer(consumer))
+	}
+	return out
+}
+
+// v1beta2OnlyStatus returns the status fields v1beta1 cannot represent, nil if there is none
+func v1beta2OnlyStatus(in *networkfsv2.NetworkFSStatus) *networkfsv2.NetworkFSStatus {
+	out := &networkfsv2.NetworkFSStatus{}
+	copyV1beta2OnlyStatus(out, in)
+	if reflect.DeepEqual(out, &networkfsv2.NetworkFSStatus{}) {
+		return nil
+	}
+	return out
+}
+
+// copyV1beta2OnlyStatus copies the status fields v1beta1 cannot represent
+func copyV1beta2OnlyStatus(out, in *networkfsv2.NetworkFSStatus) {
+	out.DesiredState = in.DesiredState
+	out.DesiredStateReason = in.DesiredStateReason
+	out.AutoDisableTime = in.AutoDisableTime.DeepCopy()
+	out.Lease = in.Lease.DeepCopy()
+	out.Schedule = in.Schedule.DeepCopy()
+	out.Idle = in.Idle.DeepCopy()
+	out.Placement = in.Placement.DeepCopy()
+	out.Binding = in.Binding.DeepCopy()
+	out.AccessPolicy = in.AccessPolicy.DeepCopy()
+	out.Expose = in.Expose.DeepCopy()
+}
+
+// endpointStatus returns the v1beta1 endpoint status of the state
+func endpointStatus(state networkfsv2.NetworkFSState) networkfsv1.EndpointStatus {
+	switch state {
+	case networkfsv2.NetworkFSStateEnabled:
+		return networkfsv1.EndpointStatusReady
+	case networkfsv2.NetworkFSStateDisabling:
+		return networkfsv1.EndpointStatusReconciling
+	case networkfsv2.NetworkFSStateUnknown:
+		return networkfsv1.EndpointStatusUnknown
+	}
+	return networkfsv1.EndpointStatusNotReady
+}
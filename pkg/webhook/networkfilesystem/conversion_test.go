@@ -0,0 +1,258 @@
+package networkfilesystem
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networkfsv1 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta1"
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+)
+
+var conversionTime = metav1.NewTime(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+
+func v1beta1NetworkFS() *networkfsv1.NetworkFilesystem {
+	return &networkfsv1.NetworkFilesystem{
+		TypeMeta:   metav1.TypeMeta{APIVersion: networkfsv1.SchemeGroupVersion.String(), Kind: "NetworkFilesystem"},
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-1", Namespace: "harvester-system", Generation: 2},
+		Spec: networkfsv1.NetworkFSSpec{
+			VolumeRef:         &networkfsv1.NetworkFSVolumeRef{PersistentVolumeClaim: &networkfsv1.NetworkFSClaimRef{Namespace: "default", Name: "data"}},
+			DesiredState:      networkfsv1.NetworkFSStateEnabled,
+			PreferredNode:     "node-1",
+			TransitionTimeout: &metav1.Duration{Duration: time.Minute},
+		},
+		Status: networkfsv1.NetworkFSStatus{
+			ObservedGeneration: 2,
+			NetworkFSConds: []networkfsv1.NetworkFSCondition{{
+				Type:               networkfsv1.ConditionType(networkfsv2.ConditionTypeReady),
+				Status:             corev1.ConditionTrue,
+				LastTransitionTime: conversionTime,
+				Reason:             "Export is ready",
+			}},
+			Endpoint:  "10.52.0.10",
+			State:     networkfsv1.NetworkFSStateEnabled,
+			Type:      networkfsv1.NetworkFSTypeNFS,
+			Status:    networkfsv1.EndpointStatusReady,
+			MountOpts: "vers=4.1",
+			Export: &networkfsv1.NetworkFSExport{
+				Addresses:   []string{"10.52.0.10"},
+				Port:        2049,
+				Protocol:    corev1.ProtocolTCP,
+				ExportPath:  "/pvc-1",
+				NFSVersions: []string{"4.1", "4.2"},
+				MountSource: "10.52.0.10:/pvc-1",
+			},
+			PersistentVolume: "pvc-1",
+			Volume:           "pvc-1",
+			Consumers:        []networkfsv1.NetworkFSConsumer{{Kind: networkfsv2.ConsumerKindPod, Namespace: "default", Name: "app", NodeName: "node-1"}},
+		},
+	}
+}
+
+func v1beta2NetworkFS() *networkfsv2.NetworkFilesystem {
+	return &networkfsv2.NetworkFilesystem{
+		TypeMeta:   metav1.TypeMeta{APIVersion: networkfsv2.SchemeGroupVersion.String(), Kind: "NetworkFilesystem"},
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-1", Namespace: "harvester-system", Generation: 3},
+		Spec: networkfsv2.NetworkFSSpec{
+			VolumeRef:      networkfsv2.NetworkFSVolumeRef{VolumeName: "pvc-1"},
+			DesiredState:   networkfsv2.NetworkFSStateDisabled,
+			PreferredNodes: []string{"node-1", "node-2"},
+			Protocol:       networkfsv2.NetworkFSProtocolNFS,
+			Consumers:      nil,
+			Lease:          &networkfsv2.NetworkFSLease{Duration: metav1.Duration{Duration: time.Hour}, RenewTime: &conversionTime},
+			IdleTimeout:    &metav1.Duration{Duration: time.Hour},
+		},
+		Status: networkfsv2.NetworkFSStatus{
+			ObservedGeneration: 3,
+			State:              networkfsv2.NetworkFSStateEnabled,
+			DesiredState:       networkfsv2.NetworkFSStateEnabled,
+			DesiredStateReason: networkfsv2.DesiredStateReasonGracePeriod,
+			AutoDisableTime:    &conversionTime,
+			Lease:              &networkfsv2.NetworkFSLeaseStatus{ExpireTime: conversionTime, Remaining: metav1.Duration{Duration: time.Hour}},
+			Idle:               &networkfsv2.NetworkFSIdleStatus{LastActivityTime: &conversionTime},
+			Placement:          &networkfsv2.NetworkFSPlacementStatus{Node: "node-2", Reason: networkfsv2.PlacementReasonFallback},
+			Binding:            &corev1.LocalObjectReference{Name: "networkfs-pvc-1"},
+			Export: &networkfsv2.NetworkFSExport{
+				Addresses:    []string{"10.52.0.10"},
+				Port:         2049,
+				Protocol:     corev1.ProtocolTCP,
+				ExportPath:   "/pvc-1",
+				NFSVersions:  []string{"4.1", "4.2"},
+				MountSource:  "10.52.0.10:/pvc-1",
+				MountOptions: "vers=4.1",
+			},
+			Volume: "pvc-1",
+		},
+	}
+}
+
+func TestConvertV1beta1RoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(networkFS *networkfsv1.NetworkFilesystem)
+	}{
+		{
+			name:   "volume reference and preferred node",
+			mutate: func(*networkfsv1.NetworkFilesystem) {},
+		},
+		{
+			name: "deprecated networkFSName",
+			mutate: func(networkFS *networkfsv1.NetworkFilesystem) {
+				networkFS.Spec.VolumeRef = nil
+				networkFS.Spec.NetworkFSName = "pvc-1"
+			},
+		},
+		{
+			name: "no preferred node",
+			mutate: func(networkFS *networkfsv1.NetworkFilesystem) {
+				networkFS.Spec.PreferredNode = ""
+			},
+		},
+		{
+			name: "disabled without an endpoint",
+			mutate: func(networkFS *networkfsv1.NetworkFilesystem) {
+				networkFS.Status.State = networkfsv1.NetworkFSStateDisabled
+				networkFS.Status.Status = networkfsv1.EndpointStatusNotReady
+				networkFS.Status.Endpoint = ""
+				networkFS.Status.MountOpts = ""
+				networkFS.Status.Export = nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := v1beta1NetworkFS()
+			tt.mutate(in)
+
+			v2 := &networkfsv2.NetworkFilesystem{}
+			if err := convertToV1beta2(in.DeepCopy(), v2); err != nil {
+				t.Fatalf("failed to convert to v1beta2: %v", err)
+			}
+			if in.Spec.PreferredNode != "" && !reflect.DeepEqual(v2.Spec.PreferredNodes, []string{in.Spec.PreferredNode}) {
+				t.Errorf("preferredNodes = %v, want [%s]", v2.Spec.PreferredNodes, in.Spec.PreferredNode)
+			}
+			if in.Status.Endpoint != "" && (v2.Status.Export == nil || v2.Status.Export.Addresses[0] != in.Status.Endpoint) {
+				t.Errorf("export = %+v, want the endpoint %s", v2.Status.Export, in.Status.Endpoint)
+			}
+
+			out := &networkfsv1.NetworkFilesystem{}
+			if err := convertFromV1beta2(v2, out); err != nil {
+				t.Fatalf("failed to convert from v1beta2: %v", err)
+			}
+			// the v1beta2 status fields are saved, the rest round-trips as is
+			delete(out.Annotations, networkfsv2.AnnotationConversion)
+			if len(out.Annotations) == 0 {
+				out.Annotations = nil
+			}
+			if !equality.Semantic.DeepEqual(in, out) {
+				t.Errorf("round trip mismatch\n got: %+v\nwant: %+v", out, in)
+			}
+		})
+	}
+}
+
+func TestConvertLegacyEndpoint(t *testing.T) {
+	in := v1beta1NetworkFS()
+	in.Status.Export = nil
+
+	v2 := &networkfsv2.NetworkFilesystem{}
+	if err := convertToV1beta2(in, v2); err != nil {
+		t.Fatalf("failed to convert to v1beta2: %v", err)
+	}
+	want := &networkfsv2.NetworkFSExport{Addresses: []string{"10.52.0.10"}, MountOptions: "vers=4.1"}
+	if !reflect.DeepEqual(v2.Status.Export, want) {
+		t.Errorf("export = %+v, want %+v", v2.Status.Export, want)
+	}
+
+	out := &networkfsv1.NetworkFilesystem{}
+	if err := convertFromV1beta2(v2, out); err != nil {
+		t.Fatalf("failed to convert from v1beta2: %v", err)
+	}
+	if out.Status.Endpoint != in.Status.Endpoint || out.Status.MountOpts != in.Status.MountOpts || out.Status.Export != nil {
+		t.Errorf("endpoint = %q, mountOpts = %q, export = %+v, want %q, %q and no export", out.Status.Endpoint, out.Status.MountOpts, out.Status.Export, in.Status.Endpoint, in.Status.MountOpts)
+	}
+}
+
+func TestConvertV1beta2RoundTrip(t *testing.T) {
+	in := v1beta2NetworkFS()
+
+	v1 := &networkfsv1.NetworkFilesystem{}
+	if err := convertFromV1beta2(in.DeepCopy(), v1); err != nil {
+		t.Fatalf("failed to convert to v1beta1: %v", err)
+	}
+	if v1.Spec.PreferredNode != "node-1" {
+		t.Errorf("perferredNodes = %q, want node-1", v1.Spec.PreferredNode)
+	}
+	if v1.Status.Type != string(networkfsv2.NetworkFSProtocolNFS) {
+		t.Errorf("type = %q, want %s", v1.Status.Type, networkfsv2.NetworkFSProtocolNFS)
+	}
+	if v1.Status.Endpoint != "10.52.0.10" || v1.Status.Status != networkfsv1.EndpointStatusReady {
+		t.Errorf("endpoint = %q (%s), want 10.52.0.10 (%s)", v1.Status.Endpoint, v1.Status.Status, networkfsv1.EndpointStatusReady)
+	}
+	if _, ok := v1.Annotations[networkfsv2.AnnotationConversion]; !ok {
+		t.Fatalf("annotation %s is not set", networkfsv2.AnnotationConversion)
+	}
+
+	out := &networkfsv2.NetworkFilesystem{}
+	if err := convertToV1beta2(v1, out); err != nil {
+		t.Fatalf("failed to convert from v1beta1: %v", err)
+	}
+	if !equality.Semantic.DeepEqual(in, out) {
+		t.Errorf("round trip mismatch\n got: %+v\nwant: %+v", out, in)
+	}
+}
+
+// TestConvertV1beta1StatusUpdate checks the status written through v1beta1 keeps the v1beta2 status fields,
+// the timers of the effective desired state are read back by the controller
+func TestConvertV1beta1StatusUpdate(t *testing.T) {
+	in := v1beta2NetworkFS()
+
+	v1 := &networkfsv1.NetworkFilesystem{}
+	if err := convertFromV1beta2(in.DeepCopy(), v1); err != nil {
+		t.Fatalf("failed to convert to v1beta1: %v", err)
+	}
+	v1.Status.State = networkfsv1.NetworkFSStateDisabling
+	v1.Status.ObservedGeneration = 4
+
+	out := &networkfsv2.NetworkFilesystem{}
+	if err := convertToV1beta2(v1, out); err != nil {
+		t.Fatalf("failed to convert from v1beta1: %v", err)
+	}
+	if out.Status.State != networkfsv2.NetworkFSStateDisabling || out.Status.ObservedGeneration != 4 {
+		t.Errorf("state = %s, observedGeneration = %d, want the v1beta1 update", out.Status.State, out.Status.ObservedGeneration)
+	}
+	want := v1beta2OnlyStatus(&in.Status)
+	if got := v1beta2OnlyStatus(&out.Status); !equality.Semantic.DeepEqual(got, want) {
+		t.Errorf("v1beta2 status = %+v, want %+v", got, want)
+	}
+}
+
+// TestConvertLegacyAnnotation checks the annotation holding only the v1beta2 spec, as written before the status was
+// saved, still decodes
+func TestConvertLegacyAnnotation(t *testing.T) {
+	spec := v1beta2NetworkFS().Spec
+	value, err := json.Marshal(&spec)
+	if err != nil {
+		t.Fatalf("failed to marshal the spec: %v", err)
+	}
+	in := v1beta1NetworkFS()
+	in.Spec.PreferredNode = "node-1"
+	in.Spec.DesiredState = networkfsv1.NetworkFSStateDisabled
+	in.Spec.VolumeRef = &networkfsv1.NetworkFSVolumeRef{VolumeName: "pvc-1"}
+	in.Spec.TransitionTimeout = nil
+	in.Annotations = map[string]string{networkfsv2.AnnotationConversion: string(value)}
+
+	out := &networkfsv2.NetworkFilesystem{}
+	if err := convertToV1beta2(in, out); err != nil {
+		t.Fatalf("failed to convert to v1beta2: %v", err)
+	}
+	if !equality.Semantic.DeepEqual(out.Spec, spec) {
+		t.Errorf("spec = %+v, want %+v", out.Spec, spec)
+	}
+}
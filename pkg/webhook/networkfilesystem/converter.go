@@ -0,0 +1,100 @@
+package networkfilesystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	networkfsv1 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta1"
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+)
+
+// Converter serves the conversion webhook of the NetworkFilesystem CRD, between v1beta1 and v1beta2
+type Converter struct{}
+
+func NewConverter() *Converter {
+	return &Converter{}
+}
+
+// ServeHTTP implements http.Handler
+func (c *Converter) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	review := &apiextensionsv1.ConversionReview{}
+	if err := json.NewDecoder(req.Body).Decode(review); err != nil {
+		http.Error(rw, fmt.Sprintf("failed to decode the conversion review: %v", err), http.StatusBadRequest)
+		return
+	}
+	if review.Request == nil {
+		http.Error(rw, "conversion review has no request", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = convertReview(review.Request)
+	review.Request = nil
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(review); err != nil {
+		logrus.Errorf("Failed to write the conversion review: %v", err)
+	}
+}
+
+func convertReview(req *apiextensionsv1.ConversionRequest) *apiextensionsv1.ConversionResponse {
+	resp := &apiextensionsv1.ConversionResponse{
+		UID:    req.UID,
+		Result: metav1.Status{Status: metav1.StatusSuccess},
+	}
+	for _, obj := range req.Objects {
+		converted, err := convert(obj.Raw, req.DesiredAPIVersion)
+		if err != nil {
+			logrus.Errorf("Failed to convert the network filesystem to %s: %v", req.DesiredAPIVersion, err)
+			resp.ConvertedObjects = nil
+			resp.Result = metav1.Status{
+				Status:  metav1.StatusFailure,
+				Message: err.Error(),
+			}
+			return resp
+		}
+		resp.ConvertedObjects = append(resp.ConvertedObjects, runtime.RawExtension{Raw: converted})
+	}
+	return resp
+}
+
+// convert converts the raw NetworkFilesystem to the desired API version
+func convert(raw []byte, desiredAPIVersion string) ([]byte, error) {
+	typeMeta := &metav1.TypeMeta{}
+	if err := json.Unmarshal(raw, typeMeta); err != nil {
+		return nil, err
+	}
+	if typeMeta.APIVersion == desiredAPIVersion {
+		return raw, nil
+	}
+
+	v1beta1 := networkfsv1.SchemeGroupVersion.String()
+	v1beta2 := networkfsv2.SchemeGroupVersion.String()
+	switch {
+	case typeMeta.APIVersion == v1beta1 && desiredAPIVersion == v1beta2:
+		in := &networkfsv1.NetworkFilesystem{}
+		if err := json.Unmarshal(raw, in); err != nil {
+			return nil, err
+		}
+		out := &networkfsv2.NetworkFilesystem{}
+		if err := convertToV1beta2(in, out); err != nil {
+			return nil, err
+		}
+		return json.Marshal(out)
+	case typeMeta.APIVersion == v1beta2 && desiredAPIVersion == v1beta1:
+		in := &networkfsv2.NetworkFilesystem{}
+		if err := json.Unmarshal(raw, in); err != nil {
+			return nil, err
+		}
+		out := &networkfsv1.NetworkFilesystem{}
+		if err := convertFromV1beta2(in, out); err != nil {
+			return nil, err
+		}
+		return json.Marshal(out)
+	}
+	return nil, fmt.Errorf("unsupported conversion from %s to %s", typeMeta.APIVersion, desiredAPIVersion)
+}
@@ -0,0 +1,405 @@
+package networkfilesystem
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+
+	longhornv2 "github.com/longhorn/longhorn-manager/k8s/pkg/apis/longhorn/v1beta2"
+	ctlv1 "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/v3/pkg/webhook"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/harvester/networkfs-manager/pkg/activity"
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	ctllonghornv1 "github.com/harvester/networkfs-manager/pkg/generated/controllers/longhorn.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/schedule"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+// Validator validates the NetworkFilesystem on create and update
+type Validator struct {
+	pvcs    ctlv1.PersistentVolumeClaimClient
+	pvs     ctlv1.PersistentVolumeClient
+	volumes ctllonghornv1.VolumeClient
+	nodes   ctllonghornv1.NodeClient
+}
+
+func NewValidator(pvcs ctlv1.PersistentVolumeClaimClient, pvs ctlv1.PersistentVolumeClient, volumes ctllonghornv1.VolumeClient, nodes ctllonghornv1.NodeClient) *Validator {
+	return &Validator{
+		pvcs:    pvcs,
+		pvs:     pvs,
+		volumes: volumes,
+		nodes:   nodes,
+	}
+}
+
+// Register routes the NetworkFilesystem admission requests to the validator
+func Register(router *webhook.Router, validator *Validator) {
+	router.Kind("NetworkFilesystem").Group(networkfsv2.SchemeGroupVersion.Group).Type(&networkfsv2.NetworkFilesystem{}).Handle(validator)
+}
+
+// Admit implements webhook.Handler
+func (v *Validator) Admit(resp *webhook.Response, req *webhook.Request) error {
+	obj, err := req.DecodeObject()
+	if err != nil {
+		return err
+	}
+	networkFS := obj.(*networkfsv2.NetworkFilesystem)
+
+	switch req.Operation {
+	case admissionv1.Create:
+		err = v.validateCreate(networkFS)
+	case admissionv1.Update:
+		oldObj, decodeErr := req.DecodeOldObject()
+		if decodeErr != nil {
+			return decodeErr
+		}
+		err = v.validateUpdate(oldObj.(*networkfsv2.NetworkFilesystem), networkFS)
+	}
+
+	if err != nil {
+		resp.Allowed = false
+		resp.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: err.Error(),
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+		}
+		return nil
+	}
+	resp.Allowed = true
+	return nil
+}
+
+func (v *Validator) validateCreate(networkFS *networkfsv2.NetworkFilesystem) error {
+	if err := validateDesiredState(networkFS); err != nil {
+		return err
+	}
+	if err := validateTransitionTimeout(networkFS); err != nil {
+		return err
+	}
+	if err := v.validateVolume(networkFS); err != nil {
+		return err
+	}
+	if err := validateExpose(networkFS); err != nil {
+		return err
+	}
+	if err := validateAccessPolicy(networkFS); err != nil {
+		return err
+	}
+	if err := validateBinding(networkFS); err != nil {
+		return err
+	}
+	if err := validateConsumers(networkFS); err != nil {
+		return err
+	}
+	if err := validateLease(networkFS); err != nil {
+		return err
+	}
+	if err := validateSchedule(networkFS); err != nil {
+		return err
+	}
+	if err := validateIdleTimeout(networkFS); err != nil {
+		return err
+	}
+	if err := validateNodeSelector(networkFS); err != nil {
+		return err
+	}
+	return v.validatePreferredNodes(networkFS)
+}
+
+// validateUpdate only checks the changed fields, so the existing objects can always be updated (e.g. the finalizers)
+func (v *Validator) validateUpdate(oldNetworkFS, networkFS *networkfsv2.NetworkFilesystem) error {
+	if networkFS.DeletionTimestamp != nil {
+		return nil
+	}
+	if !reflect.DeepEqual(oldNetworkFS.Spec.VolumeRef, networkFS.Spec.VolumeRef) {
+		return fmt.Errorf("spec.volumeRef is immutable")
+	}
+	if oldNetworkFS.Spec.DesiredState != networkFS.Spec.DesiredState {
+		if err := validateDesiredState(networkFS); err != nil {
+			return err
+		}
+	}
+	if !reflect.DeepEqual(oldNetworkFS.Spec.TransitionTimeout, networkFS.Spec.TransitionTimeout) {
+		if err := validateTransitionTimeout(networkFS); err != nil {
+			return err
+		}
+	}
+	if !reflect.DeepEqual(oldNetworkFS.Spec.Expose, networkFS.Spec.Expose) {
+		if err := validateExpose(networkFS); err != nil {
+			return err
+		}
+	}
+	if !reflect.DeepEqual(oldNetworkFS.Spec.AccessPolicy, networkFS.Spec.AccessPolicy) {
+		if err := validateAccessPolicy(networkFS); err != nil {
+			return err
+		}
+	}
+	if !reflect.DeepEqual(oldNetworkFS.Spec.Binding, networkFS.Spec.Binding) {
+		if err := validateBinding(networkFS); err != nil {
+			return err
+		}
+	}
+	if !reflect.DeepEqual(oldNetworkFS.Spec.Consumers, networkFS.Spec.Consumers) ||
+		!reflect.DeepEqual(oldNetworkFS.Spec.ConsumerGracePeriod, networkFS.Spec.ConsumerGracePeriod) {
+		if err := validateConsumers(networkFS); err != nil {
+			return err
+		}
+	}
+	if !reflect.DeepEqual(oldNetworkFS.Spec.Lease, networkFS.Spec.Lease) {
+		if err := validateLease(networkFS); err != nil {
+			return err
+		}
+	}
+	if !reflect.DeepEqual(oldNetworkFS.Spec.Schedule, networkFS.Spec.Schedule) {
+		if err := validateSchedule(networkFS); err != nil {
+			return err
+		}
+	}
+	if !reflect.DeepEqual(oldNetworkFS.Spec.IdleTimeout, networkFS.Spec.IdleTimeout) {
+		if err := validateIdleTimeout(networkFS); err != nil {
+			return err
+		}
+	}
+	if !reflect.DeepEqual(oldNetworkFS.Spec.NodeSelector, networkFS.Spec.NodeSelector) {
+		if err := validateNodeSelector(networkFS); err != nil {
+			return err
+		}
+	}
+	if !reflect.DeepEqual(oldNetworkFS.Spec.PreferredNodes, networkFS.Spec.PreferredNodes) {
+		if err := v.validatePreferredNodes(networkFS); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateDesiredState(networkFS *networkfsv2.NetworkFilesystem) error {
+	switch networkFS.Spec.DesiredState {
+	case networkfsv2.NetworkFSStateEnabled, networkfsv2.NetworkFSStateDisabled:
+		return nil
+	}
+	return fmt.Errorf("invalid spec.desiredState %q, options are %q or %q", networkFS.Spec.DesiredState, networkfsv2.NetworkFSStateEnabled, networkfsv2.NetworkFSStateDisabled)
+}
+
+func validateTransitionTimeout(networkFS *networkfsv2.NetworkFilesystem) error {
+	if timeout := networkFS.Spec.TransitionTimeout; timeout != nil && timeout.Duration < 0 {
+		return fmt.Errorf("invalid spec.transitionTimeout %s, it cannot be negative", timeout.Duration)
+	}
+	return nil
+}
+
+// validateConsumers checks the registered consumers are named and unique, the kinds of the in-cluster consumers are
+// reserved so they can be told apart in the status
+func validateConsumers(networkFS *networkfsv2.NetworkFilesystem) error {
+	if period := networkFS.Spec.ConsumerGracePeriod; period != nil && period.Duration < 0 {
+		return fmt.Errorf("invalid spec.consumerGracePeriod %s, it cannot be negative", period.Duration)
+	}
+	registered := map[networkfsv2.NetworkFSConsumer]int{}
+	for i, consumer := range networkFS.Spec.Consumers {
+		if consumer.Kind == "" || consumer.Name == "" {
+			return fmt.Errorf("invalid spec.consumers[%d], the kind and the name are required", i)
+		}
+		if consumer.Kind == networkfsv2.ConsumerKindPod || consumer.Kind == networkfsv2.ConsumerKindAttachmentTicket {
+			return fmt.Errorf("invalid spec.consumers[%d], kind %q is reserved for the in-cluster consumers", i, consumer.Kind)
+		}
+		key := networkfsv2.NetworkFSConsumer{Kind: consumer.Kind, Namespace: consumer.Namespace, Name: consumer.Name}
+		if j, found := registered[key]; found {
+			return fmt.Errorf("spec.consumers[%d] is registered twice, see spec.consumers[%d]", i, j)
+		}
+		registered[key] = i
+	}
+	return nil
+}
+
+func validateLease(networkFS *networkfsv2.NetworkFilesystem) error {
+	if lease := networkFS.Spec.Lease; lease != nil && lease.Duration.Duration <= 0 {
+		return fmt.Errorf("invalid spec.lease.duration %s, it must be positive", lease.Duration.Duration)
+	}
+	return nil
+}
+
+func validateSchedule(networkFS *networkfsv2.NetworkFilesystem) error {
+	if networkFS.Spec.Schedule == nil {
+		return nil
+	}
+	if _, err := schedule.Parse(networkFS.Spec.Schedule); err != nil {
+		return fmt.Errorf("invalid spec.schedule: %w", err)
+	}
+	return nil
+}
+
+// validateIdleTimeout checks the idle timeout outlasts the throttled updates of the last activity
+func validateIdleTimeout(networkFS *networkfsv2.NetworkFilesystem) error {
+	if timeout := networkFS.Spec.IdleTimeout; timeout != nil && timeout.Duration < activity.MinIdleTimeout {
+		return fmt.Errorf("invalid spec.idleTimeout %s, it cannot be less than %s", timeout.Duration, activity.MinIdleTimeout)
+	}
+	return nil
+}
+
+// validateExpose checks the Service exposing the network filesystem can be named after it, and the fixed IP is valid
+func validateExpose(networkFS *networkfsv2.NetworkFilesystem) error {
+	expose := networkFS.Spec.Expose
+	if expose == nil {
+		return nil
+	}
+	switch expose.Type {
+	case corev1.ServiceTypeClusterIP, corev1.ServiceTypeNodePort, corev1.ServiceTypeLoadBalancer:
+	default:
+		return fmt.Errorf("invalid spec.expose.type %q, options are %q, %q or %q", expose.Type,
+			corev1.ServiceTypeClusterIP, corev1.ServiceTypeNodePort, corev1.ServiceTypeLoadBalancer)
+	}
+	if expose.IP != "" && net.ParseIP(expose.IP) == nil {
+		return fmt.Errorf("invalid spec.expose.ip %q, it is not an IP address", expose.IP)
+	}
+	serviceName := utils.NetworkFSObjectName(networkFS.Name)
+	if errs := validation.IsDNS1035Label(serviceName); len(errs) > 0 {
+		return fmt.Errorf("network filesystem %s cannot be exposed, service name %s is invalid: %s", networkFS.Name, serviceName, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// validateAccessPolicy checks the allowed CIDRs are valid and do not overlap each other
+func validateAccessPolicy(networkFS *networkfsv2.NetworkFilesystem) error {
+	if networkFS.Spec.AccessPolicy == nil {
+		return nil
+	}
+	networks := make([]*net.IPNet, 0, len(networkFS.Spec.AccessPolicy.AllowedCIDRs))
+	for i, cidr := range networkFS.Spec.AccessPolicy.AllowedCIDRs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid spec.accessPolicy.allowedCIDRs[%d] %q: %v", i, cidr, err)
+		}
+		for j, other := range networks {
+			if network.Contains(other.IP) || other.Contains(network.IP) {
+				return fmt.Errorf("spec.accessPolicy.allowedCIDRs[%d] %s overlaps with spec.accessPolicy.allowedCIDRs[%d] %s",
+					i, cidr, j, networkFS.Spec.AccessPolicy.AllowedCIDRs[j])
+			}
+		}
+		networks = append(networks, network)
+	}
+	return nil
+}
+
+// validateBinding checks the mount point of the binding is a clean absolute path other than the root
+func validateBinding(networkFS *networkfsv2.NetworkFilesystem) error {
+	if networkFS.Spec.Binding == nil || networkFS.Spec.Binding.MountPoint == "" {
+		return nil
+	}
+	mountPoint := networkFS.Spec.Binding.MountPoint
+	if !path.IsAbs(mountPoint) || path.Clean(mountPoint) != mountPoint || mountPoint == "/" {
+		return fmt.Errorf("invalid spec.binding.mountPoint %q, it must be a clean absolute path other than /", mountPoint)
+	}
+	return nil
+}
+
+// validateVolume checks the network filesystem refers to exactly one volume, either a PVC or a Longhorn RWX volume
+func (v *Validator) validateVolume(networkFS *networkfsv2.NetworkFilesystem) error {
+	ref := networkFS.Spec.VolumeRef
+	if (ref.VolumeName == "") == (ref.PersistentVolumeClaim == nil) {
+		return fmt.Errorf("exactly one of spec.volumeRef.volumeName or spec.volumeRef.persistentVolumeClaim must be set")
+	}
+
+	if ref.VolumeName != "" {
+		return v.validateLonghornVolume("spec.volumeRef.volumeName", ref.VolumeName)
+	}
+	return v.validateClaim(ref.PersistentVolumeClaim)
+}
+
+// validateLonghornVolume checks the name refers to an existing Longhorn RWX volume
+func (v *Validator) validateLonghornVolume(field, name string) error {
+	volume, err := v.volumes.Get(utils.LHNameSpace, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("%s %s does not match any Longhorn volume", field, name)
+		}
+		return err
+	}
+	if volume.Spec.AccessMode != longhornv2.AccessModeReadWriteMany {
+		return fmt.Errorf("%s %s is not a Longhorn RWX volume, access mode is %s", field, name, volume.Spec.AccessMode)
+	}
+	return nil
+}
+
+// validateClaim checks the PVC is an RWX claim, and a Longhorn RWX volume is behind it once it is bound
+func (v *Validator) validateClaim(ref *networkfsv2.NetworkFSClaimRef) error {
+	if ref.Namespace == "" || ref.Name == "" {
+		return fmt.Errorf("spec.volumeRef.persistentVolumeClaim requires both namespace and name")
+	}
+	pvc, err := v.pvcs.Get(ref.Namespace, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("spec.volumeRef.persistentVolumeClaim %s/%s is not found", ref.Namespace, ref.Name)
+		}
+		return err
+	}
+	rwx := false
+	for _, mode := range pvc.Spec.AccessModes {
+		if mode == corev1.ReadWriteMany {
+			rwx = true
+			break
+		}
+	}
+	if !rwx {
+		return fmt.Errorf("spec.volumeRef.persistentVolumeClaim %s/%s is not a ReadWriteMany claim", ref.Namespace, ref.Name)
+	}
+	if pvc.Spec.VolumeName == "" {
+		// not bound yet, the controller resolves it later
+		return nil
+	}
+
+	pv, err := v.pvs.Get(pvc.Spec.VolumeName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != utils.LHCSIDriverName {
+		return fmt.Errorf("spec.volumeRef.persistentVolumeClaim %s/%s is not bound to a Longhorn volume", ref.Namespace, ref.Name)
+	}
+	return v.validateLonghornVolume("spec.volumeRef.persistentVolumeClaim", pv.Spec.CSI.VolumeHandle)
+}
+
+func validateNodeSelector(networkFS *networkfsv2.NetworkFilesystem) error {
+	if networkFS.Spec.NodeSelector == nil {
+		return nil
+	}
+	if _, err := metav1.LabelSelectorAsSelector(networkFS.Spec.NodeSelector); err != nil {
+		return fmt.Errorf("invalid spec.nodeSelector: %w", err)
+	}
+	return nil
+}
+
+// validatePreferredNodes checks the preferred nodes are distinct schedulable Longhorn nodes
+func (v *Validator) validatePreferredNodes(networkFS *networkfsv2.NetworkFilesystem) error {
+	seen := map[string]bool{}
+	for i, nodeName := range networkFS.Spec.PreferredNodes {
+		field := fmt.Sprintf("spec.preferredNodes[%d]", i)
+		if seen[nodeName] {
+			return fmt.Errorf("%s %s is duplicated", field, nodeName)
+		}
+		seen[nodeName] = true
+
+		node, err := v.nodes.Get(utils.LHNameSpace, nodeName, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return fmt.Errorf("%s %s is not a Longhorn node", field, nodeName)
+			}
+			return err
+		}
+		if !node.Spec.AllowScheduling {
+			return fmt.Errorf("%s %s is not a schedulable Longhorn node", field, nodeName)
+		}
+	}
+	return nil
+}
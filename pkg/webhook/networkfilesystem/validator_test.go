@@ -0,0 +1,313 @@
+package networkfilesystem
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	longhornv2 "github.com/longhorn/longhorn-manager/k8s/pkg/apis/longhorn/v1beta2"
+	"github.com/rancher/wrangler/v3/pkg/generic"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+// fakeClient serves Get from the objects keyed by namespace/name, the validator calls nothing else
+type fakeClient[T generic.RuntimeMetaObject, TList runtime.Object] struct {
+	generic.ClientInterface[T, TList]
+	resource schema.GroupResource
+	objects  map[string]T
+}
+
+func (c *fakeClient[T, TList]) Get(namespace, name string, _ metav1.GetOptions) (T, error) {
+	if obj, ok := c.objects[namespace+"/"+name]; ok {
+		return obj, nil
+	}
+	var none T
+	return none, apierrors.NewNotFound(c.resource, name)
+}
+
+func newTestValidator() *Validator {
+	volume := func(name string, mode longhornv2.AccessMode) *longhornv2.Volume {
+		return &longhornv2.Volume{
+			ObjectMeta: metav1.ObjectMeta{Namespace: utils.LHNameSpace, Name: name},
+			Spec:       longhornv2.VolumeSpec{AccessMode: mode},
+		}
+	}
+	node := func(name string, allowScheduling bool) *longhornv2.Node {
+		return &longhornv2.Node{
+			ObjectMeta: metav1.ObjectMeta{Namespace: utils.LHNameSpace, Name: name},
+			Spec:       longhornv2.NodeSpec{AllowScheduling: allowScheduling},
+		}
+	}
+	claim := func(name string, mode corev1.PersistentVolumeAccessMode) *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec:       corev1.PersistentVolumeClaimSpec{AccessModes: []corev1.PersistentVolumeAccessMode{mode}},
+		}
+	}
+
+	return &Validator{
+		pvcs: &fakeClient[*corev1.PersistentVolumeClaim, *corev1.PersistentVolumeClaimList]{
+			resource: corev1.Resource("persistentvolumeclaims"),
+			objects: map[string]*corev1.PersistentVolumeClaim{
+				"default/shared":  claim("shared", corev1.ReadWriteMany),
+				"default/private": claim("private", corev1.ReadWriteOnce),
+			},
+		},
+		volumes: &fakeClient[*longhornv2.Volume, *longhornv2.VolumeList]{
+			resource: longhornv2.Resource("volumes"),
+			objects: map[string]*longhornv2.Volume{
+				utils.LHNameSpace + "/pvc-1": volume("pvc-1", longhornv2.AccessModeReadWriteMany),
+				utils.LHNameSpace + "/pvc-2": volume("pvc-2", longhornv2.AccessModeReadWriteOnce),
+			},
+		},
+		nodes: &fakeClient[*longhornv2.Node, *longhornv2.NodeList]{
+			resource: longhornv2.Resource("nodes"),
+			objects: map[string]*longhornv2.Node{
+				utils.LHNameSpace + "/node-1": node("node-1", true),
+				utils.LHNameSpace + "/node-2": node("node-2", true),
+				utils.LHNameSpace + "/node-3": node("node-3", false),
+			},
+		},
+	}
+}
+
+func validNetworkFS() *networkfsv2.NetworkFilesystem {
+	return &networkfsv2.NetworkFilesystem{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "harvester-system", Name: "pvc-1"},
+		Spec: networkfsv2.NetworkFSSpec{
+			VolumeRef:      networkfsv2.NetworkFSVolumeRef{VolumeName: "pvc-1"},
+			DesiredState:   networkfsv2.NetworkFSStateEnabled,
+			PreferredNodes: []string{"node-1", "node-2"},
+			AccessPolicy:   &networkfsv2.NetworkFSAccessPolicy{AllowedCIDRs: []string{"10.0.0.0/16", "192.168.1.0/24"}},
+		},
+	}
+}
+
+// checkError checks the error mentions want, an empty want expects no error
+func checkError(t *testing.T, err error, want string) {
+	t.Helper()
+	switch {
+	case want == "" && err != nil:
+		t.Errorf("unexpected error: %v", err)
+	case want != "" && err == nil:
+		t.Errorf("no error, want %q", want)
+	case want != "" && !strings.Contains(err.Error(), want):
+		t.Errorf("error = %q, want %q", err, want)
+	}
+}
+
+func TestValidateAccessPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		cidrs   []string
+		wantErr string
+	}{
+		{name: "no CIDRs"},
+		{name: "disjoint CIDRs", cidrs: []string{"10.0.0.0/16", "10.1.0.0/16", "fd00::/64"}},
+		{name: "host address", cidrs: []string{"192.168.1.10/32", "192.168.1.11/32"}},
+		{name: "not a CIDR", cidrs: []string{"10.0.0.0/16", "10.1.0.0"}, wantErr: `allowedCIDRs[1] "10.1.0.0"`},
+		{name: "bad prefix length", cidrs: []string{"10.0.0.0/33"}, wantErr: `allowedCIDRs[0] "10.0.0.0/33"`},
+		{name: "duplicated", cidrs: []string{"10.0.0.0/16", "10.0.0.0/16"}, wantErr: "allowedCIDRs[1] 10.0.0.0/16 overlaps with spec.accessPolicy.allowedCIDRs[0]"},
+		{name: "contained", cidrs: []string{"10.0.0.0/8", "10.1.0.0/16"}, wantErr: "allowedCIDRs[1] 10.1.0.0/16 overlaps"},
+		{name: "containing", cidrs: []string{"10.1.2.0/24", "172.16.0.0/12", "10.0.0.0/8"}, wantErr: "allowedCIDRs[2] 10.0.0.0/8 overlaps with spec.accessPolicy.allowedCIDRs[0]"},
+		{name: "same network with host bits", cidrs: []string{"10.1.2.3/16", "10.1.200.1/24"}, wantErr: "overlaps"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			networkFS := validNetworkFS()
+			networkFS.Spec.AccessPolicy.AllowedCIDRs = tt.cidrs
+			checkError(t, validateAccessPolicy(networkFS), tt.wantErr)
+		})
+	}
+}
+
+func TestValidateCreate(t *testing.T) {
+	validator := newTestValidator()
+
+	tests := []struct {
+		name    string
+		mutate  func(*networkfsv2.NetworkFilesystem)
+		wantErr string
+	}{
+		{name: "valid", mutate: func(*networkfsv2.NetworkFilesystem) {}},
+		{
+			name: "unbound claim is resolved later",
+			mutate: func(networkFS *networkfsv2.NetworkFilesystem) {
+				networkFS.Spec.VolumeRef = networkfsv2.NetworkFSVolumeRef{PersistentVolumeClaim: &networkfsv2.NetworkFSClaimRef{Namespace: "default", Name: "shared"}}
+			},
+		},
+		{
+			name: "both volume references",
+			mutate: func(networkFS *networkfsv2.NetworkFilesystem) {
+				networkFS.Spec.VolumeRef.PersistentVolumeClaim = &networkfsv2.NetworkFSClaimRef{Namespace: "default", Name: "shared"}
+			},
+			wantErr: "exactly one of",
+		},
+		{
+			name: "no volume reference",
+			mutate: func(networkFS *networkfsv2.NetworkFilesystem) {
+				networkFS.Spec.VolumeRef = networkfsv2.NetworkFSVolumeRef{}
+			},
+			wantErr: "exactly one of",
+		},
+		{
+			name:    "unknown volume",
+			mutate:  func(networkFS *networkfsv2.NetworkFilesystem) { networkFS.Spec.VolumeRef.VolumeName = "pvc-9" },
+			wantErr: "does not match any Longhorn volume",
+		},
+		{
+			name:    "RWO volume",
+			mutate:  func(networkFS *networkfsv2.NetworkFilesystem) { networkFS.Spec.VolumeRef.VolumeName = "pvc-2" },
+			wantErr: "is not a Longhorn RWX volume",
+		},
+		{
+			name: "RWO claim",
+			mutate: func(networkFS *networkfsv2.NetworkFilesystem) {
+				networkFS.Spec.VolumeRef = networkfsv2.NetworkFSVolumeRef{PersistentVolumeClaim: &networkfsv2.NetworkFSClaimRef{Namespace: "default", Name: "private"}}
+			},
+			wantErr: "is not a ReadWriteMany claim",
+		},
+		{
+			name: "invalid desired state",
+			mutate: func(networkFS *networkfsv2.NetworkFilesystem) {
+				networkFS.Spec.DesiredState = networkfsv2.NetworkFSStateEnabling
+			},
+			wantErr: "invalid spec.desiredState",
+		},
+		{
+			name: "duplicated preferred node",
+			mutate: func(networkFS *networkfsv2.NetworkFilesystem) {
+				networkFS.Spec.PreferredNodes = []string{"node-1", "node-2", "node-1"}
+			},
+			wantErr: "spec.preferredNodes[2] node-1 is duplicated",
+		},
+		{
+			name: "unknown preferred node",
+			mutate: func(networkFS *networkfsv2.NetworkFilesystem) {
+				networkFS.Spec.PreferredNodes = []string{"node-1", "node-9"}
+			},
+			wantErr: "spec.preferredNodes[1] node-9 is not a Longhorn node",
+		},
+		{
+			name:    "unschedulable preferred node",
+			mutate:  func(networkFS *networkfsv2.NetworkFilesystem) { networkFS.Spec.PreferredNodes = []string{"node-3"} },
+			wantErr: "spec.preferredNodes[0] node-3 is not a schedulable Longhorn node",
+		},
+		{
+			name: "overlapping CIDRs",
+			mutate: func(networkFS *networkfsv2.NetworkFilesystem) {
+				networkFS.Spec.AccessPolicy.AllowedCIDRs = append(networkFS.Spec.AccessPolicy.AllowedCIDRs, "10.0.1.0/24")
+			},
+			wantErr: "overlaps",
+		},
+		{
+			name: "negative transition timeout",
+			mutate: func(networkFS *networkfsv2.NetworkFilesystem) {
+				networkFS.Spec.TransitionTimeout = &metav1.Duration{Duration: -time.Minute}
+			},
+			wantErr: "invalid spec.transitionTimeout",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			networkFS := validNetworkFS()
+			tt.mutate(networkFS)
+			checkError(t, validator.validateCreate(networkFS), tt.wantErr)
+		})
+	}
+}
+
+func TestValidateUpdate(t *testing.T) {
+	validator := newTestValidator()
+	// the object was admitted by a previous version, or its preferred node was removed since
+	stale := validNetworkFS()
+	stale.Spec.PreferredNodes = []string{"node-9"}
+	stale.Spec.AccessPolicy.AllowedCIDRs = []string{"10.0.0.0/8", "10.1.0.0/16"}
+
+	tests := []struct {
+		name    string
+		old     *networkfsv2.NetworkFilesystem
+		mutate  func(*networkfsv2.NetworkFilesystem)
+		wantErr string
+	}{
+		{
+			name:    "volume name is immutable",
+			old:     validNetworkFS(),
+			mutate:  func(networkFS *networkfsv2.NetworkFilesystem) { networkFS.Spec.VolumeRef.VolumeName = "pvc-3" },
+			wantErr: "spec.volumeRef is immutable",
+		},
+		{
+			name: "claim is immutable",
+			old:  validNetworkFS(),
+			mutate: func(networkFS *networkfsv2.NetworkFilesystem) {
+				networkFS.Spec.VolumeRef = networkfsv2.NetworkFSVolumeRef{PersistentVolumeClaim: &networkfsv2.NetworkFSClaimRef{Namespace: "default", Name: "shared"}}
+			},
+			wantErr: "spec.volumeRef is immutable",
+		},
+		{
+			name: "unchanged invalid fields are not checked",
+			old:  stale,
+			mutate: func(networkFS *networkfsv2.NetworkFilesystem) {
+				networkFS.Spec.DesiredState = networkfsv2.NetworkFSStateDisabled
+			},
+		},
+		{
+			name:   "finalizers of an invalid object",
+			old:    stale,
+			mutate: func(networkFS *networkfsv2.NetworkFilesystem) { networkFS.Finalizers = nil },
+		},
+		{
+			name: "changed preferred nodes are checked",
+			old:  stale,
+			mutate: func(networkFS *networkfsv2.NetworkFilesystem) {
+				networkFS.Spec.PreferredNodes = []string{"node-9", "node-8"}
+			},
+			wantErr: "spec.preferredNodes[0] node-9 is not a Longhorn node",
+		},
+		{
+			name:   "fixed preferred nodes",
+			old:    stale,
+			mutate: func(networkFS *networkfsv2.NetworkFilesystem) { networkFS.Spec.PreferredNodes = []string{"node-2"} },
+		},
+		{
+			name: "changed CIDRs are checked",
+			old:  validNetworkFS(),
+			mutate: func(networkFS *networkfsv2.NetworkFilesystem) {
+				networkFS.Spec.AccessPolicy.AllowedCIDRs = []string{"192.168.0.0/16", "192.168.1.0/24"}
+			},
+			wantErr: "allowedCIDRs[1] 192.168.1.0/24 overlaps",
+		},
+		{
+			name:    "invalid desired state",
+			old:     validNetworkFS(),
+			mutate:  func(networkFS *networkfsv2.NetworkFilesystem) { networkFS.Spec.DesiredState = "Paused" },
+			wantErr: "invalid spec.desiredState",
+		},
+		{
+			name: "deleting",
+			old:  validNetworkFS(),
+			mutate: func(networkFS *networkfsv2.NetworkFilesystem) {
+				now := metav1.Now()
+				networkFS.DeletionTimestamp = &now
+				networkFS.Spec.VolumeRef.VolumeName = "pvc-3"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			networkFS := tt.old.DeepCopy()
+			tt.mutate(networkFS)
+			checkError(t, validator.validateUpdate(tt.old, networkFS), tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	ctladmissionregv1 "github.com/rancher/wrangler/v3/pkg/generated/controllers/admissionregistration.k8s.io/v1"
+	ctlapiextv1 "github.com/rancher/wrangler/v3/pkg/generated/controllers/apiextensions.k8s.io/v1"
+	ctlcorev1 "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/v3/pkg/webhook"
+	"github.com/sirupsen/logrus"
+	admissionregv1 "k8s.io/api/admissionregistration/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networkfsv2 "github.com/harvester/networkfs-manager/pkg/apis/harvesterhci.io/v1beta2"
+	"github.com/harvester/networkfs-manager/pkg/utils"
+)
+
+const (
+	validatingWebhookName = "harvester-network-fs-manager-validator"
+	validatorName         = "validator.networkfs.harvesterhci.io"
+	validationPath        = "/v1/webhook/validation"
+	conversionPath        = "/v1/webhook/conversion"
+	servicePort           = int32(443)
+	timeoutSeconds        = int32(10)
+)
+
+// Server serves the admission webhooks of the manager with a self-managed serving certificate
+type Server struct {
+	namespace   string
+	serviceName string
+	port        int
+
+	router         *webhook.Router
+	converter      http.Handler
+	secrets        ctlcorev1.SecretClient
+	webhookConfigs ctladmissionregv1.ValidatingWebhookConfigurationClient
+	crds           ctlapiextv1.CustomResourceDefinitionClient
+
+	serving atomic.Pointer[servingCertificate]
+}
+
+// servingCertificate is the certificate the server presents, it is swapped once the certificate is renewed
+type servingCertificate struct {
+	cert    *certificate
+	keyPair *tls.Certificate
+}
+
+func NewServer(router *webhook.Router, converter http.Handler, secrets ctlcorev1.SecretClient, webhookConfigs ctladmissionregv1.ValidatingWebhookConfigurationClient,
+	crds ctlapiextv1.CustomResourceDefinitionClient, opt *utils.Option) *Server {
+	return &Server{
+		namespace:      opt.Namespace,
+		serviceName:    opt.WebhookServiceName,
+		port:           opt.WebhookPort,
+		router:         router,
+		converter:      converter,
+		secrets:        secrets,
+		webhookConfigs: webhookConfigs,
+		crds:           crds,
+	}
+}
+
+// Run ensures the serving certificate and the webhook configuration, then serves until the context is done.
+// The certificate is checked again every certCheckInterval, so it is renewed before it expires without a restart.
+func (s *Server) Run(ctx context.Context) error {
+	dnsNames := []string{
+		fmt.Sprintf("%s.%s.svc", s.serviceName, s.namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", s.serviceName, s.namespace),
+	}
+	if err := s.refreshCertificate(dnsNames, time.Now()); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(certCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.refreshCertificate(dnsNames, time.Now()); err != nil {
+					logrus.Errorf("Failed to renew webhook certificate, retry in %s: %v", certCheckInterval, err)
+				}
+			}
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle(validationPath, s.router)
+	mux.Handle(conversionPath, s.converter)
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", s.port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig: &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return s.serving.Load().keyPair, nil
+			},
+		},
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	logrus.Infof("Webhook server is listening on %s", server.Addr)
+	if err := server.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// refreshCertificate ensures the certificate stored in the secret is valid at now, and serves it once the webhooks
+// trust its CA. The CA of the replaced certificate stays in the bundle, so the apiserver keeps trusting the replicas
+// which serve the replaced certificate until their next check.
+func (s *Server) refreshCertificate(dnsNames []string, now time.Time) error {
+	cert, err := ensureCertificate(s.secrets, s.namespace, s.serviceName+"-tls", dnsNames, now)
+	if err != nil {
+		return fmt.Errorf("failed to ensure webhook certificate: %w", err)
+	}
+	current := s.serving.Load()
+	if current != nil && bytes.Equal(current.cert.certPEM, cert.certPEM) {
+		return nil
+	}
+	keyPair, err := tls.X509KeyPair(cert.certPEM, cert.keyPEM)
+	if err != nil {
+		return fmt.Errorf("failed to load webhook certificate: %w", err)
+	}
+
+	caBundle := cert.caPEM
+	if current != nil && !bytes.Equal(current.cert.caPEM, cert.caPEM) {
+		caBundle = append(bytes.Clone(cert.caPEM), current.cert.caPEM...)
+	}
+	if err := s.ensureWebhookConfiguration(caBundle); err != nil {
+		return fmt.Errorf("failed to ensure validating webhook configuration: %w", err)
+	}
+	if err := s.ensureConversion(caBundle); err != nil {
+		return fmt.Errorf("failed to ensure CRD conversion webhook: %w", err)
+	}
+
+	s.serving.Store(&servingCertificate{cert: cert, keyPair: &keyPair})
+	if current != nil {
+		logrus.Infof("Webhook certificate is renewed, it expires at %s", keyPair.Leaf.NotAfter)
+	}
+	return nil
+}
+
+func (s *Server) ensureWebhookConfiguration(caBundle []byte) error {
+	path := validationPath
+	port := servicePort
+	timeout := timeoutSeconds
+	failurePolicy := admissionregv1.Fail
+	sideEffects := admissionregv1.SideEffectClassNone
+	scope := admissionregv1.NamespacedScope
+	// the requests of the other served versions are converted to the storage version before validation
+	matchPolicy := admissionregv1.Equivalent
+	webhooks := []admissionregv1.ValidatingWebhook{
+		{
+			Name: validatorName,
+			ClientConfig: admissionregv1.WebhookClientConfig{
+				Service: &admissionregv1.ServiceReference{
+					Namespace: s.namespace,
+					Name:      s.serviceName,
+					Path:      &path,
+					Port:      &port,
+				},
+				CABundle: caBundle,
+			},
+			Rules: []admissionregv1.RuleWithOperations{
+				{
+					Operations: []admissionregv1.OperationType{admissionregv1.Create, admissionregv1.Update},
+					Rule: admissionregv1.Rule{
+						APIGroups:   []string{networkfsv2.SchemeGroupVersion.Group},
+						APIVersions: []string{networkfsv2.SchemeGroupVersion.Version},
+						Resources:   []string{"networkfilesystems"},
+						Scope:       &scope,
+					},
+				},
+			},
+			MatchPolicy:             &matchPolicy,
+			FailurePolicy:           &failurePolicy,
+			SideEffects:             &sideEffects,
+			AdmissionReviewVersions: []string{"v1"},
+			TimeoutSeconds:          &timeout,
+		},
+	}
+
+	vwc, err := s.webhookConfigs.Get(validatingWebhookName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		vwc = &admissionregv1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: validatingWebhookName,
+			},
+			Webhooks: webhooks,
+		}
+		if _, err := s.webhookConfigs.Create(vwc); err != nil && !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if reflect.DeepEqual(vwc.Webhooks, webhooks) {
+		return nil
+	}
+	vwcCpy := vwc.DeepCopy()
+	vwcCpy.Webhooks = webhooks
+	_, err = s.webhookConfigs.Update(vwcCpy)
+	return err
+}
+
+// ensureConversion points the conversion of the NetworkFilesystem CRD to the webhook, so the v1beta1 clients keep working
+func (s *Server) ensureConversion(caBundle []byte) error {
+	path := conversionPath
+	port := servicePort
+	conversion := &apiextensionsv1.CustomResourceConversion{
+		Strategy: apiextensionsv1.WebhookConverter,
+		Webhook: &apiextensionsv1.WebhookConversion{
+			ClientConfig: &apiextensionsv1.WebhookClientConfig{
+				Service: &apiextensionsv1.ServiceReference{
+					Namespace: s.namespace,
+					Name:      s.serviceName,
+					Path:      &path,
+					Port:      &port,
+				},
+				CABundle: caBundle,
+			},
+			ConversionReviewVersions: []string{"v1"},
+		},
+	}
+
+	crd, err := s.crds.Get(utils.NetworkFSCRDName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(crd.Spec.Conversion, conversion) {
+		return nil
+	}
+	crdCpy := crd.DeepCopy()
+	crdCpy.Spec.Conversion = conversion
+	_, err = s.crds.Update(crdCpy)
+	return err
+}